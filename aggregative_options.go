@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// aggregativeConfig is a configuration of an aggregative metric (see "AggregativeOption")
+type aggregativeConfig struct {
+	periods              []time.Duration
+	slicerInterval       time.Duration
+	slidingWindowBuckets uint
+	percentiles          []float64
+	decayHalfLife        time.Duration
+	bufferSize           uint
+}
+
+// AggregativeOption is an option of an aggregative metric. Options are passed to the constructors (like
+// "GaugeAggregativeFlow" or "TimingBuffered") and they're applied only if the metric is created by the call
+// (options are ignored if the metric already exists).
+type AggregativeOption func(cfg *aggregativeConfig)
+
+// WithPeriods sets aggregation periods of the metric (see "Slicing" in README.md) instead of the global ones
+// (see "SetAggregationPeriods").
+//
+// Every period should be a multiple of the slicer interval and every higher period should be a multiple of
+// the lower one. For example "WithPeriods(time.Minute, time.Hour)" could be used for low-value metrics
+// to save memory.
+//
+// The metric constructor panics if the periods are invalid (see "ValidateAggregationPeriods").
+func WithPeriods(periods ...time.Duration) AggregativeOption {
+	return func(cfg *aggregativeConfig) {
+		cfg.periods = append([]time.Duration{}, periods...)
+	}
+}
+
+// WithSlicerInterval sets the slicer interval of the metric (see "Slicing" in README.md) instead of the global one
+// (see "SetSlicerInterval").
+func WithSlicerInterval(interval time.Duration) AggregativeOption {
+	return func(cfg *aggregativeConfig) {
+		cfg.slicerInterval = interval
+	}
+}
+
+// WithPercentiles sets percentiles of the metric to be exported (see "GetDefaultPercentiles" of
+// "AggregativeStatistics") instead of the default ones of the registry (see "SetDefaultPercentiles").
+//
+// For "Flow" metrics only these percentiles are tracked, values of other percentiles are interpolated.
+// The metric constructor panics if the list is empty or a percentile is out of range 0.0 .. 1.0.
+func WithPercentiles(percentiles ...float64) AggregativeOption {
+	return func(cfg *aggregativeConfig) {
+		cfg.percentiles = append([]float64{}, percentiles...)
+	}
+}
+
+// newAggregativeConfig applies options to the default configuration
+func newAggregativeConfig(opts []AggregativeOption) (cfg aggregativeConfig) {
+	cfg.slicerInterval = slicerInterval
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return
+}
+
+// getAggregationPeriods returns aggregation periods of the configuration (in slicer intervals)
+func (cfg *aggregativeConfig) getAggregationPeriods() ([]AggregationPeriod, error) {
+	if cfg.slicerInterval <= 0 {
+		return nil, fmt.Errorf("%w: non-positive slicer interval %v", ErrInvalidAggregationPeriods, cfg.slicerInterval)
+	}
+	if cfg.periods == nil {
+		return GetAggregationPeriods(), nil
+	}
+	if len(cfg.periods) == 0 {
+		return nil, fmt.Errorf("%w: no periods", ErrInvalidAggregationPeriods)
+	}
+
+	periods := make([]AggregationPeriod, 0, len(cfg.periods))
+	for _, period := range cfg.periods {
+		if period <= 0 || period%cfg.slicerInterval != 0 {
+			return nil, fmt.Errorf("%w: period %v is not a multiple of the slicer interval %v",
+				ErrInvalidAggregationPeriods, period, cfg.slicerInterval)
+		}
+		periods = append(periods, AggregationPeriod{uint64(period / cfg.slicerInterval)})
+	}
+	if err := ValidateAggregationPeriods(periods); err != nil {
+		return nil, err
+	}
+	return periods, nil
+}
+
+// getPercentiles returns sorted percentiles of the configuration or nil if the default percentiles should be used
+func (cfg *aggregativeConfig) getPercentiles() ([]float64, error) {
+	if cfg.percentiles == nil {
+		return nil, nil
+	}
+	return normalizePercentiles(cfg.percentiles)
+}
+
+// ValidatePercentiles checks if the percentiles are supported (see "SetDefaultPercentiles" and "WithPercentiles"):
+// the list shouldn't be empty and every percentile should be in range 0.0 .. 1.0.
+func ValidatePercentiles(percentiles []float64) error {
+	_, err := normalizePercentiles(percentiles)
+	return err
+}
+
+// normalizePercentiles returns a sorted copy of the percentiles
+func normalizePercentiles(percentiles []float64) ([]float64, error) {
+	if len(percentiles) == 0 {
+		return nil, fmt.Errorf("%w: the list is empty", ErrInvalidPercentiles)
+	}
+	for _, p := range percentiles {
+		if !(p >= 0 && p <= 1) {
+			return nil, fmt.Errorf("%w: percentile %v is out of range 0.0 .. 1.0", ErrInvalidPercentiles, p)
+		}
+	}
+	r := append([]float64{}, percentiles...)
+	sort.Float64s(r)
+	return r, nil
+}
+
+// ValidateAggregationPeriods checks if the aggregation periods are supported: every period should be greater than
+// the previous one (and than the slicer interval) and should be a multiple of it.
+//
+// It's caused by our algorithm of calculating statistics of higher aggregation periods using
+// history of statistics of lower aggregation periods. So a higher aggregation period statistics
+// is calculated from multiple lower aggregation period statistics. For example we support: 1s, 5s, 1m;
+// but we doesn't support: 1s, 5s, 13s.
+func ValidateAggregationPeriods(periods []AggregationPeriod) error {
+	previousPeriod := *GetBaseAggregationPeriod()
+	for _, period := range periods {
+		if period.Interval <= previousPeriod.Interval || period.Interval%previousPeriod.Interval != 0 {
+			return fmt.Errorf("%w: period %d is not a multiple of the previous period %d",
+				ErrInvalidAggregationPeriods, period.Interval, previousPeriod.Interval)
+		}
+		previousPeriod = period
+	}
+	return nil
+}
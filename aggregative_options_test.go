@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func aggregativeLabels(metric AggregativeMetric) (labels []string) {
+	metric.EachAggregativeValue(func(label string, value *AggregativeValue) bool {
+		labels = append(labels, label)
+		return true
+	})
+	return
+}
+
+func TestWithPeriods(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	r := New()
+	r.SetClock(clock)
+	defer r.Reset()
+
+	cheap := r.GaugeAggregativeSimple(`cheap`, nil, WithPeriods(time.Minute, time.Hour))
+	assert.Equal(t, []string{`last`, `1s`, `1m`, `1h`, `total`}, aggregativeLabels(cheap))
+	assert.Equal(t, []AggregationPeriod{{60}, {3600}}, cheap.GetAggregationPeriods())
+	assert.Len(t, cheap.histories.ByPeriod, 2)
+
+	// options are ignored for already existing metrics
+	assert.Equal(t, cheap, r.GaugeAggregativeSimple(`cheap`, nil))
+
+	critical := r.TimingFlow(`critical`, nil, WithSlicerInterval(10*time.Second), WithPeriods(30*time.Second, time.Minute))
+	assert.Equal(t, []string{`last`, `10s`, `30s`, `1m`, `total`}, aggregativeLabels(critical))
+	for i := 0; i < 6; i++ {
+		critical.ConsiderValue(time.Millisecond)
+		clock.Advance(10 * time.Second)
+	}
+	assert.Equal(t, uint64(1), critical.GetValuePointers().ByPeriod(0).Count.Get())
+	assert.Equal(t, uint64(3), critical.GetValuePointers().ByPeriod(1).Count.Get())
+	assert.Equal(t, uint64(6), critical.GetValuePointers().ByPeriod(2).Count.Get())
+
+	assert.Panics(t, func() {
+		r.GaugeAggregativeFlow(`invalid`, nil, WithPeriods(5*time.Second, 7*time.Second))
+	})
+	assert.Panics(t, func() {
+		r.GaugeAggregativeFlow(`invalid`, nil, WithPeriods(1500*time.Millisecond))
+	})
+}
+
+func TestSetAggregationPeriods(t *testing.T) {
+	oldPeriods := GetAggregationPeriods()
+	defer SetAggregationPeriods(oldPeriods)
+
+	assert.Panics(t, func() {
+		SetAggregationPeriods([]AggregationPeriod{{5}, {13}})
+	})
+	assert.Equal(t, oldPeriods, GetAggregationPeriods())
+
+	SetAggregationPeriods([]AggregationPeriod{{10}, {60}})
+	assert.Equal(t, []AggregationPeriod{{10}, {60}}, GetAggregationPeriods())
+}
@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"time"
+)
+
+// WithDecayingReservoir makes a "Buffered" metric to use a forward-decay (exponentially biased) reservoir instead
+// of the uniform one (see "Decaying reservoir" in README.md): the weight of a value halves every "halfLife",
+// so percentiles of long aggregation periods (like "1d" and "total") reflect the recent behaviour.
+//
+// The size of the reservoir is the same as the size of the uniform buffer (see "WithBufferSize").
+// The option is ignored by "Simple" and "Flow" metrics.
+func WithDecayingReservoir(halfLife time.Duration) AggregativeOption {
+	return func(cfg *aggregativeConfig) {
+		cfg.decayHalfLife = halfLife
+	}
+}
+
+// decayingSample is a value stored in a decaying reservoir
+type decayingSample struct {
+	value float64
+
+	// logWeight is the logarithm of the forward-decay weight of the value: alpha*(t - landmark).
+	// Logarithms are used to avoid overflows on long-living metrics.
+	logWeight float64
+
+	// logPriority is the logarithm of the priority of the value in the reservoir (see "Priority sampling" of
+	// Duffield, Lund and Thorup): "weight/u" or "logWeight - ln(u)", where "u" is a random number from (0, 1].
+	logPriority float64
+}
+
+// decayingSamples is a min-heap of samples by priority (see "container/heap")
+type decayingSamples []decayingSample
+
+func (samples decayingSamples) Len() int { return len(samples) }
+func (samples decayingSamples) Less(i, j int) bool {
+	return samples[i].logPriority < samples[j].logPriority
+}
+func (samples decayingSamples) Swap(i, j int) { samples[i], samples[j] = samples[j], samples[i] }
+func (samples *decayingSamples) Push(x interface{}) {
+	*samples = append(*samples, x.(decayingSample))
+}
+func (samples *decayingSamples) Pop() interface{} {
+	old := *samples
+	last := old[len(old)-1]
+	*samples = old[:len(old)-1]
+	return last
+}
+
+// aggregativeStatisticsDecaying is a "Buffered" implementation of AggregativeStatistics with a forward-decay
+// reservoir (see "WithDecayingReservoir")
+type aggregativeStatisticsDecaying struct {
+	locker Spinlock
+
+	clock    Clock
+	landmark time.Time
+	alpha    float64
+
+	samples            decayingSamples
+	size               int
+	tickID             uint64
+	defaultPercentiles []float64
+
+	// logThreshold is the logarithm of the highest priority of discarded samples (-Inf if nothing is discarded).
+	// A kept sample represents "max(weight, threshold)" of the weight of all considered values (the estimator of
+	// priority sampling), see "getPercentiles".
+	logThreshold float64
+}
+
+// newAggregativeStatisticsDecaying returns a decaying reservoir (as a memory-reuse-aware constructor). The weight of
+// a value is "exp(alpha*(t - landmark))" where "alpha" is "ln(2)/halfLife".
+func newAggregativeStatisticsDecaying(defaultPercentiles []float64, size uint, clock Clock, landmark time.Time, halfLife time.Duration) *aggregativeStatisticsDecaying {
+	s := aggregativeStatisticsDecayingPool.Get().(*aggregativeStatisticsDecaying)
+	s.defaultPercentiles = defaultPercentiles
+	s.clock = clock
+	s.landmark = landmark
+	s.alpha = math.Ln2 / halfLife.Seconds()
+	s.logThreshold = math.Inf(-1)
+	s.size = int(size)
+	if cap(s.samples) < s.size {
+		s.samples = make(decayingSamples, 0, s.size)
+	}
+	return s
+}
+
+// Release should be called when the reservoir won't be used anymore (to put into into the pool of free reservoirs)
+// to reduce pressure on GC.
+func (s *aggregativeStatisticsDecaying) Release() {
+	if !MemoryReuseEnabled() {
+		return
+	}
+	s.samples = s.samples[:0]
+	s.tickID = 0
+	s.clock = nil
+	aggregativeStatisticsDecayingPool.Put(s)
+}
+
+// logWeightNow returns the logarithm of the weight of a value considered right now
+func (s *aggregativeStatisticsDecaying) logWeightNow() float64 {
+	return s.alpha * s.clock.Now().Sub(s.landmark).Seconds()
+}
+
+// offer puts the sample to the reservoir if its priority is high enough
+func (s *aggregativeStatisticsDecaying) offer(sample decayingSample) {
+	if len(s.samples) < s.size {
+		heap.Push(&s.samples, sample)
+		return
+	}
+	if s.size == 0 || sample.logPriority <= s.samples[0].logPriority {
+		s.discard(sample.logPriority)
+		return
+	}
+	s.discard(s.samples[0].logPriority)
+	s.samples[0] = sample
+	heap.Fix(&s.samples, 0)
+}
+
+// discard updates the threshold with the priority of a discarded sample
+func (s *aggregativeStatisticsDecaying) discard(logPriority float64) {
+	if logPriority > s.logThreshold {
+		s.logThreshold = logPriority
+	}
+}
+
+// randLogU returns ln(u) where "u" is a random number from (0, 1]
+func randLogU() float64 {
+	return math.Log((float64(randIntn(math.MaxUint32)) + 1) / (float64(math.MaxUint32) + 1))
+}
+
+// ConsiderValue is an analog of Prometheus' observe (see "Aggregative metrics" in README.md)
+func (s *aggregativeStatisticsDecaying) ConsiderValue(v float64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.tickID++
+	logWeight := s.logWeightNow()
+	s.offer(decayingSample{
+		value:       v,
+		logWeight:   logWeight,
+		logPriority: logWeight - randLogU(),
+	})
+}
+
+// Set resets the statistics and sets only one event with the value passed as the argument,
+// so all aggregative values (avg, min, max, ...) will be equal to the value
+func (s *aggregativeStatisticsDecaying) Set(value float64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	logWeight := s.logWeightNow()
+	s.samples = append(s.samples[:0], decayingSample{
+		value:       value,
+		logWeight:   logWeight,
+		logPriority: logWeight,
+	})
+	s.logThreshold = math.Inf(-1)
+}
+
+// MergeStatistics adds statistics of the argument to the own one. Both reservoirs are samples with priorities, so
+// the merged reservoir is just the samples with the highest priorities (and the threshold is the highest priority
+// discarded by any of them).
+func (s *aggregativeStatisticsDecaying) MergeStatistics(oldSI AggregativeStatistics) {
+	if oldSI == nil {
+		return
+	}
+	oldS, ok := oldSI.(*aggregativeStatisticsDecaying)
+	if !ok || oldS == s {
+		return
+	}
+
+	// copying the state of the argument to do not hold both locks at once (two merges in opposite directions would
+	// deadlock)
+	oldS.locker.Lock()
+	samples := make(decayingSamples, len(oldS.samples))
+	copy(samples, oldS.samples)
+	landmark, tickID, logThreshold := oldS.landmark, oldS.tickID, oldS.logThreshold
+	oldS.locker.Unlock()
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	// weights are relative to the landmark, so converting them to the own landmark
+	shift := s.alpha * landmark.Sub(s.landmark).Seconds()
+	for _, sample := range samples {
+		sample.logWeight += shift
+		sample.logPriority += shift
+		s.offer(sample)
+	}
+	s.discard(logThreshold + shift)
+	s.tickID += tickID
+}
+
+// getPercentiles returns values of the percentiles, weighting samples by the estimator of priority sampling:
+// a sample represents "max(weight, threshold)" (see "logThreshold"), so values which got into the reservoir
+// by chance are not underrepresented and the recent values are not overrepresented.
+func (s *aggregativeStatisticsDecaying) getPercentiles(percentiles []float64) []float64 {
+	r := make([]float64, len(percentiles))
+	if len(s.samples) == 0 {
+		return r
+	}
+
+	samples := make(decayingSamples, len(s.samples))
+	copy(samples, s.samples)
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	logEstimate := func(sample decayingSample) float64 {
+		return math.Max(sample.logWeight, s.logThreshold)
+	}
+	maxLogEstimate := logEstimate(samples[0])
+	for _, sample := range samples {
+		maxLogEstimate = math.Max(maxLogEstimate, logEstimate(sample))
+	}
+	cumulativeWeights := make([]float64, len(samples))
+	var totalWeight float64
+	for idx, sample := range samples {
+		totalWeight += math.Exp(logEstimate(sample) - maxLogEstimate)
+		cumulativeWeights[idx] = totalWeight
+	}
+
+	for pIdx, percentile := range percentiles {
+		idx := sort.SearchFloat64s(cumulativeWeights, percentile*totalWeight)
+		if idx >= len(samples) {
+			idx = len(samples) - 1
+		}
+		r[pIdx] = samples[idx].value
+	}
+	return r
+}
+
+// GetPercentile returns a percentile value for a given percentile (see https://en.wikipedia.org/wiki/Percentile).
+//
+// There will never be returned "nil" (because it's a "Buffered" aggregative statistics).
+func (s *aggregativeStatisticsDecaying) GetPercentile(percentile float64) *float64 {
+	return s.GetPercentiles([]float64{percentile})[0]
+}
+
+// GetPercentiles returns percentile values for a given slice of percentiles.
+//
+// Returned values are ordered accordingly to the input slice. An element of the returned
+// slice is never "nil" (because it's a "Buffered" aggregative statistics).
+func (s *aggregativeStatisticsDecaying) GetPercentiles(percentiles []float64) []*float64 {
+	s.locker.Lock()
+	values := s.getPercentiles(percentiles)
+	s.locker.Unlock()
+
+	r := make([]*float64, 0, len(percentiles))
+	for idx := range values {
+		r = append(r, &values[idx])
+	}
+	return r
+}
+
+// GetDefaultPercentiles returns default percentiles and its values.
+func (s *aggregativeStatisticsDecaying) GetDefaultPercentiles() ([]float64, []float64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.defaultPercentiles, s.getPercentiles(s.defaultPercentiles)
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayingReservoir(t *testing.T) {
+	r, clock := NewManualRegistry(time.Unix(0, 0))
+	defer r.Reset()
+
+	decaying := r.GaugeAggregativeBuffered(`decaying`, nil, WithDecayingReservoir(time.Minute))
+	uniform := r.GaugeAggregativeBuffered(`uniform`, nil)
+	_, ok := decaying.GetValuePointers().Total().AggregativeStatistics.(*aggregativeStatisticsDecaying)
+	assert.True(t, ok)
+
+	for i := 0; i < 5000; i++ {
+		decaying.ConsiderValue(100)
+		uniform.ConsiderValue(100)
+	}
+	clock.Advance(10 * time.Minute)
+	for i := 0; i < 500; i++ {
+		decaying.ConsiderValue(1)
+		uniform.ConsiderValue(1)
+	}
+
+	// the old values are 2^10 times less important, so they are about 1% of the weight
+	total := decaying.GetValuePointers().Total()
+	assert.Equal(t, float64(1), *total.GetPercentile(0.5))
+	assert.Equal(t, float64(1), *total.GetPercentile(0.98))
+	assert.Equal(t, float64(100), *total.GetPercentile(0.995))
+	assert.Equal(t, float64(100), *total.GetPercentile(1))
+	assert.Len(t, total.AggregativeStatistics.(*aggregativeStatisticsDecaying).samples, defaultBufferSize)
+
+	assert.Equal(t, float64(100), *uniform.GetValuePointers().Total().GetPercentile(0.5))
+
+	// merging keeps the most important values
+	clock.Advance(time.Second)
+	merged := decaying.NewAggregativeValue()
+	defer merged.Release()
+	merged.MergeData(decaying.GetValuePointers().ByPeriod(2))
+	assert.Equal(t, float64(1), *merged.GetPercentile(0.5))
+	merged.MergeData(total)
+	assert.Equal(t, float64(1), *merged.GetPercentile(0.5))
+	assert.Len(t, merged.AggregativeStatistics.(*aggregativeStatisticsDecaying).samples, defaultBufferSize)
+}
+
+func TestDecayingReservoirMergeBothWays(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	a := newAggregativeStatisticsDecaying(defaultFlowPercentiles, 100, clock, clock.Now(), time.Minute)
+	b := newAggregativeStatisticsDecaying(defaultFlowPercentiles, 100, clock, clock.Now(), time.Minute)
+	a.ConsiderValue(1)
+	b.ConsiderValue(2)
+
+	// merges in opposite directions should not deadlock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			a.MergeStatistics(b)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		b.MergeStatistics(a)
+	}
+	<-done
+	assert.NotNil(t, a.GetPercentile(0.5))
+}
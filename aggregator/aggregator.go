@@ -0,0 +1,73 @@
+// Package aggregator implements cross-process aggregation of metrics: a "Client" (a metrics.Sender) pushes updates
+// of metrics of a registry to a "Server" which merges updates of all clients into its own registry.
+//
+// It's useful when many short-lived workers run on the same host: every worker pushes its updates to the server
+// (via TCP or a Unix socket), and only the merged metrics of the server are exported.
+//
+// Updates are:
+//   - the increment since the previous update for "Count";
+//   - the current value for gauges (the last update wins);
+//   - the statistics of all slices since the previous update for aggregative metrics (merged to the current slice
+//     of the metric of the server, so the aggregation periods are calculated by the server).
+package aggregator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/trafficstars/metrics"
+)
+
+const (
+	// updateLabel is the label of the aggregative value of an update (see "metrics.MetricState")
+	updateLabel = `update`
+
+	// maxFrameSize is the maximal size of a serialized update
+	maxFrameSize = 16 << 20
+)
+
+var (
+	// ErrFrameTooLarge is returned if a received update is larger than the limit (it's likely a corrupted stream)
+	ErrFrameTooLarge = errors.New(`the update is too large`)
+
+	// ErrUnsupportedMetricType is returned if an update of a metric of an unsupported type is received
+	ErrUnsupportedMetricType = errors.New(`unsupported metric type`)
+)
+
+// writeFrame writes a serialized update prefixed by its length
+func writeFrame(w io.Writer, state *metrics.MetricState) error {
+	data, err := state.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	frame = append(frame[:binary.PutUvarint(frame, uint64(len(data)))], data...)
+	_, err = w.Write(frame)
+	return err
+}
+
+// readFrame reads an update written by "writeFrame". It returns io.EOF if the stream is finished between updates.
+func readFrame(r *bufio.Reader) (*metrics.MetricState, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	state := &metrics.MetricState{}
+	if err := state.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
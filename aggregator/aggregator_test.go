@@ -0,0 +1,158 @@
+package aggregator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trafficstars/metrics"
+)
+
+func startTestServer(t *testing.T, network, address string) (*Server, *metrics.Registry, string) {
+	listener, err := net.Listen(network, address)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	r, _ := metrics.NewManualRegistry(time.Unix(1000000, 0))
+	server := NewServer(r)
+	server.SetErrorHandler(func(err error) { t.Error(err) })
+	go func() {
+		assert.True(t, errors.Is(server.Serve(listener), net.ErrClosed))
+	}()
+	return server, r, listener.Addr().String()
+}
+
+func TestClientServer(t *testing.T) {
+	server, serverRegistry, address := startTestServer(t, `tcp`, `127.0.0.1:0`)
+	defer serverRegistry.Reset()
+	defer server.Close()
+
+	for worker := 0; worker < 2; worker++ {
+		r, clock := metrics.NewManualRegistry(time.Unix(1000000, 0))
+		defer r.Reset()
+		client := NewClient(r, `tcp`, address)
+		defer client.Close()
+
+		timing := r.TimingBuffered(`latency`, metrics.Tags{`handler`: `index`})
+		requests := r.Count(`requests`, nil)
+		for i := 1; i <= 100; i++ {
+			timing.ConsiderValue(time.Duration(i) * time.Millisecond)
+			requests.Increment()
+		}
+		r.GaugeFloat64(`temperature`, nil).Set(float64(worker))
+
+		// values are sent only after slicing
+		timing.Send(client)
+		clock.Advance(time.Second)
+		timing.Send(client)
+		timing.Send(client)
+		requests.Send(client)
+		r.GaugeFloat64(`temperature`, nil).Send(client)
+
+		requests.Add(5)
+		requests.Send(client)
+		requests.Send(client)
+	}
+
+	timing := serverRegistry.TimingBuffered(`latency`, metrics.Tags{`handler`: `index`})
+	assert.Eventually(t, func() bool {
+		return serverRegistry.Count(`requests`, nil).Get() == 210 &&
+			timing.GetValuePointers().Total().Count.Get() == 200
+	}, time.Second, time.Millisecond)
+
+	total := timing.GetValuePointers().Total()
+	assert.Equal(t, float64(time.Millisecond), total.Min.Get())
+	assert.Equal(t, float64(100*time.Millisecond), total.Max.Get())
+	assert.Equal(t, float64(50500*time.Microsecond), total.Avg.Get())
+	assert.InDelta(t, float64(50*time.Millisecond), *total.GetPercentile(0.5), float64(5*time.Millisecond))
+	assert.Contains(t, []float64{0, 1}, serverRegistry.GaugeFloat64(`temperature`, nil).Get())
+
+	// the merged values are sliced by the server
+	timing.DoSlice()
+	assert.Equal(t, uint64(200), timing.GetValuePointers().ByPeriod(0).Count.Get())
+}
+
+func TestClientRetry(t *testing.T) {
+	listener, err := net.Listen(`unix`, filepath.Join(t.TempDir(), `metrics.sock`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	r, clock := metrics.NewManualRegistry(time.Unix(1000000, 0))
+	defer r.Reset()
+	client := NewClient(r, `unix`, address)
+	defer client.Close()
+	client.SetTimeout(time.Second)
+
+	gauge := r.GaugeAggregativeFlow(`load`, nil)
+	count := r.Count(`requests`, nil)
+	gauge.ConsiderValue(1)
+	count.Add(3)
+	clock.Advance(time.Second)
+
+	// the server is not available, so other updates of the iteration are not even tried
+	assert.Error(t, client.SendUint64(count, ``, uint64(count.Get())))
+	assert.True(t, errors.Is(client.SendUint64(gauge, `load_total_count`, 0), errDialPostponed))
+
+	// the not delivered updates are sent on the next iteration when the server becomes available
+	server, serverRegistry, _ := startTestServer(t, `unix`, address)
+	defer serverRegistry.Reset()
+	defer server.Close()
+	gauge.ConsiderValue(3)
+	clock.Advance(r.GetDefaultIterateInterval())
+	count.Send(client)
+	gauge.Send(client)
+
+	serverGauge := serverRegistry.GaugeAggregativeFlow(`load`, nil)
+	assert.Eventually(t, func() bool {
+		return serverRegistry.Count(`requests`, nil).Get() == 3 &&
+			serverGauge.GetValuePointers().Total().Count.Get() == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, float64(2), serverGauge.GetValuePointers().Total().Avg.Get())
+}
+
+func TestServerApply(t *testing.T) {
+	r, _ := metrics.NewManualRegistry(time.Unix(1000000, 0))
+	defer r.Reset()
+	server := NewServer(r)
+
+	assert.NoError(t, server.Apply(&metrics.MetricState{Name: `level`, Type: metrics.TypeGaugeInt64, Value: -3}))
+	assert.Equal(t, int64(-3), r.GaugeInt64(`level`, nil).Get())
+	err := server.Apply(&metrics.MetricState{Name: `func`, Type: metrics.TypeGaugeInt64Func})
+	assert.True(t, errors.Is(err, ErrUnsupportedMetricType))
+
+	// corrupted streams
+	var errs []error
+	var locker sync.Mutex
+	server.SetErrorHandler(func(err error) {
+		locker.Lock()
+		errs = append(errs, err)
+		locker.Unlock()
+	})
+	var buf bytes.Buffer
+	assert.NoError(t, writeFrame(&buf, &metrics.MetricState{Name: `requests`, Type: metrics.TypeCount, Value: 1}))
+	state, err := readFrame(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	assert.NoError(t, err)
+	assert.Equal(t, `requests`, state.Name)
+	for _, data := range [][]byte{buf.Bytes()[:buf.Len()-1], {0xff, 0xff, 0xff, 0xff, 0x7f}} {
+		serverConn, clientConn := net.Pipe()
+		server.wg.Add(1)
+		go func() {
+			_, _ = clientConn.Write(data)
+			_ = clientConn.Close()
+		}()
+		server.handleConn(serverConn)
+	}
+	assert.Len(t, errs, 2)
+	assert.True(t, errors.Is(errs[1], ErrFrameTooLarge))
+	assert.Equal(t, int64(0), r.Count(`requests`, nil).Get())
+}
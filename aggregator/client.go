@@ -0,0 +1,254 @@
+package aggregator
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trafficstars/metrics"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	// updateKeySuffix is the suffix of the key of the value which triggers sending of an update of an aggregative
+	// metric (all values of the metric are passed to the sender one by one, but the statistics are sent only once)
+	updateKeySuffix = `_total_count`
+)
+
+// errDialPostponed is returned instead of connecting to the server again right after a failed attempt
+var errDialPostponed = errors.New(`connecting is postponed until the next iteration after a failed attempt`)
+
+// Client is a metrics.Sender which pushes updates of metrics to a "Server" (see the description of the package).
+//
+// It should be set as the sender of the registry which was passed to "NewClient" (see "SetSender"), then updates
+// are pushed on every iteration (see "SetDefaultIterateInterval"). The connection is established on the first
+// update and reestablished on the next update after a failure (but if connecting fails then the updates are not
+// sent until the next iteration). Not delivered updates are kept and retried.
+type Client struct {
+	locker   sync.Mutex
+	registry *metrics.Registry
+	network  string
+	address  string
+	timeout  time.Duration
+	conn     net.Conn
+	closed   bool
+
+	// dialFailedAt is the time of the last failed attempt to connect
+	dialFailedAt time.Time
+
+	// pending are statistics of slices of aggregative metrics which are not sent, yet (by the key of a metric)
+	pending map[string]*metrics.AggregativeValue
+
+	// sentCounts are the values of counters at the previous successful sending (by the key of a metric)
+	sentCounts map[string]int64
+
+	// removeSliceHook removes the hook which fills "pending" (see "Close")
+	removeSliceHook func()
+}
+
+// NewClient returns a Client which pushes updates of metrics of the registry to the server listening on
+// the address of the network ("tcp", "unix" and so on, see "net.Dial")
+func NewClient(registry *metrics.Registry, network, address string) *Client {
+	client := &Client{
+		registry:   registry,
+		network:    network,
+		address:    address,
+		timeout:    defaultTimeout,
+		pending:    map[string]*metrics.AggregativeValue{},
+		sentCounts: map[string]int64{},
+	}
+	client.removeSliceHook = registry.AddOnSliceHook(client.considerSlice)
+	return client
+}
+
+// SetTimeout sets the timeout of connecting and of sending of an update (the default one is 5 seconds)
+func (client *Client) SetTimeout(timeout time.Duration) {
+	client.locker.Lock()
+	client.timeout = timeout
+	client.locker.Unlock()
+}
+
+// considerSlice remembers the statistics of a slice to be sent with the next update of the metric
+func (client *Client) considerSlice(metric metrics.AggregativeMetric, slice *metrics.AggregativeValue) {
+	if slice.Count.Get() == 0 {
+		return
+	}
+	client.mergePending(metric, slice)
+}
+
+// mergePending merges the statistics to the not sent statistics of the metric
+func (client *Client) mergePending(metric metrics.Metric, value *metrics.AggregativeValue) {
+	client.locker.Lock()
+	defer client.locker.Unlock()
+	if client.closed {
+		return
+	}
+
+	key := string(metric.GetKey())
+	pending := client.pending[key]
+	if pending == nil {
+		newValuer, ok := metric.(interface {
+			NewAggregativeValue() *metrics.AggregativeValue
+		})
+		if !ok {
+			return
+		}
+		pending = newValuer.NewAggregativeValue()
+		client.pending[key] = pending
+	}
+	pending.LockDo(func(pending *metrics.AggregativeValue) {
+		pending.MergeData(value)
+	})
+}
+
+// takePending returns the not sent statistics of the metric (and forgets them)
+func (client *Client) takePending(metric metrics.Metric) *metrics.AggregativeValue {
+	client.locker.Lock()
+	defer client.locker.Unlock()
+
+	key := string(metric.GetKey())
+	pending := client.pending[key]
+	delete(client.pending, key)
+	return pending
+}
+
+// send sends an update to the server
+func (client *Client) send(state *metrics.MetricState) error {
+	client.locker.Lock()
+	defer client.locker.Unlock()
+	if client.closed {
+		return net.ErrClosed
+	}
+
+	if client.conn == nil {
+		// updates of all metrics are sent on the same tick of the iteration, so not waiting for the timeout on
+		// every one of them if the server is not available
+		now := client.registry.Now()
+		if !client.dialFailedAt.IsZero() &&
+			now.Sub(client.dialFailedAt) < client.registry.GetDefaultIterateInterval()/2 {
+			return errDialPostponed
+		}
+		conn, err := net.DialTimeout(client.network, client.address, client.timeout)
+		if err != nil {
+			client.dialFailedAt = now
+			return err
+		}
+		client.dialFailedAt = time.Time{}
+		client.conn = conn
+	}
+	if err := client.conn.SetWriteDeadline(time.Now().Add(client.timeout)); err != nil {
+		return client.dropConnection(err)
+	}
+	if err := writeFrame(client.conn, state); err != nil {
+		return client.dropConnection(err)
+	}
+	return nil
+}
+
+// dropConnection closes the connection after a failure (it's reestablished on the next update) and returns the error
+func (client *Client) dropConnection(err error) error {
+	_ = client.conn.Close()
+	client.conn = nil
+	return err
+}
+
+// sendMetric sends an update of the metric with the value of the key (see "metrics.Sender")
+func (client *Client) sendMetric(metric metrics.Metric, key string, value float64) error {
+	if _, ok := metric.(metrics.AggregativeMetric); ok && !strings.HasSuffix(key, updateKeySuffix) {
+		return nil
+	}
+
+	state := &metrics.MetricState{
+		Name: metric.GetName(),
+		Tags: metrics.Tags(metric.GetTags().ToMap()),
+		Type: metric.GetType(),
+	}
+
+	switch state.Type {
+	case metrics.TypeCount:
+		metricKey := string(metric.GetKey())
+		count := int64(value)
+		client.locker.Lock()
+		delta := count - client.sentCounts[metricKey]
+		client.locker.Unlock()
+		if delta < 0 {
+			// the metric was recreated (for example after GC)
+			delta = count
+		}
+		if delta == 0 {
+			return nil
+		}
+		state.Value = float64(delta)
+		if err := client.send(state); err != nil {
+			return err
+		}
+		client.locker.Lock()
+		client.sentCounts[metricKey] = count
+		client.locker.Unlock()
+		return nil
+
+	case metrics.TypeGaugeInt64Func:
+		state.Type = metrics.TypeGaugeInt64
+	case metrics.TypeGaugeFloat64Func:
+		state.Type = metrics.TypeGaugeFloat64
+	}
+
+	if _, ok := metric.(metrics.AggregativeMetric); !ok {
+		state.Value = value
+		return client.send(state)
+	}
+
+	pending := client.takePending(metric)
+	if pending == nil {
+		return nil
+	}
+	defer pending.Release()
+	state.AggregativeValues = map[string]*metrics.AggregativeValue{updateLabel: pending}
+	if err := client.send(state); err != nil {
+		client.mergePending(metric, pending)
+		return err
+	}
+	return nil
+}
+
+// SendInt64 sends an update of the metric (see "metrics.Sender")
+func (client *Client) SendInt64(metric metrics.Metric, key string, value int64) error {
+	return client.sendMetric(metric, key, float64(value))
+}
+
+// SendUint64 sends an update of the metric (see "metrics.Sender")
+func (client *Client) SendUint64(metric metrics.Metric, key string, value uint64) error {
+	return client.sendMetric(metric, key, float64(int64(value)))
+}
+
+// SendFloat64 sends an update of the metric (see "metrics.Sender")
+func (client *Client) SendFloat64(metric metrics.Metric, key string, value float64) error {
+	return client.sendMetric(metric, key, value)
+}
+
+// Close removes the slice hook from the registry and closes the connection. Not sent updates are dropped, so
+// the registry should be closed before (see "Registry.Close"), it sends the final updates.
+func (client *Client) Close() error {
+	client.removeSliceHook()
+
+	client.locker.Lock()
+	defer client.locker.Unlock()
+	if client.closed {
+		return nil
+	}
+	client.closed = true
+
+	for _, pending := range client.pending {
+		pending.Release()
+	}
+	client.pending = nil
+	if client.conn == nil {
+		return nil
+	}
+	err := client.conn.Close()
+	client.conn = nil
+	return err
+}
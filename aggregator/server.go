@@ -0,0 +1,176 @@
+package aggregator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/trafficstars/metrics"
+)
+
+// Server receives updates of metrics from clients (see "Client") and merges them into a registry. The merged
+// metrics are regular metrics of the registry, so they are exported (and sliced, collected and so on) as usual.
+//
+// Missing metrics are created with the default options of the registry (see "Registry.GetOrCreate"), so
+// metrics with custom options should be created before.
+type Server struct {
+	locker       sync.Mutex
+	registry     *metrics.Registry
+	listeners    map[net.Listener]struct{}
+	conns        map[net.Conn]struct{}
+	errorHandler func(error)
+	closed       bool
+	wg           sync.WaitGroup
+}
+
+// NewServer returns a Server which merges received updates into the registry
+func NewServer(registry *metrics.Registry) *Server {
+	return &Server{
+		registry:  registry,
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+	}
+}
+
+// SetErrorHandler sets the function to be called on every failure of receiving or applying of an update (for
+// example to log it). A connection is closed after a failure of receiving.
+func (server *Server) SetErrorHandler(handler func(error)) {
+	server.locker.Lock()
+	server.errorHandler = handler
+	server.locker.Unlock()
+}
+
+func (server *Server) handleError(err error) {
+	server.locker.Lock()
+	handler := server.errorHandler
+	server.locker.Unlock()
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// ListenAndServe listens on the address of the network ("tcp", "unix" and so on, see "net.Listen") and
+// handles connections of clients (see "Serve")
+func (server *Server) ListenAndServe(network, address string) error {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve accepts connections of clients on the listener and handles them. It blocks until the listener fails or
+// the server is closed (in this case net.ErrClosed is returned).
+func (server *Server) Serve(listener net.Listener) error {
+	server.locker.Lock()
+	if server.closed {
+		server.locker.Unlock()
+		_ = listener.Close()
+		return net.ErrClosed
+	}
+	server.listeners[listener] = struct{}{}
+	server.locker.Unlock()
+
+	defer func() {
+		server.locker.Lock()
+		delete(server.listeners, listener)
+		server.locker.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.locker.Lock()
+			closed := server.closed
+			server.locker.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+
+		server.locker.Lock()
+		if server.closed {
+			server.locker.Unlock()
+			_ = conn.Close()
+			return net.ErrClosed
+		}
+		server.conns[conn] = struct{}{}
+		server.wg.Add(1)
+		server.locker.Unlock()
+
+		go server.handleConn(conn)
+	}
+}
+
+// handleConn applies updates received via the connection until it's closed
+func (server *Server) handleConn(conn net.Conn) {
+	defer server.wg.Done()
+	defer func() {
+		_ = conn.Close()
+		server.locker.Lock()
+		delete(server.conns, conn)
+		server.locker.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		state, err := readFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				server.handleError(fmt.Errorf("unable to receive an update from %v: %w", conn.RemoteAddr(), err))
+			}
+			return
+		}
+		if err := server.Apply(state); err != nil {
+			server.handleError(err)
+		}
+		state.Release()
+	}
+}
+
+// Apply merges an update into the registry of the server (see the description of the package)
+func (server *Server) Apply(state *metrics.MetricState) error {
+	metric := server.registry.GetOrCreate(state.Type, state.Name, state.Tags)
+	switch metric := metric.(type) {
+	case *metrics.MetricCount:
+		metric.Add(int64(state.Value))
+	case *metrics.MetricGaugeInt64:
+		metric.Set(int64(state.Value))
+	case *metrics.MetricGaugeFloat64:
+		metric.Set(state.Value)
+	case interface {
+		MergeAggregativeValue(*metrics.AggregativeValue)
+	}:
+		metric.MergeAggregativeValue(state.AggregativeValues[updateLabel])
+	default:
+		return fmt.Errorf("%w: %v (metric %v)", ErrUnsupportedMetricType, state.Type, state.Name)
+	}
+	return nil
+}
+
+// Close stops accepting new connections, closes all connections of clients and waits until they are handled
+func (server *Server) Close() error {
+	server.locker.Lock()
+	if server.closed {
+		server.locker.Unlock()
+		return nil
+	}
+	server.closed = true
+	var err error
+	for listener := range server.listeners {
+		if closeErr := listener.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	for conn := range server.conns {
+		_ = conn.Close()
+	}
+	server.locker.Unlock()
+
+	server.wg.Wait()
+	return err
+}
@@ -0,0 +1,405 @@
+package metrics
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// See "Persistence" in README.md
+
+const (
+	// registryStateVersion is the version of the format of a registry state (see "SaveTo"). It should be
+	// incremented on every incompatible change of the format.
+	registryStateVersion = 1
+
+	// maxRegistryStateEntrySize is the limit of the size of a metric entry of a registry state, it protects
+	// from allocating too much memory on corrupted data
+	maxRegistryStateEntrySize = 1 << 30
+)
+
+// marshalHistory writes the pieces of statistics stored in the histories (see "collectHistoryItems"). The ages and
+// the durations are written in nanoseconds to be independent of the slicer interval.
+func (m *commonAggregative) marshalHistory(e *binaryEncoder) error {
+	m.histories.Lock()
+	defer m.histories.Unlock()
+
+	slicerInterval := uint64(m.GetSlicerInterval())
+	items := m.collectHistoryItems()
+	e.putUvarint(uint64(len(items)))
+	for _, item := range items {
+		data, err := item.value.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.putUvarint(item.age * slicerInterval)
+		e.putUvarint(item.duration * slicerInterval)
+		e.putUvarint(item.period * slicerInterval)
+		e.putBytes(data)
+	}
+	return nil
+}
+
+// unmarshalHistory reads the pieces of statistics written by "marshalHistory". The pieces are aged by "elapsed".
+//
+// The returned values should be released by the caller.
+func (m *commonAggregative) unmarshalHistory(d *binaryDecoder, elapsed time.Duration) ([]historyItem, error) {
+	slicerInterval := uint64(m.GetSlicerInterval())
+	count := d.length(4)
+	items := make([]historyItem, 0, count)
+	for i := 0; i < count; i++ {
+		age := d.uvarint()
+		duration := d.uvarint()
+		period := d.uvarint()
+		data := d.bytes()
+		if d.err != nil {
+			break
+		}
+		value := newAggregativeValue()
+		if err := value.UnmarshalBinary(data); err != nil {
+			value.Release()
+			releaseHistoryItems(items)
+			return nil, err
+		}
+		item := historyItem{
+			value:    value,
+			age:      (age + uint64(elapsed)) / slicerInterval,
+			duration: duration / slicerInterval,
+			period:   period / slicerInterval,
+		}
+		if item.duration == 0 {
+			item.duration = 1
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// releaseHistoryItems releases values of the pieces of statistics
+func releaseHistoryItems(items []historyItem) {
+	for _, item := range items {
+		item.value.Release()
+	}
+}
+
+// longestAggregationPeriod returns the longest aggregation period of the metric
+func (m *commonAggregative) longestAggregationPeriod() time.Duration {
+	periods := m.GetAggregationPeriods()
+	if len(periods) == 0 {
+		return m.GetSlicerInterval()
+	}
+	return time.Duration(periods[len(periods)-1].Interval) * m.GetSlicerInterval()
+}
+
+// defaultLongestAggregationPeriod returns the longest aggregation period of new metrics (see
+// "SetAggregationPeriods"), it's used as the lifetime of saved values of non-aggregative metrics
+func defaultLongestAggregationPeriod() time.Duration {
+	periods := GetAggregationPeriods()
+	if len(periods) == 0 {
+		return slicerInterval
+	}
+	return time.Duration(periods[len(periods)-1].Interval) * slicerInterval
+}
+
+// restoreState merges a saved state to the metric: the value "total" is merged to the total value, and
+// the pieces of statistics "items" are merged to the histories (the values of the aggregation periods are
+// recalculated, see "rebuildHistories").
+func (m *commonAggregative) restoreState(total *AggregativeValue, items []historyItem) {
+	if total != nil {
+		m.data.Total().Do(func(value *AggregativeValue) {
+			value.Lock()
+			defer value.Unlock()
+			value.MergeData(total)
+		})
+	}
+
+	m.lock()
+	defer m.unlock()
+	m.histories.Lock()
+	defer m.histories.Unlock()
+
+	if !m.IsSlidingWindow() {
+		// the state could be saved in the sliding window mode
+		items = nonOverlappingHistoryItems(items)
+	}
+	m.rebuildHistories(m.aggregationPeriods, append(m.collectHistoryItems(), items...))
+}
+
+// aggregativeCheckpointer is implemented by all aggregative metrics (see "commonAggregative")
+type aggregativeCheckpointer interface {
+	marshalHistory(e *binaryEncoder) error
+	unmarshalHistory(d *binaryDecoder, elapsed time.Duration) ([]historyItem, error)
+	longestAggregationPeriod() time.Duration
+	restoreState(total *AggregativeValue, items []historyItem)
+}
+
+// marshalMetricEntry returns an entry of a registry state for the metric
+func marshalMetricEntry(metric Metric) ([]byte, error) {
+	state, err := NewMetricState(metric)
+	if err != nil {
+		return nil, err
+	}
+	defer state.Release()
+	stateData, err := state.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var e binaryEncoder
+	e.putBytes(stateData)
+	if checkpointer, ok := metric.(aggregativeCheckpointer); ok {
+		if err := checkpointer.marshalHistory(&e); err != nil {
+			return nil, err
+		}
+	}
+	return e.buf, nil
+}
+
+// SaveTo writes the state of all metrics of the registry (values of counters and gauges, aggregation histories
+// of aggregative metrics) to "w". The state could be restored by "LoadFrom" (for example after a restart of
+// the process), see "Persistence" in README.md.
+//
+// Func metrics (like "GaugeInt64Func") are not saved.
+func (r *Registry) SaveTo(w io.Writer) error {
+	bufW := bufio.NewWriter(w)
+	header := binaryEncoder{buf: []byte{registryStateVersion}}
+	header.putUvarint(uint64(r.Now().UnixNano()))
+	if _, err := bufW.Write(header.buf); err != nil {
+		return err
+	}
+
+	for _, metricKey := range r.storage.Keys() {
+		metricI, _ := r.storage.GetByBytes(metricKey.([]byte))
+		metric, ok := metricI.(Metric)
+		if !ok {
+			continue
+		}
+		switch metric.GetType() {
+		case TypeGaugeInt64Func, TypeGaugeFloat64Func:
+			continue
+		}
+		data, err := marshalMetricEntry(metric)
+		if err != nil {
+			return fmt.Errorf("metric %v: %w", metric.GetName(), err)
+		}
+		entry := binaryEncoder{}
+		entry.putBytes(data)
+		if _, err := bufW.Write(entry.buf); err != nil {
+			return err
+		}
+	}
+	return bufW.Flush()
+}
+
+// SaveTo writes the state of all metrics of the default registry to "w" (see "Registry.SaveTo")
+func SaveTo(w io.Writer) error {
+	return registry.SaveTo(w)
+}
+
+// loadMetricEntry merges an entry of a registry state to the registry
+func (r *Registry) loadMetricEntry(data []byte, elapsed time.Duration) error {
+	d := binaryDecoder{buf: data}
+	state := &MetricState{}
+	if err := state.UnmarshalBinary(d.bytes()); err != nil {
+		return err
+	}
+	defer state.Release()
+
+	metric := r.Get(state.Type, state.Name, state.Tags)
+	if metric == nil {
+		if elapsed > defaultLongestAggregationPeriod() {
+			// stale, do not create the metric
+			return nil
+		}
+		metric = r.GetOrCreate(state.Type, state.Name, state.Tags)
+		if metric == nil {
+			return nil
+		}
+	}
+
+	checkpointer, ok := metric.(aggregativeCheckpointer)
+	if !ok {
+		if elapsed > defaultLongestAggregationPeriod() {
+			return nil
+		}
+		switch metric := metric.(type) {
+		case *MetricCount:
+			metric.Add(int64(state.Value))
+		case *MetricGaugeInt64:
+			metric.Set(int64(state.Value))
+		case *MetricGaugeFloat64:
+			metric.Set(state.Value)
+		}
+		return d.finish()
+	}
+
+	items, err := checkpointer.unmarshalHistory(&d, elapsed)
+	if err != nil {
+		return err
+	}
+	defer releaseHistoryItems(items)
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if elapsed > checkpointer.longestAggregationPeriod() {
+		return nil
+	}
+	checkpointer.restoreState(state.AggregativeValues[`total`], items)
+	return nil
+}
+
+// LoadFrom reads a state written by "SaveTo" and merges it to the registry: counters are increased by the saved
+// values, gauges are set to the saved values, and the saved aggregation histories are merged to histories of
+// aggregative metrics (so "1h", "1d" and "total" continue from the saved state).
+//
+// Missing metrics are created with the default options, so metrics with custom options (like "WithPeriods") should
+// be created before the call. If the state is older than the longest aggregation period of a metric, then
+// the entry of the metric is skipped.
+//
+// ErrUnsupportedFormatVersion is returned if the state was written by an incompatible version of the package.
+func (r *Registry) LoadFrom(reader io.Reader) error {
+	if r.IsDisabled() {
+		return nil
+	}
+
+	bufR := bufio.NewReader(reader)
+	version, err := bufR.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != registryStateVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedFormatVersion, version)
+	}
+	savedAtNano, err := binary.ReadUvarint(bufR)
+	if err != nil {
+		return fmt.Errorf("%w: cannot read the time of the state: %v", ErrInvalidBinaryData, err)
+	}
+	elapsed := r.Now().Sub(time.Unix(0, int64(savedAtNano)))
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	for {
+		size, err := binary.ReadUvarint(bufR)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: cannot read the size of an entry: %v", ErrInvalidBinaryData, err)
+		}
+		if size > maxRegistryStateEntrySize {
+			return fmt.Errorf("%w: too big entry: %d", ErrInvalidBinaryData, size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(bufR, data); err != nil {
+			return fmt.Errorf("%w: cannot read an entry: %v", ErrInvalidBinaryData, err)
+		}
+		if err := r.loadMetricEntry(data, elapsed); err != nil {
+			return err
+		}
+	}
+}
+
+// LoadFrom reads a state written by "SaveTo" and merges it to the default registry (see "Registry.LoadFrom")
+func LoadFrom(reader io.Reader) error {
+	return registry.LoadFrom(reader)
+}
+
+// SaveToFile writes the state of the registry (see "SaveTo") to the file. The file is replaced atomically, so
+// it always contains a complete state.
+func (r *Registry) SaveToFile(path string) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+`.tmp*`)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := r.SaveTo(tmpFile); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// SaveToFile writes the state of the default registry to the file (see "Registry.SaveToFile")
+func SaveToFile(path string) error {
+	return registry.SaveToFile(path)
+}
+
+// LoadFromFile reads a state written by "SaveToFile" (see "LoadFrom"). It does nothing if the file doesn't exist.
+func (r *Registry) LoadFromFile(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return r.LoadFrom(file)
+}
+
+// LoadFromFile reads a state written by "SaveToFile" and merges it to the default registry
+// (see "Registry.LoadFromFile")
+func LoadFromFile(path string) error {
+	return registry.LoadFromFile(path)
+}
+
+// StartCheckpoint saves the state of the registry to the file (see "SaveToFile") every "interval". Errors are passed
+// to "onError" (if it's not nil).
+//
+// The returned function stops the checkpointing and saves the state for the last time (it's supposed to be called
+// on a shutdown after "Close").
+func (r *Registry) StartCheckpoint(path string, interval time.Duration, onError func(error)) (stop func() error) {
+	ticker := newAckedTicker(r.GetClock(), interval)
+	acker, _ := ticker.(tickAcker)
+	stopChan := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C():
+			}
+			if err := r.SaveToFile(path); err != nil && onError != nil {
+				onError(err)
+			}
+			if acker != nil {
+				acker.ack()
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() (err error) {
+		stopOnce.Do(func() {
+			ticker.Stop()
+			close(stopChan)
+			wg.Wait()
+			err = r.SaveToFile(path)
+		})
+		return
+	}
+}
+
+// StartCheckpoint saves the state of the default registry to the file every "interval"
+// (see "Registry.StartCheckpoint")
+func StartCheckpoint(path string, interval time.Duration, onError func(error)) (stop func() error) {
+	return registry.StartCheckpoint(path, interval, onError)
+}
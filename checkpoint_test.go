@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveToLoadFrom(t *testing.T) {
+	savedAt := time.Unix(1000000, 0)
+	r, clock := NewManualRegistry(savedAt.Add(-2 * time.Minute))
+	defer r.Reset()
+
+	periods := WithPeriods(5*time.Second, time.Minute, time.Hour)
+	metric := r.GaugeAggregativeBuffered(`latency`, Tags{`handler`: `index`}, periods)
+	sliding := r.GaugeAggregativeSimple(`sliding`, nil, periods, WithSlidingWindow(6))
+	r.Count(`requests`, nil).Add(42)
+	r.GaugeFloat64(`temperature`, nil).Set(3.5)
+	r.GaugeInt64Func(`func`, nil, func() int64 { return 1 })
+	for i := 0; i < 120; i++ {
+		metric.ConsiderValue(float64(i))
+		sliding.ConsiderValue(float64(i))
+		clock.Advance(time.Second)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, r.SaveTo(&buf))
+	state := buf.Bytes()
+
+	// restarted 30 seconds later
+	restored, _ := NewManualRegistry(savedAt.Add(30 * time.Second))
+	defer restored.Reset()
+	restoredMetric := restored.GaugeAggregativeBuffered(`latency`, Tags{`handler`: `index`}, periods)
+	restoredSliding := restored.GaugeAggregativeSimple(`sliding`, nil, periods, WithSlidingWindow(6))
+	restored.Count(`requests`, nil).Add(1)
+	assert.NoError(t, restored.LoadFrom(bytes.NewReader(state)))
+
+	assert.Equal(t, int64(43), restored.Count(`requests`, nil).Get())
+	assert.Equal(t, 3.5, restored.GaugeFloat64(`temperature`, nil).Get())
+	assert.Nil(t, restored.Get(TypeGaugeInt64Func, `func`, nil))
+
+	// the histories continue from the saved state
+	clock.Advance(30 * time.Second)
+	values := restoredMetric.GetValuePointers()
+	assert.Equal(t, uint64(120), values.Total().Count.Get())
+	assert.Equal(t, float64(59.5), values.Total().Avg.Get())
+	metric.EachAggregativeValue(func(label string, value *AggregativeValue) bool {
+		restoredMetric.EachAggregativeValue(func(restoredLabel string, restoredValue *AggregativeValue) bool {
+			if label == restoredLabel && label != `last` {
+				assert.InDelta(t, value.Count.Get(), restoredValue.Count.Get(), 10, label)
+			}
+			return true
+		})
+		return true
+	})
+	assert.InDelta(t, 104.5, *values.ByPeriod(2).GetPercentile(0.5), 5)
+	assert.Equal(t, uint64(120), restoredSliding.GetValuePointers().ByPeriod(3).Count.Get())
+
+	// missing metrics are created with the default options
+	other, _ := NewManualRegistry(savedAt)
+	defer other.Reset()
+	assert.NoError(t, other.LoadFrom(bytes.NewReader(state)))
+	otherMetric := other.GaugeAggregativeBuffered(`latency`, Tags{`handler`: `index`})
+	assert.Equal(t, uint64(120), otherMetric.GetValuePointers().Total().Count.Get())
+	assert.Equal(t, GetAggregationPeriods(), otherMetric.GetAggregationPeriods())
+
+	// stale entries are skipped
+	stale, _ := NewManualRegistry(savedAt.Add(2 * time.Hour))
+	defer stale.Reset()
+	staleMetric := stale.GaugeAggregativeBuffered(`latency`, Tags{`handler`: `index`}, periods)
+	assert.NoError(t, stale.LoadFrom(bytes.NewReader(state)))
+	assert.Equal(t, uint64(0), staleMetric.GetValuePointers().Total().Count.Get())
+
+	// corrupted data
+	assert.True(t, errors.Is(restored.LoadFrom(bytes.NewReader(state[:len(state)-1])), ErrInvalidBinaryData))
+	assert.True(t, errors.Is(restored.LoadFrom(bytes.NewReader([]byte{registryStateVersion + 1})), ErrUnsupportedFormatVersion))
+}
+
+func TestStartCheckpoint(t *testing.T) {
+	r, clock := NewManualRegistry(time.Unix(1000000, 0))
+	defer r.Reset()
+	path := filepath.Join(t.TempDir(), `metrics.state`)
+
+	assert.NoError(t, r.LoadFromFile(path))
+
+	var errs []error
+	stop := r.StartCheckpoint(path, time.Minute, func(err error) { errs = append(errs, err) })
+	r.Count(`requests`, nil).Add(5)
+	clock.Advance(time.Minute)
+	_, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	r.Count(`requests`, nil).Add(5)
+	assert.NoError(t, stop())
+	assert.NoError(t, stop())
+	assert.Empty(t, errs)
+
+	restored, _ := NewManualRegistry(time.Unix(1000060, 0))
+	defer restored.Reset()
+	assert.NoError(t, restored.LoadFromFile(path))
+	assert.Equal(t, int64(10), restored.Count(`requests`, nil).Get())
+
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(path), `*`))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
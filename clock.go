@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Clock is a source of time for a registry: it's used for slicing, iterations (sending and GC) and snapshots.
+//
+// The default clock is the wall clock. A ManualClock could be used to control time in tests (see "SetClock").
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTicker returns a new Ticker which ticks every "d"
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is an analog of "time.Ticker" for a Clock
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered
+	C() <-chan time.Time
+
+	// Stop turns off the ticker
+	Stop()
+}
+
+// tickAcker is implemented by tickers which require a confirmation that a tick is processed (see "ManualClock")
+type tickAcker interface {
+	ack()
+}
+
+type realClock struct{}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+// RealClock is the wall clock (the default clock of registries)
+var RealClock Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (ticker realTicker) C() <-chan time.Time {
+	return ticker.Ticker.C
+}
+
+// ManualClock is a Clock which time is changed only by methods "Advance" and "Set". It allows to trigger slicing
+// and iterations deterministically (without sleeping) in tests.
+type ManualClock struct {
+	locker  sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+
+	// advanceLocker prevents concurrent advancing of the time
+	advanceLocker sync.Mutex
+}
+
+// NewManualClock returns a new ManualClock with time "now"
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now: now,
+	}
+}
+
+// NewManualRegistry returns a new registry with a ManualClock of time "now" (see "SetClock"), synchronous
+// ConsiderValue (see "SetDefaultConsiderValueSync") and disabled GC (see "SetDefaultGCEnabled"). Everything is
+// deterministic in such registry, so it's useful for unit tests (of code which uses metrics, too).
+func NewManualRegistry(now time.Time) (*Registry, *ManualClock) {
+	clock := NewManualClock(now)
+	r := New()
+	r.SetClock(clock)
+	r.SetDefaultConsiderValueSync(true)
+	r.SetDefaultGCEnabled(false)
+	return r, clock
+}
+
+// Now returns the current time of the clock
+func (clock *ManualClock) Now() time.Time {
+	clock.locker.Lock()
+	defer clock.locker.Unlock()
+	return clock.now
+}
+
+// NewTicker returns a new Ticker which ticks every "d" of the clock time (see "Advance")
+func (clock *ManualClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic(`non-positive interval for NewTicker`)
+	}
+	clock.locker.Lock()
+	defer clock.locker.Unlock()
+	ticker := &manualTicker{
+		clock:    clock,
+		interval: d,
+		next:     clock.now.Add(d),
+		c:        make(chan time.Time, 1),
+		ackChan:  make(chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+	clock.tickers = append(clock.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the time forward by "d" and delivers all the ticks happened in the interval (in chronological
+// order).
+//
+// Ticks of tickers of registries (used for slicing, sending and GC) are delivered synchronously: Advance returns only
+// when all of them are processed. Ticks of other tickers are delivered like by "time.Ticker" (a tick is dropped if
+// the previous one is not received, yet).
+func (clock *ManualClock) Advance(d time.Duration) {
+	clock.Set(clock.Now().Add(d))
+}
+
+// Set sets the time of the clock. If the time moves forward then all the ticks happened in the interval are
+// delivered (see "Advance").
+func (clock *ManualClock) Set(newNow time.Time) {
+	clock.advanceLocker.Lock()
+	defer clock.advanceLocker.Unlock()
+
+	for {
+		clock.locker.Lock()
+		var ticker *manualTicker
+		for _, curTicker := range clock.tickers {
+			if curTicker.next.After(newNow) {
+				continue
+			}
+			if ticker == nil || curTicker.next.Before(ticker.next) {
+				ticker = curTicker
+			}
+		}
+		if ticker == nil {
+			if newNow.After(clock.now) {
+				clock.now = newNow
+			}
+			clock.locker.Unlock()
+			return
+		}
+		tickTime := ticker.next
+		clock.now = tickTime
+		ticker.next = tickTime.Add(ticker.interval)
+		clock.locker.Unlock()
+
+		ticker.deliver(tickTime)
+	}
+}
+
+func (clock *ManualClock) removeTicker(ticker *manualTicker) {
+	clock.locker.Lock()
+	defer clock.locker.Unlock()
+	for idx, curTicker := range clock.tickers {
+		if curTicker != ticker {
+			continue
+		}
+		clock.tickers = append(clock.tickers[:idx], clock.tickers[idx+1:]...)
+		return
+	}
+}
+
+type manualTicker struct {
+	clock    *ManualClock
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+
+	// isAcked is set if the receiver confirms processing of ticks (see "tickAcker")
+	isAcked  uint32
+	ackChan  chan struct{}
+	stopOnce sync.Once
+	stopChan chan struct{}
+}
+
+func (ticker *manualTicker) C() <-chan time.Time {
+	return ticker.c
+}
+
+func (ticker *manualTicker) Stop() {
+	ticker.stopOnce.Do(func() {
+		close(ticker.stopChan)
+		ticker.clock.removeTicker(ticker)
+	})
+}
+
+// enableAck makes "Advance" to wait for a confirmation (see "ack") of every tick of the ticker
+func (ticker *manualTicker) enableAck() {
+	atomic.StoreUint32(&ticker.isAcked, 1)
+}
+
+func (ticker *manualTicker) ack() {
+	if atomic.LoadUint32(&ticker.isAcked) == 0 {
+		return
+	}
+	select {
+	case ticker.ackChan <- struct{}{}:
+	case <-ticker.stopChan:
+	}
+}
+
+func (ticker *manualTicker) deliver(tickTime time.Time) {
+	if atomic.LoadUint32(&ticker.isAcked) == 0 {
+		select {
+		case ticker.c <- tickTime:
+		default:
+		}
+		return
+	}
+
+	select {
+	case ticker.c <- tickTime:
+	case <-ticker.stopChan:
+		return
+	}
+	select {
+	case <-ticker.ackChan:
+	case <-ticker.stopChan:
+	}
+}
+
+// newAckedTicker returns a ticker of the clock which requires confirmations of processed ticks (if supported)
+func newAckedTicker(clock Clock, d time.Duration) Ticker {
+	ticker := clock.NewTicker(d)
+	if acked, ok := ticker.(interface{ enableAck() }); ok {
+		acked.enableAck()
+	}
+	return ticker
+}
+
+// SetClock sets the clock to be used by the registry (see "Clock").
+//
+// It affects only new metrics, so it should be called before creating metrics.
+func (r *Registry) SetClock(clock Clock) {
+	if clock == nil {
+		clock = RealClock
+	}
+
+	// iterationHandlers of a non-real clock belong to the registry (the wall clock ones are shared by all
+	// registries), so they are released together with the registry
+	var clockIterationHandlers *iterationHandlersT
+	if clock != RealClock {
+		clockIterationHandlers = newIterationHandlers(clock)
+	}
+	atomic.StorePointer((*unsafe.Pointer)((unsafe.Pointer)(&r.clock)), (unsafe.Pointer)(&clock))
+	oldIterationHandlers := (*iterationHandlersT)(atomic.SwapPointer(
+		(*unsafe.Pointer)((unsafe.Pointer)(&r.clockIterationHandlers)),
+		(unsafe.Pointer)(clockIterationHandlers),
+	))
+	if oldIterationHandlers != nil {
+		// goroutines of the previous clock are not required anymore (except ones still used by existing metrics)
+		_ = oldIterationHandlers.stopIdle(context.Background())
+	}
+}
+
+// GetClock returns the clock used by the registry (see "SetClock")
+func (r *Registry) GetClock() Clock {
+	clock := (*Clock)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&r.clock))))
+	if clock == nil {
+		return RealClock
+	}
+	return *clock
+}
+
+// Now returns the current time of the clock of the registry
+func (r *Registry) Now() time.Time {
+	return r.GetClock().Now()
+}
+
+// iterationHandlers returns the collection of iterationHandlers to be used for metrics of the registry
+// (see "Iterators" in README.md)
+func (r *Registry) iterationHandlers() *iterationHandlersT {
+	result := (*iterationHandlersT)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&r.clockIterationHandlers))))
+	if result == nil {
+		return &iterationHandlers
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-ticker.C():
+		t.Fatal(`unexpected tick`)
+	default:
+	}
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, time.Unix(0, 0).Add(2500*time.Millisecond), clock.Now())
+	assert.Equal(t, time.Unix(1, 0), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal(`the second tick should be dropped, because the first one wasn't received`)
+	default:
+	}
+}
+
+func TestRegistryManualClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	r := New()
+	r.SetClock(clock)
+	defer r.Reset()
+	sender := &testSender{}
+	r.SetSender(sender)
+
+	metric := r.TimingFlow(`latency`, nil)
+	count := r.Count(`requests`, nil)
+	for i := 0; i < 60; i++ {
+		metric.ConsiderValue(time.Duration(i) * time.Millisecond)
+		clock.Advance(time.Second)
+	}
+	assert.Equal(t, `1m`, metric.aggregationPeriodLabel(2))
+	assert.Equal(t, uint64(60), metric.GetValuePointers().ByPeriod(2).Count.Get())
+	assert.Equal(t, float64(59*time.Millisecond), metric.GetValuePointers().ByPeriod(2).Max.Get())
+	assert.Equal(t, time.Unix(60, 0), r.TakeSnapshot().Time)
+
+	// the sender is called once per iteration interval
+	var sent int
+	for _, record := range sender.records {
+		if record.key == `requests` {
+			sent++
+		}
+	}
+	assert.Equal(t, 1, sent)
+
+	// unchanged metrics are stopped by GC after "gcUselessLimit" iterations
+	assert.True(t, count.IsRunning())
+	clock.Advance(gcUselessLimit * time.Minute)
+	// the metric is stopped asynchronously, to not block the iteration by OnStop hooks
+	assert.Eventually(t, func() bool {
+		return !count.IsRunning()
+	}, time.Second, time.Millisecond)
+}
+
+func TestRegistrySetClockReleasesIterationHandlers(t *testing.T) {
+	r := New()
+	r.SetClock(NewManualClock(time.Unix(0, 0)))
+	oldIterationHandlers := r.iterationHandlers()
+	r.Count(`requests`, nil).Increment()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&oldIterationHandlers.routinesCount))
+
+	r.Reset()
+	r.SetClock(NewManualClock(time.Unix(0, 0)))
+	assert.True(t, oldIterationHandlers != r.iterationHandlers())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&oldIterationHandlers.routinesCount) == 0
+	}, time.Second, time.Millisecond)
+
+	r.SetClock(nil)
+	assert.True(t, &iterationHandlers == r.iterationHandlers())
+}
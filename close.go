@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// IsClosed returns true if the registry is closed (see "Close")
+func (r *Registry) IsClosed() bool {
+	return atomic.LoadUint32(&r.isClosed) != 0
+}
+
+// Close gracefully shuts down the registry:
+//   - it stops accepting new values and new metrics;
+//   - drains pending values of aggregative metrics (they are processed asynchronously in batches);
+//   - performs the last slice of aggregative metrics (see "Slicing" in README.md);
+//   - sends values of all metrics through the sender (see "SetSender");
+//   - stops all metrics and idle iteration goroutines.
+//
+// It returns when everything is done or when the context is done (in this case it returns the context error).
+// Close should be called only once; it returns ErrRegistryClosed on the next calls.
+func (r *Registry) Close(ctx context.Context) error {
+	if !atomic.CompareAndSwapUint32(&r.isClosed, 0, 1) {
+		return ErrRegistryClosed
+	}
+
+	if err := flushConsiderValueQueue(ctx); err != nil {
+		return err
+	}
+
+	list := r.List()
+	defer list.Release()
+
+	// stopping metrics first to prevent concurrent slicing and sending by iteration handlers
+	for _, metric := range *list {
+		metric.Stop()
+	}
+
+	for _, metric := range *list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if slicer, ok := metric.(interface{ DoSlice() }); ok {
+			slicer.DoSlice()
+		}
+	}
+
+	sender := r.GetSender()
+	if sender != nil {
+		for _, metric := range *list {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			metric.Send(sender)
+		}
+	}
+
+	return r.iterationHandlers().stopIdle(ctx)
+}
+
+// Close gracefully shuts down the default registry (see "Registry.Close")
+func Close(ctx context.Context) error {
+	return registry.Close(ctx)
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClose(t *testing.T) {
+	r := New()
+	sender := &testSender{}
+	r.SetSender(sender)
+
+	count := r.Count(`requests`, nil)
+	timing := r.TimingFlow(`latency`, nil)
+	count.Add(2)
+	timing.ConsiderValue(time.Millisecond)
+	timing.ConsiderValue(3 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, r.Close(ctx))
+	assert.Equal(t, ErrRegistryClosed, r.Close(ctx))
+
+	values := map[string]float64{}
+	for _, record := range sender.records {
+		values[record.key] = record.value
+	}
+	assert.Equal(t, float64(2), values[`requests`])
+	assert.Equal(t, float64(2), values[`latency@timing_flow_1s_count`])
+	assert.Equal(t, float64(2*time.Millisecond), values[`latency@timing_flow_1s_avg`])
+
+	assert.False(t, count.IsRunning())
+	assert.False(t, timing.IsRunning())
+
+	// values are not accepted anymore
+	timing.ConsiderValue(time.Second)
+	assert.NoError(t, flushConsiderValueQueue(ctx))
+	assert.Equal(t, uint64(0), timing.data.current.Count.Get())
+	assert.False(t, r.Count(`new_requests`, nil).IsRunning())
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync/atomic"
 	"time"
@@ -14,7 +15,11 @@ type Sender interface {
 	// SendInt64 is used to send signed integer values
 	SendInt64(metric Metric, key string, value int64) error
 
-	// SendUint64 is used to send unsigned integer values
+	// SendUint64 is used to send unsigned integer values.
+	//
+	// Values of "MetricCount" and "MetricGaugeInt64" are passed to it, too (as "uint64(value)", for historical
+	// reasons), so a sender which supports negative values of these metrics should convert them back with
+	// "int64(value)".
 	SendUint64(metric Metric, key string, value uint64) error
 
 	// SendFloat64 is used to send float values
@@ -39,6 +44,9 @@ type common struct {
 	isGCEnabled    uint64
 	uselessCounter uint64
 
+	// iterationHandlers is the collection of iterationHandlers the metric is added to (see "Iterators" in README.md)
+	iterationHandlers *iterationHandlersT
+
 	// parent is a pointer to the object of the final implementation of a metric (for example *GaugeFloat64)
 	parent Metric
 
@@ -51,16 +59,18 @@ type common struct {
 
 func (m *common) init(r *Registry, parent Metric, key string, tags AnyTags, getWasUseless func() bool) {
 	m.parent = parent
-	m.SetGCEnabled(GetDefaultGCEnabled())
+	m.SetGCEnabled(r.GetDefaultGCEnabled())
 
 	err := r.Register(parent, key, tags)
-	if err != nil {
-		// TODO: process the error
-	}
 
 	m.getWasUseless = getWasUseless
 	m.registryItem.init(r, parent, key)
 
+	if errors.Is(err, ErrCreationVetoed) || errors.Is(err, ErrRegistryClosed) {
+		// The metric is not registered, so it shouldn't be run (it would be sent and never be collected by GC).
+		return
+	}
+
 	if r.GetDefaultIsRan() {
 		if m.running != 0 {
 			panic(m.running)
@@ -109,6 +119,7 @@ func (m *common) uselessCounterIncrement() {
 	if !m.IsRunning() {
 		return
 	}
+	// OnStop hooks (see "AddOnStopHook") should not block the iteration
 	go m.parent.Stop()
 }
 
@@ -155,7 +166,8 @@ func (m *common) run(interval time.Duration) {
 		return
 	}
 	m.interval = interval
-	iterationHandlers.Add(m)
+	m.iterationHandlers = m.registry.iterationHandlers()
+	m.iterationHandlers.Add(m)
 	atomic.StoreUint64(&m.uselessCounter, 0)
 	atomic.StoreUint64(&m.running, 1)
 	return
@@ -176,7 +188,7 @@ func (m *common) stop() {
 	if !m.IsRunning() {
 		return
 	}
-	iterationHandlers.Remove(m)
+	m.iterationHandlers.Remove(m)
 	m.interval = time.Duration(0)
 	atomic.StoreUint64(&m.running, 0)
 }
@@ -187,26 +199,52 @@ func (m *common) Stop() {
 		return
 	}
 	m.lock()
-	defer m.unlock()
+	wasRunning := m.IsRunning()
 	m.stop()
+	m.unlock()
+
+	if wasRunning {
+		m.registry.callOnStopHooks(m.parent)
+	}
 }
 
 // MarshalJSON returns JSON representation of a metric for external monitoring systems
 func (m *common) MarshalJSON() ([]byte, error) {
+	return m.marshalJSON(fmt.Sprint(m.GetFloat64())), nil
+}
+
+// marshalJSON returns JSON representation of a metric with the value "valueJSON"
+func (m *common) marshalJSON(valueJSON string) []byte {
 	nameJSON, _ := json.Marshal(m.name)
-	descriptionJSON, _ := json.Marshal(m.description)
 	tagsJSON, _ := json.Marshal(m.tags.String())
 	typeJSON, _ := json.Marshal(m.GetType().String())
-	value := m.GetFloat64()
 
-	metricJSON := fmt.Sprintf(`{"name":%s,"tags":%s,"value":%v,"description":%s,"type":%s}`,
+	var description string
+	var metadata map[string]string
+	info := m.GetMetricInfo()
+	if info != nil {
+		description = info.Description
+		metadata = info.Metadata
+	}
+	descriptionJSON, _ := json.Marshal(description)
+	unitJSON, _ := json.Marshal(m.GetUnit())
+
+	var metadataJSON []byte
+	if len(metadata) != 0 {
+		metadataJSON, _ = json.Marshal(metadata)
+		metadataJSON = append([]byte(`,"metadata":`), metadataJSON...)
+	}
+
+	metricJSON := fmt.Sprintf(`{"name":%s,"tags":%s,"value":%s,"description":%s,"unit":%s%s,"type":%s}`,
 		string(nameJSON),
 		string(tagsJSON),
-		value,
+		valueJSON,
 		string(descriptionJSON),
+		string(unitJSON),
+		string(metadataJSON),
 		string(typeJSON),
 	)
-	return []byte(metricJSON), nil
+	return []byte(metricJSON)
 }
 
 // GetCommons returns the *common of a metric (it supposed to be used for internal routines only).
@@ -1,8 +1,8 @@
 package metrics
 
 import (
-	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -49,18 +49,22 @@ type AggregativeStatistics interface {
 }
 
 // SetSlicerInterval affects only new metrics (it doesn't affect already created one). You may use function `Reset()`
-// to "update" configuration of all metrics.
+// to "update" configuration of all metrics. To configure a specific metric use option "WithSlicerInterval".
 func SetSlicerInterval(newSlicerInterval time.Duration) {
 	slicerInterval = newSlicerInterval
 }
 
 // SetAggregationPeriods affects only new metrics (it doesn't affect already created on). You may use function
-// `Reset()` to "update" configuration of all metrics.
+// `Reset()` to "update" configuration of all metrics. To configure a specific metric use option "WithPeriods".
 //
-// Every higher aggregation period should be a multiple of the lower one.
+// Every higher aggregation period should be a multiple of the lower one (see "ValidateAggregationPeriods").
+// It panics if the periods are invalid (like constructors of metrics with invalid options do).
 func SetAggregationPeriods(newAggregationPeriods []AggregationPeriod) {
+	if err := ValidateAggregationPeriods(newAggregationPeriods); err != nil {
+		panic(err)
+	}
 	aggregationPeriods.Lock()
-	aggregationPeriods.s = newAggregationPeriods
+	aggregationPeriods.s = append([]AggregationPeriod{}, newAggregationPeriods...)
 	aggregationPeriods.Unlock()
 }
 
@@ -74,6 +78,12 @@ type AggregationPeriod struct {
 // It will return in a short format (like "5s", "1h") if the amount of seconds could be represented as exact value of
 // days, hours or minutes, or if the amount of seconds is less than 60. Otherwise the format will be like `1h5m0s`.
 func (period *AggregationPeriod) String() string {
+	return period.format(slicerInterval)
+}
+
+// format returns a string representation of the aggregation period for the slicer interval "slicerInterval"
+// (see "String").
+func (period *AggregationPeriod) format(slicerInterval time.Duration) string {
 	interval := time.Duration(period.Interval) * slicerInterval
 	seconds := uint64(interval / time.Second)
 	if seconds < 60 {
@@ -135,6 +145,10 @@ type AggregativeValue struct {
 	Max   AtomicFloat64
 	Sum   AtomicFloat64
 
+	// M2 is the sum of squared differences from the average (see Welford's algorithm), it's used to calculate
+	// the variance (see "GetVariance")
+	M2 AtomicFloat64
+
 	AggregativeStatistics
 }
 
@@ -157,6 +171,7 @@ func (aggrV *AggregativeValue) set(v float64) {
 	aggrV.Avg.Set(v)
 	aggrV.Max.Set(v)
 	aggrV.Sum.Set(v)
+	aggrV.M2.Set(0)
 	if aggrV.AggregativeStatistics != nil {
 		aggrV.AggregativeStatistics.Set(v)
 	}
@@ -186,6 +201,27 @@ func (aggrV *AggregativeValue) GetAvg() float64 {
 	return aggrV.Avg.Get()
 }
 
+// GetVariance returns the (population) variance of considered values
+func (aggrV *AggregativeValue) GetVariance() float64 {
+	if aggrV == nil {
+		return 0
+	}
+	count := aggrV.Count.Get()
+	if count == 0 {
+		return 0
+	}
+	variance := aggrV.M2.Get() / float64(count)
+	if variance < 0 { // could happen due to rounding errors
+		return 0
+	}
+	return variance
+}
+
+// GetStdDev returns the (population) standard deviation of considered values
+func (aggrV *AggregativeValue) GetStdDev() float64 {
+	return math.Sqrt(aggrV.GetVariance())
+}
+
 // AggregativeValues is a full collection of "AggregativeValue"-s (see "Slicing" in README.md)
 type AggregativeValues struct {
 	last     *AggregativeValue
@@ -218,6 +254,8 @@ type commonAggregativeSlicer struct {
 	interval time.Duration
 }
 
+// Iterate slices the metric. The queue of values is flushed before by the iteration handler (once for all slicers
+// of the handler, see "flushBeforeSlicing").
 func (slicer *commonAggregativeSlicer) Iterate() {
 	defer recoverPanic()
 	slicer.metric.DoSlice()
@@ -247,55 +285,93 @@ type commonAggregative struct {
 	tick               uint64
 	slicer             iterator
 
+	// queueShardHash defines which ConsiderValue queue shard is used for the metric (see "SetConsiderValueWorkers")
+	queueShardHash uint32
+
+	// considerValueSync defines if values should be applied synchronously (see "SetConsiderValueSync")
+	considerValueSync uint32
+
+	// percentiles are the percentiles set by option "WithPercentiles" (nil if the default ones should be used)
+	percentiles []float64
+
+	// decayHalfLife is the half-life of values of the decaying reservoir (see "WithDecayingReservoir"),
+	// zero means the uniform reservoir
+	decayHalfLife time.Duration
+	decayLandmark time.Time
+
+	// bufferSize is the size of the buffer of "Buffered" metrics (see "WithBufferSize")
+	bufferSize uint
+
+	// slidingWindowBuckets is the amount of buckets per aggregation period in the sliding window mode
+	// (see "WithSlidingWindow"); zero means the default mode
+	slidingWindowBuckets uint64
+
 	histories histories
 }
 
+// setQueueShardHash is called by the registry when the key of the metric is generated (see "Register")
+func (m *commonAggregative) setQueueShardHash(hash uint32) {
+	m.queueShardHash = hash
+}
+
 // newAggregativeStatistics returns an AggregativeStatistics (as a memory-reuse-aware constructor)
 func (m *commonAggregative) newAggregativeStatistics() AggregativeStatistics {
 	return m.parent.(interface{ NewAggregativeStatistics() AggregativeStatistics }).NewAggregativeStatistics()
 }
 
+// getPercentiles returns the percentiles of the metric (see "WithPercentiles")
+func (m *commonAggregative) getPercentiles() []float64 {
+	if m.percentiles != nil {
+		return m.percentiles
+	}
+	return m.registry.GetDefaultPercentiles()
+}
+
+// getBufferSize returns the size of the buffer of the metric (see "WithBufferSize")
+func (m *commonAggregative) getBufferSize() uint {
+	return m.bufferSize
+}
+
 func (m *commonAggregative) NewAggregativeValue() *AggregativeValue {
 	v := newAggregativeValue()
 	v.AggregativeStatistics = m.newAggregativeStatistics()
 	return v
 }
 
-func (m *commonAggregative) init(r *Registry, parent Metric, key string, tags AnyTags) {
+func (m *commonAggregative) init(r *Registry, parent Metric, key string, tags AnyTags, opts ...AggregativeOption) {
 	m.parent = parent
 	m.common.registry = r
+	m.SetConsiderValueSync(r.GetDefaultConsiderValueSync())
+
+	cfg := newAggregativeConfig(opts)
+	aggregationPeriods, err := cfg.getAggregationPeriods()
+	if err != nil {
+		panic(err)
+	}
+	m.percentiles, err = cfg.getPercentiles()
+	if err != nil {
+		panic(err)
+	}
+	m.decayHalfLife = cfg.decayHalfLife
+	m.decayLandmark = r.Now()
+	m.bufferSize = cfg.bufferSize
+	if m.bufferSize == 0 {
+		m.bufferSize = r.GetDefaultBufferSize()
+	}
 
 	// See "Slicing" in README.md
 
 	m.slicer = &commonAggregativeSlicer{
 		metric:   m,
-		interval: slicerInterval,
+		interval: cfg.slicerInterval,
 	}
-	m.aggregationPeriods = GetAggregationPeriods()
+	m.aggregationPeriods = aggregationPeriods
+	m.slidingWindowBuckets = uint64(cfg.slidingWindowBuckets)
 	m.data.last = m.NewAggregativeValue()
 	m.data.current = m.NewAggregativeValue()
 	m.data.total = m.NewAggregativeValue()
 
-	m.histories.ByPeriod = make([]*history, 0, len(m.aggregationPeriods))
-	previousPeriod := AggregationPeriod{1}
-	for _, period := range m.aggregationPeriods {
-		hist := &history{}
-		if period.Interval%previousPeriod.Interval != 0 {
-			// We support only an aggregation period that divides to the previous aggregation period
-			// For example we support: 1s, 5s, 1m; but we doesn't support: 1s, 5s, 13s.
-			//
-			// It's caused by our algorithm of calculating statistics of higher aggregation periods using
-			// history of statistics of lower aggregation periods. So a higher aggregation period statistics
-			// is calculated from multiple lower aggregation period statistics
-
-			// TODO: print error
-			//panic(fmt.Errorf("period.Interval (%v) %% previousPeriod.Interval (%v) != 0 (%v)", period.Interval, previousPeriod.Interval, period.Interval%previousPeriod.Interval))
-		}
-		hist.storage = make([]*AggregativeValue, period.Interval/previousPeriod.Interval)
-
-		m.histories.ByPeriod = append(m.histories.ByPeriod, hist)
-		previousPeriod = period
-	}
+	m.histories.ByPeriod = m.newHistories(m.aggregationPeriods)
 
 	// Allocate everything:
 
@@ -308,23 +384,58 @@ func (m *commonAggregative) init(r *Registry, parent Metric, key string, tags An
 	}
 
 	// Init the underlying structure
-	m.common.init(r, parent, key, tags, func() bool { return m.data.byPeriod[0].Count.Get() == 0 })
+	m.common.init(r, parent, key, tags, func() bool {
+		m.dataLocker.Lock()
+		defer m.dataLocker.Unlock()
+		return m.data.ByPeriod(0).Count.Get() == 0
+	})
 }
 
 // GetAggregationPeriods returns aggregation periods of the metric (see "Slicing" in README.md)
 func (m *commonAggregative) GetAggregationPeriods() (r []AggregationPeriod) {
 	m.lock()
 	r = make([]AggregationPeriod, len(m.aggregationPeriods))
-	copy(r, aggregationPeriods.s)
+	copy(r, m.aggregationPeriods)
 	m.unlock()
 	return
 }
 
 // considerValue is an analog of method `Observe` of prometheus' metrics.
 func (m *commonAggregative) considerValue(v float64) {
+	if m == nil || m.registry.IsClosed() {
+		return
+	}
+	if atomic.LoadUint32(&m.considerValueSync) != 0 {
+		m.doConsiderValue(v)
+		return
+	}
 	enqueueConsiderValue(m, v)
 }
 
+// SetConsiderValueSync sets if values should be applied synchronously (right in "ConsiderValue") instead of
+// passing them to the asynchronous queue (see "Flushing" in README.md).
+//
+// It's useful for metrics with a few values per minute and for tests: values are visible immediately. But it's not
+// recommended for high loaded metrics, because concurrent calls of "ConsiderValue" will compete for locks.
+func (m *commonAggregative) SetConsiderValueSync(isSync bool) {
+	if m == nil {
+		return
+	}
+	if isSync {
+		atomic.StoreUint32(&m.considerValueSync, 1)
+	} else {
+		atomic.StoreUint32(&m.considerValueSync, 0)
+	}
+}
+
+// IsConsiderValueSync returns if values are applied synchronously (see "SetConsiderValueSync")
+func (m *commonAggregative) IsConsiderValueSync() bool {
+	if m == nil {
+		return false
+	}
+	return atomic.LoadUint32(&m.considerValueSync) != 0
+}
+
 func (m *commonAggregative) doConsiderValue(v float64) {
 	if m == nil {
 		return
@@ -345,7 +456,10 @@ func (m *commonAggregative) doConsiderValue(v float64) {
 			data.Max.Set(v)
 		}
 
-		data.Avg.Set((data.Avg.Get()*float64(count-1) + v) / float64(count))
+		oldAvg := data.Avg.Get()
+		newAvg := (oldAvg*float64(count-1) + v) / float64(count)
+		data.Avg.Set(newAvg)
+		data.M2.Add((v - oldAvg) * (v - newAvg))
 		if data.AggregativeStatistics != nil {
 			data.AggregativeStatistics.ConsiderValue(v)
 		}
@@ -368,14 +482,20 @@ func (w *commonAggregative) GetValuePointers() *AggregativeValues {
 // String returns a JSON string representing values (min, max, count, ...) of an aggregative value
 func (v *AggregativeValue) String() string {
 	var result strings.Builder
-	result.WriteString(fmt.Sprintf(`{"count":%d,"min":%g,"avg":%g,"max":%g,"sum":%g`,
+	result.WriteString(fmt.Sprintf(`{"count":%d,"min":%g,"avg":%g,"max":%g,"sum":%g,"variance":%g,"stddev":%g`,
 		v.Count.Get(),
 		v.Min.Get(),
 		v.Avg.Get(),
 		v.Max.Get(),
 		v.Sum.Get(),
+		v.GetVariance(),
+		v.GetStdDev(),
 	))
 
+	if v.AggregativeStatistics == nil {
+		result.WriteRune('}')
+		return result.String()
+	}
 	percentiles, values := v.AggregativeStatistics.GetDefaultPercentiles()
 	for idx, p := range percentiles {
 		v := values[idx]
@@ -400,29 +520,14 @@ func (metric *commonAggregative) MarshalJSON() ([]byte, error) {
 		))
 	}
 
-	values := metric.data
-
-	considerValue(`last`, values.Last())
-	for idx := range metric.data.byPeriod {
-		considerValue(metric.aggregationPeriods[idx].String(), metric.data.ByPeriod(idx))
-	}
-	considerValue(`total`, values.Total())
-
-	nameJSON, _ := json.Marshal(metric.name)
-	descriptionJSON, _ := json.Marshal(metric.description)
-	tagsJSON, _ := json.Marshal(metric.tags.String())
-	typeJSON, _ := json.Marshal(metric.GetType().String())
+	metric.EachAggregativeValue(func(label string, data *AggregativeValue) bool {
+		considerValue(label, data)
+		return true
+	})
 
 	valueJSON := `{` + strings.Join(jsonValues, `,`) + `}`
 
-	metricJSON := fmt.Sprintf(`{"name":%s,"tags":%s,"value":%s,"description":%s,"type":%s}`,
-		string(nameJSON),
-		tagsJSON,
-		valueJSON,
-		string(descriptionJSON),
-		string(typeJSON),
-	)
-	return []byte(metricJSON), nil
+	return metric.marshalJSON(valueJSON), nil
 }
 
 // Send is a function to send the metric values through a Sender (see "Sender" in common.go)
@@ -439,24 +544,74 @@ func (m *commonAggregative) Send(sender Sender) {
 		_ = sender.SendFloat64(m.parent, baseKey+`avg`, data.Avg.Get())
 		_ = sender.SendFloat64(m.parent, baseKey+`max`, data.Max.Get())
 		_ = sender.SendFloat64(m.parent, baseKey+`sum`, data.Sum.Get())
+		_ = sender.SendFloat64(m.parent, baseKey+`stddev`, data.GetStdDev())
 		if data.AggregativeStatistics == nil {
 			return
 		}
-		percentiles := data.AggregativeStatistics.GetPercentiles([]float64{0.01, 0.1, 0.5, 0.9, 0.99})
-		_ = sender.SendFloat64(m.parent, baseKey+`per1`, *percentiles[0])
-		_ = sender.SendFloat64(m.parent, baseKey+`per10`, *percentiles[1])
-		_ = sender.SendFloat64(m.parent, baseKey+`per50`, *percentiles[2])
-		_ = sender.SendFloat64(m.parent, baseKey+`per90`, *percentiles[3])
-		_ = sender.SendFloat64(m.parent, baseKey+`per99`, *percentiles[4])
+		percentiles, values := data.AggregativeStatistics.GetDefaultPercentiles()
+		for idx, percentile := range percentiles {
+			if idx >= len(values) || math.IsNaN(values[idx]) {
+				continue
+			}
+			_ = sender.SendFloat64(m.parent, baseKey+percentileKeySuffix(percentile), values[idx])
+		}
 	}
 
-	values := m.data
+	m.EachAggregativeValue(func(label string, data *AggregativeValue) bool {
+		considerValue(label, data)
+		return true
+	})
+}
+
+// percentileKeySuffix returns the suffix of the key of a percentile value passed to a Sender (see "Send"): "per"
+// and the percentile in percents, for example "per99" for 0.99 and "per99.9" for 0.999.
+func percentileKeySuffix(percentile float64) string {
+	// rounding to avoid artifacts of the float multiplication (like 99.89999999999999)
+	return `per` + strconv.FormatFloat(math.Round(percentile*100*1e6)/1e6, 'f', -1, 64)
+}
 
-	considerValue(`last`, values.Last())
-	for idx, values := range m.data.byPeriod {
-		considerValue(m.aggregationPeriods[idx].String(), values)
+// EachAggregativeValue calls function "fn" for every aggregative value of the metric: "last", every aggregation
+// period (see "Slicing" in README.md) and "total". The label of the value is passed as the first argument.
+//
+// The function may return false if it's required to finish the loop prematurely.
+func (m *commonAggregative) EachAggregativeValue(fn func(label string, value *AggregativeValue) bool) {
+	if !fn(`last`, m.data.Last()) {
+		return
+	}
+
+	// the aggregation periods could be changed concurrently (see "ReconfigureAggregationPeriods"), so making a copy
+	m.dataLocker.Lock()
+	labels := make([]string, len(m.data.byPeriod))
+	values := make([]*AggregativeValue, len(m.data.byPeriod))
+	for idx := range m.data.byPeriod {
+		labels[idx] = m.aggregationPeriodLabel(idx)
+		values[idx] = m.data.ByPeriod(idx)
+	}
+	m.dataLocker.Unlock()
+
+	for idx, value := range values {
+		if !fn(labels[idx], value) {
+			return
+		}
+	}
+	fn(`total`, m.data.Total())
+}
+
+// aggregationPeriodLabel returns the label of the aggregative value "byPeriod[idx]".
+//
+// "byPeriod[0]" is the statistics of the base aggregation period (the slicer interval) and "byPeriod[idx]" is
+// the statistics of "aggregationPeriods[idx-1]".
+func (m *commonAggregative) aggregationPeriodLabel(idx int) string {
+	slicerInterval := m.GetSlicerInterval()
+	if idx == 0 {
+		return GetBaseAggregationPeriod().format(slicerInterval)
 	}
-	considerValue(`total`, values.Total())
+	return m.aggregationPeriods[idx-1].format(slicerInterval)
+}
+
+// GetSlicerInterval returns the slicer interval of the metric (see "Slicing" in README.md)
+func (m *commonAggregative) GetSlicerInterval() time.Duration {
+	return m.slicer.GetInterval()
 }
 
 // Run starts the metric. We did not check if it is safe to call this method from external code.
@@ -480,7 +635,7 @@ func (m *commonAggregative) run(interval time.Duration) {
 	m.common.run(interval)
 
 	// We need not only to send the data to somewhere, but also to aggregate statistics. Our aggregation quant of time is one second, so it's required to aggregate the statistics once per second. So we create an object that will do that on method Iterate() and pass it to the `iterators`.
-	iterationHandlers.Add(m.slicer)
+	m.iterationHandlers.Add(m.slicer)
 }
 
 // Stop is a function to stop the metric. It will be cleaned up by GC.
@@ -491,9 +646,13 @@ func (m *commonAggregative) Stop() {
 		return
 	}
 	m.lock()
-	defer m.unlock()
-
+	wasRunning := m.IsRunning()
 	m.stop()
+	m.unlock()
+
+	if wasRunning {
+		m.registry.callOnStopHooks(m.parent)
+	}
 }
 
 func (m *commonAggregative) stop() {
@@ -503,7 +662,7 @@ func (m *commonAggregative) stop() {
 
 	m.common.stop()
 
-	iterationHandlers.Remove(m.slicer)
+	m.iterationHandlers.Remove(m.slicer)
 }
 
 // history is a structure that stores previous aggregative values for an aggregation period
@@ -558,31 +717,42 @@ func (m *commonAggregative) calculateValue(h *history) (r *AggregativeValue) {
 }
 
 // MergeData merges/joins the statistics of the argument.
+//
+// Percentile-related statistics (see "AggregativeStatistics") are merged only if they are of the same kind
+// (for example "Flow" statistics cannot be merged into "Buffered" one).
+//
+// The fields are updated atomically, so the value could be read concurrently (but concurrent modifications should
+// be prevented by "Lock").
 func (r *AggregativeValue) MergeData(e *AggregativeValue) {
 	eSum := e.Sum.Get()
 	eMin := e.Min.Get()
 	eMax := e.Max.Get()
 	eCount := e.Count.Get()
-	if (eMin < r.Min.GetFast() || (r.Count == 0 && eCount != 0)) && eMin != 0 {
+	if (eMin < r.Min.Get() || (r.Count.Get() == 0 && eCount != 0)) && eMin != 0 {
 		// TODO: should work correctly without "e.Min != 0" but it doesn't: min value is always zero
-		r.Min.SetFast(eMin)
+		r.Min.Set(eMin)
 	}
-	if eMax > r.Max.GetFast() || (r.Count == 0 && eCount != 0) {
-		r.Max.SetFast(eMax)
+	if eMax > r.Max.Get() || (r.Count.Get() == 0 && eCount != 0) {
+		r.Max.Set(eMax)
 	}
-	r.Sum.AddFast(eSum)
+	r.Sum.Add(eSum)
 
 	addCount := eCount
 	addValue := e.Avg.Get()
-	oldCount := uint64(r.Count)
-	oldValue := r.Avg.GetFast()
+	oldCount := r.Count.Get()
+	oldValue := r.Avg.Get()
 	if oldCount+addCount == 0 {
-		r.Avg.SetFast(0)
+		r.Avg.Set(0)
 	} else {
-		r.Avg.SetFast((oldValue*float64(oldCount) + addValue*float64(addCount)) / float64(oldCount+addCount))
+		r.Avg.Set((oldValue*float64(oldCount) + addValue*float64(addCount)) / float64(oldCount+addCount))
+
+		// the parallel algorithm of Chan et al. for the variance
+		delta := addValue - oldValue
+		r.M2.Set(r.M2.Get() + e.M2.Get() +
+			delta*delta*float64(oldCount)*float64(addCount)/float64(oldCount+addCount))
 	}
-	r.Count += AtomicUint64(addCount)
-	if e.AggregativeStatistics != nil {
+	r.Count.Add(addCount)
+	if e.AggregativeStatistics != nil && r.AggregativeStatistics != nil {
 		r.AggregativeStatistics.MergeStatistics(e.AggregativeStatistics)
 	}
 }
@@ -597,6 +767,11 @@ func (m *commonAggregative) considerFilledValue(filledValue *AggregativeValue) {
 
 	tick := atomic.AddUint64(&m.tick, 1)
 
+	if m.IsSlidingWindow() {
+		m.considerFilledValueSliding(tick, filledValue)
+		return
+	}
+
 	updateLastHistoryRecord := func(h *history, newValue *AggregativeValue) {
 		if h.storage[h.currentOffset] != nil {
 			h.storage[h.currentOffset].Release()
@@ -631,9 +806,34 @@ func (m *commonAggregative) considerFilledValue(filledValue *AggregativeValue) {
 func (m *commonAggregative) DoSlice() {
 	nextValue := m.NewAggregativeValue()
 	filledValue := (*AggregativeValue)(atomic.SwapPointer((*unsafe.Pointer)((unsafe.Pointer)(&m.data.current)), (unsafe.Pointer)(nextValue)))
+	if parent, ok := m.parent.(AggregativeMetric); ok {
+		m.registry.callOnSliceHooks(parent, filledValue)
+	}
 	m.considerFilledValue(filledValue)
 }
 
+// MergeAggregativeValue merges pre-aggregated statistics (for example received from another process) to the metric
+// as if the values were considered by "ConsiderValue" since the last slicing. The "last" value is set
+// to the average of the statistics.
+//
+// The statistics of percentiles are merged only if they are of the same kind as ones of the metric
+// (see "MergeStatistics").
+func (m *commonAggregative) MergeAggregativeValue(value *AggregativeValue) {
+	if m == nil || value == nil || value.Count.Get() == 0 || m.registry.IsClosed() {
+		return
+	}
+
+	mergeData := func(data *AggregativeValue) {
+		data.Lock()
+		defer data.Unlock()
+		data.MergeData(value)
+	}
+
+	(*AggregativeValue)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&m.data.current)))).Do(mergeData)
+	(*AggregativeValue)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&m.data.total)))).Do(mergeData)
+	(*AggregativeValue)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&m.data.last)))).set(value.Avg.Get())
+}
+
 // GetFloat64 is required to be implemented by any metrics, so for aggregative metrics we use the last value.
 func (m *commonAggregative) GetFloat64() float64 {
 	return m.data.Last().GetAvg()
@@ -2,7 +2,6 @@ package metrics
 
 import (
 	"math"
-	"math/rand"
 	"sort"
 )
 
@@ -12,16 +11,25 @@ const (
 	defaultBufferSize = 1000
 )
 
-var (
-	// See "Buffered" in README.md
-	bufferSize = uint(defaultBufferSize)
-)
-
-// SetAggregativeBufferSize sets the size of the buffer to be used to store value samples
+// SetAggregativeBufferSize sets the size of the buffer to be used to store value samples by new "Buffered" metrics
+// of the default registry (see "Registry.SetDefaultBufferSize").
 // The more this values is the more precise is the percentile value, but more RAM & CPU is consumed.
 // (see "Buffered" in README.md)
 func SetAggregativeBufferSize(newBufferSize uint) {
-	bufferSize = newBufferSize
+	registry.SetDefaultBufferSize(newBufferSize)
+}
+
+// WithBufferSize sets the size of the buffer of a "Buffered" metric (see "Buffered" in README.md) instead of
+// the default one of the registry (see "SetDefaultBufferSize"). For example critical latency metrics could use
+// 10000 samples, while minor ones could use 100 samples to save memory.
+//
+// The size is fixed at the creation of the metric. Zero means the default size. Buffers larger than a million of
+// values could not be deserialized (see "Serialization" in README.md).
+// The option is ignored by "Simple" and "Flow" metrics.
+func WithBufferSize(size uint) AggregativeOption {
+	return func(cfg *aggregativeConfig) {
+		cfg.bufferSize = size
+	}
 }
 
 type aggregativeBufferItems []float64
@@ -60,13 +68,16 @@ type commonAggregativeBuffered struct {
 	commonAggregative
 }
 
-func (m *commonAggregativeBuffered) init(r *Registry, parent Metric, key string, tags AnyTags) {
-	m.commonAggregative.init(r, parent, key, tags)
+func (m *commonAggregativeBuffered) init(r *Registry, parent Metric, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregative.init(r, parent, key, tags, opts...)
 }
 
 // NewAggregativeStatistics returns a "Buffered" (see "Buffered" in README.md) implementation of AggregativeStatistics.
 func (m *commonAggregativeBuffered) NewAggregativeStatistics() AggregativeStatistics {
-	return newAggregativeStatisticsBuffered(m.registry.defaultPercentiles)
+	if m.decayHalfLife > 0 {
+		return newAggregativeStatisticsDecaying(m.getPercentiles(), m.getBufferSize(), m.registry.GetClock(), m.decayLandmark, m.decayHalfLife)
+	}
+	return newAggregativeStatisticsBuffered(m.getPercentiles(), m.getBufferSize())
 }
 
 type aggregativeStatisticsBuffered struct {
@@ -81,6 +92,12 @@ func (s *aggregativeStatisticsBuffered) getPercentile(percentile float64) float6
 		return 0
 	}
 	percentileIdx := int(float64(s.filledSize) * percentile)
+	if percentileIdx >= int(s.filledSize) {
+		percentileIdx = int(s.filledSize) - 1
+	}
+	if percentileIdx < 0 {
+		percentileIdx = 0
+	}
 	return s.data[percentileIdx]
 }
 
@@ -144,12 +161,13 @@ func randIntn(n uint32) uint32 {
 	if n == math.MaxUint32 {
 		return randIntnPosition
 	}
-	return randIntnPosition % n
+	// the higher bits are used, because the lower bits of a linear congruential generator are not random enough
+	return uint32((uint64(randIntnPosition) * uint64(n)) >> 32)
 }
 
 func (s *aggregativeStatisticsBuffered) considerValue(v float64) {
 	s.tickID++
-	if s.filledSize < uint32(bufferSize) {
+	if s.filledSize < uint32(len(s.data)) {
 		s.isSorted = false
 		s.data[s.filledSize] = v
 		// We don't want to use atomic write because it's a much more expensive operation.
@@ -161,9 +179,9 @@ func (s *aggregativeStatisticsBuffered) considerValue(v float64) {
 	}
 
 	// The more history we have the more rarely we should update items
-	// That's why here's randIntn(s.tickID) instead of randIntn(bufferSize)
+	// That's why here's randIntn(s.tickID) instead of randIntn(len(s.data))
 	randIdx := randIntn(uint32(s.tickID))
-	if randIdx >= uint32(bufferSize) {
+	if randIdx >= uint32(len(s.data)) {
 		return
 	}
 
@@ -197,37 +215,135 @@ func (s *aggregativeStatisticsBuffered) Set(value float64) {
 	s.locker.Unlock()
 }
 
+// representedCount returns how many considered values are represented by the values in the buffer
+func (s *aggregativeStatisticsBuffered) representedCount() uint64 {
+	if s.tickID < uint64(s.filledSize) {
+		// could happen after "Set"
+		return uint64(s.filledSize)
+	}
+	return s.tickID
+}
+
+// randFloat64 returns a random number from [0, 1)
+func randFloat64() float64 {
+	return float64(randIntn(math.MaxUint32)) / (float64(math.MaxUint32) + 1)
+}
+
+// selectionSampler selects "needed" of "total" items uniformly in one pass without allocations (see "Algorithm S"
+// of Knuth)
+type selectionSampler struct {
+	needed uint32
+	total  uint32
+}
+
+// next returns if the next item should be selected
+func (sampler *selectionSampler) next() bool {
+	if sampler.total == 0 {
+		return false
+	}
+	isSelected := randFloat64()*float64(sampler.total) < float64(sampler.needed)
+	sampler.total--
+	if isSelected {
+		sampler.needed--
+	}
+	return isSelected
+}
+
+// valuesSampler returns "needed" values of a buffer: a uniform selection if there are enough values, otherwise
+// every value once and the rest ones are random values of the buffer (so a small buffer keeps its share in a merged
+// one, every value gets a weight by repetitions)
+type valuesSampler struct {
+	values    []float64
+	selection selectionSampler
+	idx       uint32
+}
+
+func newValuesSampler(values []float64, needed uint32) *valuesSampler {
+	if needed > uint32(len(values)) {
+		needed = uint32(len(values))
+	}
+	return &valuesSampler{
+		values:    values,
+		selection: selectionSampler{needed: needed, total: uint32(len(values))},
+	}
+}
+
+// next returns the next value (it shouldn't be called more than "needed" times)
+func (sampler *valuesSampler) next() float64 {
+	if sampler.selection.needed == 0 {
+		return sampler.values[randIntn(uint32(len(sampler.values)))]
+	}
+	for !sampler.selection.next() {
+		sampler.idx++
+	}
+	sampler.idx++
+	return sampler.values[sampler.idx-1]
+}
+
 // MergeStatistics adds statistics of the argument to the own one (see "Buffer handling" in README.md)
+//
+// If both buffers don't fit into one then a weighted merge is used: every value of a buffer represents
+// "tickID/filledSize" considered values, so every buffer gets the share of the resulting buffer proportional
+// to the amount of values considered by it. Values of every buffer are selected uniformly. If a buffer has less
+// values than its share (for example a small buffer is merged into a big one) then its values are repeated
+// (see "valuesSampler").
 func (s *aggregativeStatisticsBuffered) MergeStatistics(oldSI AggregativeStatistics) {
 	if oldSI == nil {
 		return
 	}
-	oldS := oldSI.(*aggregativeStatisticsBuffered)
+	oldS, ok := oldSI.(*aggregativeStatisticsBuffered)
+	if !ok {
+		return
+	}
 
-	if s.filledSize+oldS.filledSize <= uint32(bufferSize) {
+	size := uint32(len(s.data))
+	if s.filledSize+oldS.filledSize <= size {
 		copy(s.data[s.filledSize:], oldS.data[:oldS.filledSize])
 		s.filledSize += oldS.filledSize
 		s.tickID += oldS.tickID
+		s.isSorted = false
 		// nothing overlaps, done
 		return
 	}
 
-	origFilledSize := s.filledSize
-	if s.filledSize < uint32(bufferSize) {
-		delta := uint32(bufferSize) - s.filledSize
-		copy(s.data[s.filledSize:], oldS.data[oldS.filledSize-delta:])
-		s.filledSize = uint32(bufferSize)
-		oldS.filledSize -= delta
+	// the amount of values to be taken from "oldS" (with a stochastic rounding)
+	ownCount, oldCount := s.representedCount(), oldS.representedCount()
+	oldShare := float64(size) * float64(oldCount) / float64(ownCount+oldCount)
+	takeCount := uint32(oldShare)
+	if randFloat64() < oldShare-float64(takeCount) {
+		takeCount++
 	}
+	if takeCount > size || s.filledSize == 0 {
+		takeCount = size
+	}
+	keepCount := size - takeCount
+	oldValues := newValuesSampler(oldS.data[:oldS.filledSize], takeCount)
 
-	indexes := rand.Perm(int(origFilledSize))
-
-	ratio := float64(oldS.tickID) / float64(s.tickID+oldS.tickID)
-	for idx, value := range oldS.data[:oldS.filledSize] {
-		if ratio > rand.Float64() {
-			s.data[indexes[idx]] = value
+	if keepCount > s.filledSize {
+		// random own values are repeated to keep their share, and the rest of the free space is for old values
+		for idx := s.filledSize; idx < keepCount; idx++ {
+			s.data[idx] = s.data[randIntn(s.filledSize)]
 		}
+		s.filledSize = keepCount
+	} else {
+		// random own values are replaced
+		ownSampler := selectionSampler{needed: s.filledSize - keepCount, total: s.filledSize}
+		replaced := uint32(0)
+		for idx := uint32(0); idx < s.filledSize && replaced < takeCount; idx++ {
+			if ownSampler.next() {
+				s.data[idx] = oldValues.next()
+				replaced++
+			}
+		}
+		takeCount -= replaced
 	}
 
+	// the free space is filled by the rest old values
+	for ; takeCount > 0; takeCount-- {
+		s.data[s.filledSize] = oldValues.next()
+		s.filledSize++
+	}
+
+	s.isSorted = false
 	s.tickID += oldS.tickID
 }
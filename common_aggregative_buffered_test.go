@@ -2,6 +2,8 @@ package metrics
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func BenchmarkSortBuiltin(b *testing.B) {
@@ -37,7 +39,7 @@ func BenchmarkConsiderValueFlow(b *testing.B) {
 	defer testRegistry.Reset()
 	m := &commonAggregativeFlowTest{}
 	m.init(testRegistry, m, `test`, nil)
-	for i := uint(0); i < bufferSize; i++ {
+	for i := uint(0); i < defaultBufferSize; i++ {
 		m.considerValue(float64(i))
 	}
 	b.ResetTimer()
@@ -51,7 +53,7 @@ func BenchmarkDoSliceFlow(b *testing.B) {
 	defer testRegistry.Reset()
 	m := &commonAggregativeFlowTest{}
 	m.init(testRegistry, m, `test`, nil)
-	for i := uint(0); i < bufferSize; i++ {
+	for i := uint(0); i < defaultBufferSize; i++ {
 		m.considerValue(float64(i))
 	}
 	b.ResetTimer()
@@ -65,7 +67,7 @@ func BenchmarkGetPercentilesFlow(b *testing.B) {
 	defer testRegistry.Reset()
 	m := &commonAggregativeFlowTest{}
 	m.init(testRegistry, m, `test`, nil)
-	for i := uint(0); i < bufferSize; i++ {
+	for i := uint(0); i < defaultBufferSize; i++ {
 		m.considerValue(float64(i))
 	}
 	b.ResetTimer()
@@ -80,7 +82,7 @@ func BenchmarkGetDefaultPercentilesFlow(b *testing.B) {
 	defer testRegistry.Reset()
 	m := &commonAggregativeFlowTest{}
 	m.init(testRegistry, m, `test`, nil)
-	for i := uint(0); i < bufferSize; i++ {
+	for i := uint(0); i < defaultBufferSize; i++ {
 		m.considerValue(float64(i))
 	}
 	b.ResetTimer()
@@ -128,7 +130,7 @@ func BenchmarkGetPercentilesBuffered(b *testing.B) {
 	defer testRegistry.Reset()
 	m := &commonAggregativeBufferedTest{}
 	m.init(testRegistry, m, `test`, nil)
-	for i := uint(0); i < bufferSize; i++ {
+	for i := uint(0); i < defaultBufferSize; i++ {
 		m.considerValue(float64(i))
 	}
 	b.ResetTimer()
@@ -160,3 +162,87 @@ func BenchmarkConsiderValueSimple(b *testing.B) {
 		m.considerValue(1000000)
 	}
 }
+
+// newTestBufferedStatistics returns an ideal buffer of "count" values evenly distributed in [from, to)
+func newTestBufferedStatistics(count int, from, to float64) *aggregativeStatisticsBuffered {
+	s := newAggregativeStatisticsBuffered(defaultFlowPercentiles, defaultBufferSize)
+	s.tickID = uint64(count)
+	s.filledSize = uint32(len(s.data))
+	if count < len(s.data) {
+		s.filledSize = uint32(count)
+	}
+	for idx := range s.data[:s.filledSize] {
+		s.data[idx] = from + (to-from)*(float64(idx)+0.5)/float64(s.filledSize)
+	}
+	return s
+}
+
+func TestAggregativeStatisticsBufferedMerge(t *testing.T) {
+	// 100000 values from [0, 1000) and 50000 values from [1000, 2000):
+	// the expected p50 is 750, the expected p90 is 1700.
+	for _, swap := range []bool{false, true} {
+		for _, partial := range []bool{false, true} {
+			big := newTestBufferedStatistics(100000, 0, 1000)
+			small := newTestBufferedStatistics(50000, 1000, 2000)
+			if partial {
+				// a not filled buffer: 500 values, each one represents 100 values
+				small.Release()
+				small = newTestBufferedStatistics(500, 1000, 2000)
+				small.tickID = 50000
+			}
+
+			dst, src := big, small
+			if swap {
+				dst, src = small, big
+			}
+			dst.MergeStatistics(src)
+
+			assert.Equal(t, uint32(defaultBufferSize), dst.filledSize)
+			assert.Equal(t, uint64(150000), dst.tickID)
+			assert.InDelta(t, 750, *dst.GetPercentile(0.5), 100, "swap:%v partial:%v", swap, partial)
+			assert.InDelta(t, 1700, *dst.GetPercentile(0.9), 100, "swap:%v partial:%v", swap, partial)
+
+			big.Release()
+			small.Release()
+		}
+	}
+
+	// a small buffer is merged into a big one (and vice versa): 100 values represent 9000 values of 2, and 1000
+	// values represent 1000 values of 1, so 90% of the merged values should be 2
+	for _, swap := range []bool{false, true} {
+		small := newAggregativeStatisticsBuffered(defaultFlowPercentiles, 100)
+		for idx := range small.data {
+			small.data[idx] = 2
+		}
+		small.filledSize, small.tickID = 100, 9000
+		big := newTestBufferedStatistics(1000, 1, 1)
+		dst, src := big, small
+		if swap {
+			dst, src = small, big
+		}
+		dst.MergeStatistics(src)
+
+		assert.Equal(t, uint32(len(dst.data)), dst.filledSize, "swap:%v", swap)
+		assert.Equal(t, uint64(10000), dst.tickID, "swap:%v", swap)
+		twos := 0
+		for _, value := range dst.data[:dst.filledSize] {
+			if value == 2 {
+				twos++
+			}
+		}
+		assert.InDelta(t, 0.9, float64(twos)/float64(dst.filledSize), 0.011, "swap:%v", swap)
+		assert.Equal(t, float64(1), *dst.GetPercentile(0.05), "swap:%v", swap)
+		assert.Equal(t, float64(2), *dst.GetPercentile(0.5), "swap:%v", swap)
+		big.Release()
+		small.Release()
+	}
+
+	// merging into an empty buffer is just a copy
+	empty := newAggregativeStatisticsBuffered(defaultFlowPercentiles, defaultBufferSize)
+	defer empty.Release()
+	src := newTestBufferedStatistics(100, 0, 100)
+	defer src.Release()
+	empty.MergeStatistics(src)
+	assert.Equal(t, uint32(100), empty.filledSize)
+	assert.Equal(t, float64(50.5), *empty.GetPercentile(0.5))
+}
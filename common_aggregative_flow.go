@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"math"
+	"sort"
 )
 
 const (
@@ -16,15 +17,13 @@ type commonAggregativeFlow struct {
 	commonAggregative
 }
 
-func (m *commonAggregativeFlow) init(r *Registry, parent Metric, key string, tags AnyTags) {
-	m.commonAggregative.init(r, parent, key, tags)
+func (m *commonAggregativeFlow) init(r *Registry, parent Metric, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregative.init(r, parent, key, tags, opts...)
 }
 
 // NewAggregativeStatistics returns a "Flow" (see "Flow" in README.md) implementation of AggregativeStatistics.
 func (m *commonAggregativeFlow) NewAggregativeStatistics() AggregativeStatistics {
-	stats := newAggregativeStatisticsFlow()
-	stats.percentiles = m.registry.defaultPercentiles
-	return stats
+	return newAggregativeStatisticsFlow(m.getPercentiles())
 }
 
 // guessPercentileValue is a so-so correct way of correcting the percentile value for big amount of events
@@ -62,31 +61,44 @@ type aggregativeStatisticsFlow struct {
 
 	locker Spinlock
 
+	// percentiles are tracked percentiles (sorted), see "WithPercentiles"
 	percentiles      []float64
-	percentileValues [maxPercentileValues]float64
+	percentileValues []float64
 }
 
 // GetPercentile returns a percentile value for a given percentile (see https://en.wikipedia.org/wiki/Percentile).
 //
-// It returns nil if the percentile is not from the list: 0.01, 0.1, 0.5, 0.9, 0.99.
+// Only the tracked percentiles (see "WithPercentiles") are calculated, values of other percentiles are linearly
+// interpolated between the nearest tracked ones. It returns nil only if no percentile is tracked.
 func (s *aggregativeStatisticsFlow) GetPercentile(percentile float64) *float64 {
-	if s == nil {
+	if s == nil || len(s.percentiles) == 0 {
 		return nil
 	}
 
-	for idx, p := range s.percentiles {
-		if p == percentile {
-			return &s.percentileValues[idx]
-		}
+	r := s.getPercentile(percentile)
+	return &r
+}
+
+// getPercentile returns the value of the percentile interpolated between the tracked percentiles (see
+// "GetPercentile")
+func (s *aggregativeStatisticsFlow) getPercentile(percentile float64) float64 {
+	idx := sort.SearchFloat64s(s.percentiles, percentile)
+	switch {
+	case idx == len(s.percentiles):
+		return s.percentileValues[idx-1]
+	case s.percentiles[idx] == percentile || idx == 0:
+		return s.percentileValues[idx]
 	}
 
-	return nil
+	lowerP, upperP := s.percentiles[idx-1], s.percentiles[idx]
+	lowerV, upperV := s.percentileValues[idx-1], s.percentileValues[idx]
+	return lowerV + (upperV-lowerV)*(percentile-lowerP)/(upperP-lowerP)
 }
 
 // GetPercentiles returns percentile values for a given slice of percentiles.
 //
-// Returned values are ordered accordingly to the input slice. An element of the returned
-// slice is "nil" if the according percentile is not from the list:  0.01, 0.1, 0.5, 0.9, 0.99.
+// Returned values are ordered accordingly to the input slice. Values of not tracked percentiles are interpolated
+// (see "GetPercentile").
 //
 // There's no performance profit to prefer either of GetPercentile/GetPercentiles for any case (because it's a "Flow"
 // method of percentile calculate), so just use what is more convenient.
@@ -151,14 +163,17 @@ func (s *aggregativeStatisticsFlow) MergeStatistics(oldSI AggregativeStatistics)
 	if oldSI == nil {
 		return
 	}
-	oldS := oldSI.(*aggregativeStatisticsFlow)
+	oldS, ok := oldSI.(*aggregativeStatisticsFlow)
+	if !ok {
+		return
+	}
 
-	if s.tickID+oldS.tickID == 0 {
+	if s.tickID+oldS.tickID == 0 || len(oldS.percentiles) == 0 {
 		return
 	}
 
-	for idx := range s.percentiles {
-		s.percentileValues[idx] = (s.percentileValues[idx]*float64(s.tickID) + oldS.percentileValues[idx]*float64(oldS.tickID)) / float64(s.tickID+oldS.tickID)
+	for idx, p := range s.percentiles {
+		s.percentileValues[idx] = (s.percentileValues[idx]*float64(s.tickID) + oldS.getPercentile(p)*float64(oldS.tickID)) / float64(s.tickID+oldS.tickID)
 	}
 
 	s.tickID += oldS.tickID
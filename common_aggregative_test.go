@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregativeValueVariance(t *testing.T) {
+	r := New()
+	r.SetDefaultGCEnabled(false)
+	defer r.Reset()
+
+	for _, metric := range []AggregativeMetric{
+		r.GaugeAggregativeSimple(`simple`, nil),
+		r.GaugeAggregativeFlow(`flow`, nil),
+		r.GaugeAggregativeBuffered(`buffered`, nil),
+	} {
+		for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+			metric.(interface{ doConsiderValue(float64) }).doConsiderValue(v)
+		}
+		total := metric.GetValuePointers().Total()
+		assert.InDelta(t, 4, total.GetVariance(), 1e-9)
+		assert.InDelta(t, 2, total.GetStdDev(), 1e-9)
+		assert.True(t, strings.Contains(total.String(), `"stddev":2`), total.String())
+
+		sender := &testSender{}
+		metric.Send(sender)
+		var found bool
+		for _, record := range sender.records {
+			if strings.HasSuffix(record.key, `_total_stddev`) {
+				found = true
+				assert.InDelta(t, 2, record.value, 1e-9)
+			}
+		}
+		assert.True(t, found)
+	}
+
+	// merging is exact
+	first := r.GaugeAggregativeSimple(`first`, nil)
+	for _, v := range []float64{2, 4, 4} {
+		first.doConsiderValue(v)
+	}
+	second := r.GaugeAggregativeSimple(`second`, nil)
+	for _, v := range []float64{4, 5, 5, 7, 9} {
+		second.doConsiderValue(v)
+	}
+
+	merged := newAggregativeValue()
+	defer merged.Release()
+	merged.MergeData(first.GetValuePointers().Total())
+	merged.MergeData(second.GetValuePointers().Total())
+	assert.Equal(t, uint64(8), merged.Count.Get())
+	assert.InDelta(t, 4, merged.GetVariance(), 1e-9)
+
+	// a value without percentile statistics
+	assert.Equal(t, `{"count":8,"min":2,"avg":5,"max":9,"sum":40,"variance":4,"stddev":2}`, merged.String())
+}
@@ -13,6 +13,13 @@ var (
 	_ Metric = &MetricTimingBuffered{}
 	_ Metric = &MetricTimingFlow{}
 	_ Metric = &MetricTimingSimple{}
+
+	_ AggregativeMetric = &MetricGaugeAggregativeBuffered{}
+	_ AggregativeMetric = &MetricGaugeAggregativeFlow{}
+	_ AggregativeMetric = &MetricGaugeAggregativeSimple{}
+	_ AggregativeMetric = &MetricTimingBuffered{}
+	_ AggregativeMetric = &MetricTimingFlow{}
+	_ AggregativeMetric = &MetricTimingSimple{}
 )
 
 func checkForInfiniteRecursion(m Metric) {
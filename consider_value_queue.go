@@ -1,9 +1,12 @@
 package metrics
 
 import (
+	"context"
+	"hash/fnv"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
@@ -21,22 +24,62 @@ type considerValueQueueT struct {
 	writePos   uint64 // index of next write
 	wroteItems uint64
 	queue      [queueLength]*considerValueQueueItem
+
+	// createdAt is the unix time (in nanoseconds) when the queue became the current one
+	createdAt int64
+
+	// dispatchedAt is the unix time (in nanoseconds) when the queue was passed to the worker
+	dispatchedAt int64
+
+	// done is closed when the queue is processed (it's used only by flushConsiderValueQueue)
+	done chan struct{}
 }
 
 func (s *considerValueQueueT) release() {
-	s.writePos = 0
-	s.wroteItems = 0
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	// the positions are reset atomically, because a stale pointer to the queue could be still used concurrently
+	// (for example by "flushStaleConsiderValueQueue")
+	atomic.StoreUint64(&s.writePos, 0)
+	atomic.StoreUint64(&s.wroteItems, 0)
 	considerValueQueuePool.Put(s)
 }
 
+// considerValueShard is a queue with a dedicated worker (goroutine). Every aggregative metric is bound to
+// a shard (by the hash of its key), so values of a metric are always processed by the same single goroutine.
+type considerValueShard struct {
+	queue     *considerValueQueueT
+	queueChan chan *considerValueQueueT
+
+	// writers is the amount of "enqueueConsiderValue" calls in progress which use this shard
+	writers int64
+
+	// stopped is closed when the worker of the shard exits (see "SetConsiderValueWorkers")
+	stopped chan struct{}
+}
+
+// considerValueShards is a set of shards. It's replaced as whole on reconfiguration (see "SetConsiderValueWorkers").
+type considerValueShards struct {
+	shards []*considerValueShard
+
+	// started is closed when workers of the shards are allowed to process values. It's required to do not
+	// process values of a metric by two workers concurrently while reconfiguration.
+	started chan struct{}
+}
+
 var (
-	considerValueQueue      *considerValueQueueT
-	considerValueQueueChan  chan *considerValueQueueT
-	considerValueQueueCount uint64
-	considerValueQueuePool  = sync.Pool{
+	considerValueShardsPtr       *considerValueShards
+	considerValueQueueCount      uint64
+	considerValueQueueDropped    uint64
+	considerValueQueueLatency    int64
+	considerValueOverflowPolicy  = &OverflowPolicy{kind: overflowPolicyKindBlock}
+	considerValueQueueSealLocker sync.Mutex
+	considerValueQueuePool       = sync.Pool{
 		New: func() interface{} {
 			newConsiderValueQueue := &considerValueQueueT{}
-			for idx := range considerValueQueue.queue {
+			for idx := range newConsiderValueQueue.queue {
 				newConsiderValueQueue.queue[idx] = &considerValueQueueItem{}
 			}
 			return newConsiderValueQueue
@@ -45,29 +88,111 @@ var (
 )
 
 func init() {
-	// initialize first considerValueQueue from pool
-	swapConsiderValueQueue()
+	shards := newConsiderValueShards(runtime.GOMAXPROCS(0))
+	close(shards.started)
+	storeConsiderValueShards(shards)
+}
+
+func newConsiderValueShards(workers int) *considerValueShards {
+	if workers < 1 {
+		workers = 1
+	}
 
-	// To do not handle locks in aggregated statistics handlers we just process this handlers
-	// in a single routine. And "queueProcessor" is the function for the routine.
-	considerValueQueueChan = make(chan *considerValueQueueT, queueChannelLength)
-	go queueProcessor()
+	shards := &considerValueShards{
+		shards:  make([]*considerValueShard, workers),
+		started: make(chan struct{}),
+	}
+	for idx := range shards.shards {
+		shard := &considerValueShard{
+			queueChan: make(chan *considerValueQueueT, queueChannelLength),
+			stopped:   make(chan struct{}),
+		}
+		// initialize first queue from pool
+		shard.swapQueue()
+		shards.shards[idx] = shard
+
+		// To do not handle locks in aggregated statistics handlers we just process values of a metric
+		// in a single routine. And "queueProcessor" is the function for the routine.
+		go shard.queueProcessor(shards.started)
+	}
+	return shards
+}
+
+// loadConsiderValueShards atomically loads the current set of shards
+func loadConsiderValueShards() *considerValueShards {
+	return (*considerValueShards)(atomic.LoadPointer(
+		(*unsafe.Pointer)((unsafe.Pointer)(&considerValueShardsPtr))),
+	)
+}
+
+func storeConsiderValueShards(shards *considerValueShards) *considerValueShards {
+	return (*considerValueShards)(atomic.SwapPointer(
+		(*unsafe.Pointer)((unsafe.Pointer)(&considerValueShardsPtr)),
+		(unsafe.Pointer)(shards)),
+	)
+}
+
+// get returns the shard for a metric with the hash "hash" (see "considerValueQueueHash")
+func (shards *considerValueShards) get(hash uint32) *considerValueShard {
+	return shards.shards[hash%uint32(len(shards.shards))]
 }
 
-func queueProcessor() {
+// considerValueQueueHash returns the hash to be used to choose a shard for a metric with the key "storageKey"
+func considerValueQueueHash(storageKey []byte) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write(storageKey)
+	return h.Sum32()
+}
+
+// SetConsiderValueWorkers sets the amount of goroutines which process values of aggregative metrics
+// (see "ConsiderValue"). Values of a metric are always processed by the same goroutine. The default is GOMAXPROCS.
+//
+// It waits until all values passed to the old workers are processed.
+func SetConsiderValueWorkers(workers int) {
+	considerValueQueueSealLocker.Lock()
+	defer considerValueQueueSealLocker.Unlock()
+
+	newShards := newConsiderValueShards(workers)
+	oldShards := storeConsiderValueShards(newShards)
+
+	for _, shard := range oldShards.shards {
+		shard.retire()
+	}
+	for _, shard := range oldShards.shards {
+		<-shard.stopped
+	}
+	close(newShards.started)
+}
+
+// GetConsiderValueWorkers returns the amount of goroutines which process values of aggregative metrics
+// (see "SetConsiderValueWorkers").
+func GetConsiderValueWorkers() int {
+	return len(loadConsiderValueShards().shards)
+}
+
+func (shard *considerValueShard) queueProcessor(started chan struct{}) {
+	defer close(shard.stopped)
+	<-started
+
 	for {
 		// if we got a panic (inside queueProcessorLoop) then we need to restart
-		queueProcessorLoop()
+		if shard.queueProcessorLoop() {
+			return
+		}
 	}
 }
 
-func queueProcessorLoop() {
+// queueProcessorLoop processes queues until the channel is closed. It returns true if the channel is closed.
+func (shard *considerValueShard) queueProcessorLoop() (isClosed bool) {
 	defer recoverPanic()
 
-	for {
-		processQueue(<-considerValueQueueChan)
+	for queue := range shard.queueChan {
+		dispatchedAt := atomic.LoadInt64(&queue.dispatchedAt)
+		processQueue(queue)
 		atomic.AddUint64(&considerValueQueueCount, 1)
+		atomic.StoreInt64(&considerValueQueueLatency, time.Now().UnixNano()-dispatchedAt)
 	}
+	return true
 }
 
 func processQueue(queue *considerValueQueueT) {
@@ -78,27 +203,39 @@ func processQueue(queue *considerValueQueueT) {
 	}
 }
 
-// loadConsiderValueQueue atomically loads current queue
-func loadConsiderValueQueue() *considerValueQueueT {
+// loadQueue atomically loads current queue
+func (shard *considerValueShard) loadQueue() *considerValueQueueT {
 	return (*considerValueQueueT)(atomic.LoadPointer(
-		(*unsafe.Pointer)((unsafe.Pointer)(&considerValueQueue))),
+		(*unsafe.Pointer)((unsafe.Pointer)(&shard.queue))),
 	)
 }
 
-// swapConsiderValueQueue creates a new queue from pool and atomically replaces current queue with it
-func swapConsiderValueQueue() *considerValueQueueT {
+// swapQueue creates a new queue from pool and atomically replaces current queue with it
+func (shard *considerValueShard) swapQueue() *considerValueQueueT {
 	newConsiderValueQueue := considerValueQueuePool.Get().(*considerValueQueueT)
+	atomic.StoreInt64(&newConsiderValueQueue.createdAt, time.Now().UnixNano())
 	return (*considerValueQueueT)(
 		atomic.SwapPointer(
-			(*unsafe.Pointer)((unsafe.Pointer)(&considerValueQueue)),
+			(*unsafe.Pointer)((unsafe.Pointer)(&shard.queue)),
 			(unsafe.Pointer)(newConsiderValueQueue)),
 	)
 }
 
 func enqueueConsiderValue(metric *commonAggregative, value float64) {
+	policy := loadConsiderValueOverflowPolicy()
+
 retry:
-	// load current queue
-	queue := loadConsiderValueQueue()
+	// load current shard and queue
+	shard := loadConsiderValueShards().get(metric.queueShardHash)
+	if policy.kind != overflowPolicyKindBlock && len(shard.queueChan) == cap(shard.queueChan) {
+		// the worker is overloaded
+		if !policy.isSampled() {
+			atomic.AddUint64(&considerValueQueueDropped, 1)
+			return
+		}
+	}
+	atomic.AddInt64(&shard.writers, 1)
+	queue := shard.loadQueue()
 
 	// get write position in queue
 	idx := atomic.AddUint64(&queue.writePos, 1)
@@ -106,8 +243,9 @@ retry:
 	case idx == queueLength:
 		// this is the last position in queue, we will put data into it
 		// since there is no space left for new items, we create new queue
-		swapConsiderValueQueue()
+		shard.swapQueue()
 	case idx > queueLength:
+		atomic.AddInt64(&shard.writers, -1)
 		runtime.Gosched()
 		goto retry
 	default:
@@ -122,6 +260,267 @@ retry:
 	// if we just wrote last item in queue, we should schedule for processing
 	wIdx := atomic.AddUint64(&queue.wroteItems, 1)
 	if wIdx == queueLength {
-		considerValueQueueChan <- queue
+		shard.dispatch(queue, policy)
+	}
+	atomic.AddInt64(&shard.writers, -1)
+}
+
+// dispatch passes a filled queue to the worker of the shard
+func (shard *considerValueShard) dispatch(queue *considerValueQueueT, policy *OverflowPolicy) {
+	atomic.StoreInt64(&queue.dispatchedAt, time.Now().UnixNano())
+	if policy.kind == overflowPolicyKindBlock {
+		shard.queueChan <- queue
+		return
+	}
+
+	select {
+	case shard.queueChan <- queue:
+	default:
+		atomic.AddUint64(&considerValueQueueDropped, queue.wroteItems)
+		queue.release()
+	}
+}
+
+// isSampled returns true if a value should be accepted by an overloaded shard (see "OverflowSample")
+func (policy *OverflowPolicy) isSampled() bool {
+	return policy.kind == overflowPolicyKindSample && randFloat64() < policy.sampleRate
+}
+
+// seal prevents further writes to the current (not filled) queue and returns it when all writers finished
+// writing to it. The returned queue is not dispatched, yet.
+//
+// If "replace" is true then the queue is replaced with a new one. Otherwise the shard is left sealed forever
+// (it's used to retire the shard).
+//
+// It returns nil if the queue is empty and "skip" returns true for the queue.
+// The caller should hold considerValueQueueSealLocker.
+func (shard *considerValueShard) seal(replace bool, skip func(queue *considerValueQueueT, pos uint64) bool) *considerValueQueueT {
+	var queue *considerValueQueueT
+	var pos uint64
+	for {
+		queue = shard.loadQueue()
+		pos = atomic.LoadUint64(&queue.writePos)
+		if pos >= queueLength {
+			// the queue is already filled, a writer will replace it with a new one and dispatch it
+			runtime.Gosched()
+			continue
+		}
+		if skip != nil && skip(queue, pos) {
+			return nil
+		}
+		if atomic.CompareAndSwapUint64(&queue.writePos, pos, queueLength+1) {
+			break
+		}
+	}
+	if replace {
+		shard.swapQueue()
+	}
+
+	// wait for writers which already got their positions in the queue
+	for atomic.LoadUint64(&queue.wroteItems) != pos {
+		runtime.Gosched()
 	}
+	return queue
+}
+
+// retire dispatches the rest values of the shard and stops its worker (after the values are processed).
+// New writers should already use another set of shards.
+func (shard *considerValueShard) retire() {
+	queue := shard.seal(false, nil)
+
+	// wait for writers which may still dispatch filled queues to the channel
+	for atomic.LoadInt64(&shard.writers) != 0 {
+		runtime.Gosched()
+	}
+
+	atomic.StoreInt64(&queue.dispatchedAt, time.Now().UnixNano())
+	shard.queueChan <- queue
+	close(shard.queueChan)
+}
+
+// flushConsiderValueQueue dispatches the current (not filled) queues and waits until they and all previously
+// dispatched queues are processed (or until the context is done). The queues are dispatched even if the context
+// is done (see "OverflowPolicy"), the context limits only the wait for the processing.
+func flushConsiderValueQueue(ctx context.Context) error {
+	return flushConsiderValueQueueIf(ctx, nil)
+}
+
+// flushConsiderValueQueueIf is the same as flushConsiderValueQueue, but it skips queues
+// for which "skip" returns true.
+func flushConsiderValueQueueIf(ctx context.Context, skip func(queue *considerValueQueueT, pos uint64) bool) error {
+	var dones []chan struct{}
+
+	considerValueQueueSealLocker.Lock()
+	for _, shard := range loadConsiderValueShards().shards {
+		queue := shard.seal(true, skip)
+		if queue == nil {
+			continue
+		}
+
+		// the queues of a shard are processed by a single goroutine in order, so if this queue is processed then
+		// all previous queues of the shard are processed, too
+		done := make(chan struct{})
+		queue.done = done
+		atomic.StoreInt64(&queue.dispatchedAt, time.Now().UnixNano())
+		select {
+		case shard.queueChan <- queue:
+		case <-ctx.Done():
+			// the sealed queue is not current anymore, so it should be dispatched anyway (as a filled one,
+			// according to the overflow policy), otherwise its values are lost
+			shard.dispatch(queue, loadConsiderValueOverflowPolicy())
+		}
+		dones = append(dones, done)
+	}
+	considerValueQueueSealLocker.Unlock()
+
+	for _, done := range dones {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// flushStaleConsiderValueQueue flushes current queues which are not empty and are older than "maxAge" (waiting
+// until the context is done at most). It's called before slicing, so a value never waits for processing longer than
+// a slicer interval.
+func flushStaleConsiderValueQueue(ctx context.Context, maxAge time.Duration) {
+	isStale := func(queue *considerValueQueueT, pos uint64) bool {
+		if pos == 0 {
+			return false
+		}
+		return time.Since(time.Unix(0, atomic.LoadInt64(&queue.createdAt))) >= maxAge
+	}
+
+	hasStale := false
+	for _, shard := range loadConsiderValueShards().shards {
+		queue := shard.loadQueue()
+		if isStale(queue, atomic.LoadUint64(&queue.writePos)) {
+			hasStale = true
+			break
+		}
+	}
+	if !hasStale {
+		return
+	}
+
+	_ = flushConsiderValueQueueIf(ctx, func(queue *considerValueQueueT, pos uint64) bool {
+		return !isStale(queue, pos)
+	})
+}
+
+// Flush processes all values passed to aggregative metrics (see "ConsiderValue") before the call and waits until
+// the processing completes.
+//
+// Values of aggregative metrics are processed asynchronously in batches, so with a low traffic a value may
+// wait for processing up to a slicer interval (see "SetSlicerInterval"). Flush is useful to get actual values
+// right now (for example in unit tests).
+func (r *Registry) Flush() {
+	_ = flushConsiderValueQueue(context.Background())
+}
+
+// Flush processes all values passed to aggregative metrics before the call and waits until the processing
+// completes (see "Registry.Flush").
+func Flush() {
+	registry.Flush()
+}
+
+type overflowPolicyKind uint8
+
+const (
+	overflowPolicyKindBlock = overflowPolicyKind(iota)
+	overflowPolicyKindDropNewest
+	overflowPolicyKindSample
+)
+
+// OverflowPolicy defines what to do with new values of aggregative metrics if workers which process the values
+// are overloaded (see "SetConsiderValueOverflowPolicy").
+type OverflowPolicy struct {
+	kind       overflowPolicyKind
+	sampleRate float64
+}
+
+var (
+	// OverflowBlock is an OverflowPolicy which blocks the caller of "ConsiderValue" until a worker is ready
+	// to process the values. It's the default policy.
+	OverflowBlock = OverflowPolicy{kind: overflowPolicyKindBlock}
+
+	// OverflowDropNewest is an OverflowPolicy which drops new values while workers are overloaded
+	OverflowDropNewest = OverflowPolicy{kind: overflowPolicyKindDropNewest}
+)
+
+// OverflowSample returns an OverflowPolicy which accepts only a part of new values (the "rate": 0.0 .. 1.0) while
+// workers are overloaded. It never blocks the caller: if there's still no room for accepted values then they're
+// dropped like with "OverflowDropNewest".
+func OverflowSample(rate float64) OverflowPolicy {
+	return OverflowPolicy{kind: overflowPolicyKindSample, sampleRate: rate}
+}
+
+// SetConsiderValueOverflowPolicy sets what to do with new values of aggregative metrics if workers which
+// process the values are overloaded (see "OverflowBlock", "OverflowDropNewest" and "OverflowSample").
+func SetConsiderValueOverflowPolicy(policy OverflowPolicy) {
+	atomic.StorePointer((*unsafe.Pointer)((unsafe.Pointer)(&considerValueOverflowPolicy)), (unsafe.Pointer)(&policy))
+}
+
+func loadConsiderValueOverflowPolicy() *OverflowPolicy {
+	return (*OverflowPolicy)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&considerValueOverflowPolicy))))
+}
+
+// ConsiderValueQueueStats is a state of the processing of values of aggregative metrics
+// (see "GetConsiderValueQueueStats").
+type ConsiderValueQueueStats struct {
+	// Depth is the amount of batches of values waiting for processing
+	Depth int
+
+	// ProcessedBatches is the amount of processed batches of values
+	ProcessedBatches uint64
+
+	// DroppedValues is the amount of values dropped due to an overflow (see "SetConsiderValueOverflowPolicy")
+	DroppedValues uint64
+
+	// Latency is the time passed between the dispatching of the last processed batch and the end of its processing
+	Latency time.Duration
+}
+
+// GetConsiderValueQueueStats returns the state of the processing of values of aggregative metrics. It's used to
+// see when instrumentation itself is hurting the application (see also "RegisterConsiderValueQueueMetrics").
+func GetConsiderValueQueueStats() ConsiderValueQueueStats {
+	stats := ConsiderValueQueueStats{
+		ProcessedBatches: atomic.LoadUint64(&considerValueQueueCount),
+		DroppedValues:    atomic.LoadUint64(&considerValueQueueDropped),
+		Latency:          time.Duration(atomic.LoadInt64(&considerValueQueueLatency)),
+	}
+	for _, shard := range loadConsiderValueShards().shards {
+		stats.Depth += len(shard.queueChan)
+	}
+	return stats
+}
+
+// RegisterConsiderValueQueueMetrics creates gauge metrics (in the registry) with the state of the processing of
+// values of aggregative metrics (see "GetConsiderValueQueueStats"):
+//   - metrics.consider_value_queue.depth
+//   - metrics.consider_value_queue.batches.count
+//   - metrics.consider_value_queue.dropped.count
+//   - metrics.consider_value_queue.latency.ns
+func (r *Registry) RegisterConsiderValueQueueMetrics() {
+	r.GaugeInt64Func(`metrics.consider_value_queue.depth`, nil, func() int64 {
+		return int64(GetConsiderValueQueueStats().Depth)
+	}).SetGCEnabled(false)
+	r.GaugeInt64Func(`metrics.consider_value_queue.batches.count`, nil, func() int64 {
+		return int64(atomic.LoadUint64(&considerValueQueueCount))
+	}).SetGCEnabled(false)
+	r.GaugeInt64Func(`metrics.consider_value_queue.dropped.count`, nil, func() int64 {
+		return int64(atomic.LoadUint64(&considerValueQueueDropped))
+	}).SetGCEnabled(false)
+	r.GaugeInt64Func(`metrics.consider_value_queue.latency.ns`, nil, func() int64 {
+		return atomic.LoadInt64(&considerValueQueueLatency)
+	}).SetGCEnabled(false)
+}
+
+// RegisterConsiderValueQueueMetrics creates gauge metrics (in the default registry) with the state of
+// the processing of values of aggregative metrics (see "Registry.RegisterConsiderValueQueueMetrics").
+func RegisterConsiderValueQueueMetrics() {
+	registry.RegisterConsiderValueQueueMetrics()
 }
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlush(t *testing.T) {
+	r := New()
+	r.SetDefaultIsRan(false)
+	defer r.Reset()
+
+	metric := r.GaugeAggregativeFlow(`flush`, nil)
+	metric.ConsiderValue(1)
+	metric.ConsiderValue(2)
+	r.Flush()
+	assert.Equal(t, uint64(2), metric.data.current.Count.Get())
+
+	// a fresh queue is not flushed by slicers
+	metric.ConsiderValue(3)
+	flushStaleConsiderValueQueue(context.Background(), time.Hour)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&loadConsiderValueShards().get(metric.queueShardHash).loadQueue().writePos))
+	flushStaleConsiderValueQueue(context.Background(), 0)
+	assert.Equal(t, uint64(3), metric.data.current.Count.Get())
+}
+
+func TestFlushDeadline(t *testing.T) {
+	defer SetConsiderValueOverflowPolicy(OverflowBlock)
+
+	r := New()
+	r.SetDefaultIsRan(false)
+	defer r.Reset()
+
+	metric := r.GaugeAggregativeFlow(`flush_deadline`, nil)
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropNewest} {
+		SetConsiderValueOverflowPolicy(policy)
+		statsBefore := GetConsiderValueQueueStats()
+		countBefore := metric.data.current.Count.Get()
+
+		// block the worker of the metric and fill the channel of its shard, so the current queue can't be sent
+		current := metric.data.current
+		current.Lock()
+		for i := 0; i < queueLength*(queueChannelLength+1)+1; i++ {
+			metric.ConsiderValue(1)
+		}
+		assert.Eventually(t, func() bool {
+			return GetConsiderValueQueueStats().Depth == queueChannelLength
+		}, time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		flushed := make(chan error)
+		go func() {
+			flushed <- flushConsiderValueQueue(ctx)
+		}()
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		current.Unlock()
+		<-flushed
+		cancel()
+
+		// the values of the sealed queue are either processed or counted as dropped
+		r.Flush()
+		dropped := GetConsiderValueQueueStats().DroppedValues - statsBefore.DroppedValues
+		processed := metric.data.current.Count.Get() - countBefore
+		assert.Equal(t, uint64(queueLength*(queueChannelLength+1)+1), processed+dropped, policy)
+		if policy.kind == overflowPolicyKindBlock {
+			assert.Equal(t, uint64(0), dropped)
+		} else {
+			assert.Equal(t, uint64(1), dropped)
+		}
+	}
+}
+
+func TestSetConsiderValueWorkers(t *testing.T) {
+	defaultWorkers := GetConsiderValueWorkers()
+	defer SetConsiderValueWorkers(defaultWorkers)
+
+	r := New()
+	r.SetDefaultIsRan(false)
+	defer r.Reset()
+
+	var list []*MetricGaugeAggregativeFlow
+	for i := 0; i < 10; i++ {
+		list = append(list, r.GaugeAggregativeFlow(`sharded`, Tags{`i`: i}))
+	}
+
+	var wg sync.WaitGroup
+	for _, workers := range []int{3, 1, 8} {
+		wg.Add(len(list))
+		for _, metric := range list {
+			go func(metric *MetricGaugeAggregativeFlow) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					metric.ConsiderValue(1)
+				}
+			}(metric)
+		}
+		SetConsiderValueWorkers(workers)
+		assert.Equal(t, workers, GetConsiderValueWorkers())
+	}
+	wg.Wait()
+
+	r.Flush()
+	for _, metric := range list {
+		assert.Equal(t, uint64(3000), metric.data.current.Count.Get())
+	}
+}
+
+func TestConsiderValueOverflowPolicy(t *testing.T) {
+	defer SetConsiderValueOverflowPolicy(OverflowBlock)
+
+	r := New()
+	r.SetDefaultIsRan(false)
+	defer r.Reset()
+	r.RegisterConsiderValueQueueMetrics()
+
+	metric := r.GaugeAggregativeFlow(`overflow`, nil)
+	statsBefore := GetConsiderValueQueueStats()
+
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowSample(0.5)} {
+		SetConsiderValueOverflowPolicy(policy)
+
+		// block the worker of the metric
+		current := metric.data.current
+		current.Lock()
+		for i := 0; i < queueLength*(queueChannelLength+3); i++ {
+			metric.ConsiderValue(1)
+		}
+		assert.Equal(t, queueChannelLength, GetConsiderValueQueueStats().Depth)
+		current.Unlock()
+		r.Flush()
+	}
+
+	stats := GetConsiderValueQueueStats()
+	dropped := stats.DroppedValues - statsBefore.DroppedValues
+	total := uint64(2 * queueLength * (queueChannelLength + 3))
+	assert.Equal(t, total, metric.data.current.Count.Get()+dropped)
+	assert.True(t, dropped > 0)
+	assert.True(t, stats.ProcessedBatches > statsBefore.ProcessedBatches)
+	assert.True(t, stats.Latency > 0)
+	assert.Equal(t, int64(stats.ProcessedBatches), r.GaugeInt64Func(`metrics.consider_value_queue.batches.count`, nil, nil).Get())
+}
+
+func TestOverflowSampleRate(t *testing.T) {
+	for _, rate := range []float64{0, 0.05, 0.3, 0.7, 1} {
+		policy := OverflowSample(rate)
+		var kept int
+		for i := 0; i < 100000; i++ {
+			if policy.isSampled() {
+				kept++
+			}
+		}
+		assert.InDelta(t, rate, float64(kept)/100000, 0.01, rate)
+	}
+	assert.False(t, OverflowDropNewest.isSampled())
+}
+
+func TestConsiderValueSync(t *testing.T) {
+	r := New()
+	r.SetDefaultIsRan(false)
+	defer r.Reset()
+
+	async := r.TimingFlow(`async`, nil)
+	assert.False(t, async.IsConsiderValueSync())
+	async.SetConsiderValueSync(true)
+	async.ConsiderValue(time.Second)
+	assert.Equal(t, uint64(1), async.data.current.Count.Get())
+
+	r.SetDefaultConsiderValueSync(true)
+	metric := r.GaugeAggregativeBuffered(`sync`, nil)
+	assert.True(t, metric.IsConsiderValueSync())
+	metric.ConsiderValue(1)
+	metric.ConsiderValue(3)
+	assert.Equal(t, uint64(2), metric.data.current.Count.Get())
+	assert.Equal(t, float64(2), metric.data.current.Avg.Get())
+}
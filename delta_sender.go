@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+)
+
+type deltaSenderValueKind uint8
+
+const (
+	deltaSenderValueKindInt64 = deltaSenderValueKind(iota)
+	deltaSenderValueKindUint64
+	deltaSenderValueKindFloat64
+)
+
+type deltaSenderValue struct {
+	kind deltaSenderValueKind
+	bits uint64
+}
+
+// DeltaSender is a Sender which passes to the underlying Sender only values which were changed since
+// the previous sending. So only changed series are shipped instead of everything on every `Iterate()`.
+//
+// Values of series which are not sent during a whole iteration (for example of removed metrics) are forgotten, so
+// the memory usage doesn't grow. The start of a new iteration is detected by a key which is sent again, so it's
+// supposed that the metrics are sent with the same interval (values of rarer metrics are just passed through
+// every time).
+//
+// See also "Diff".
+type DeltaSender struct {
+	locker sync.Mutex
+	sender Sender
+
+	// current are the values sent during the current iteration and previous are the values of the previous one
+	current  map[string]deltaSenderValue
+	previous map[string]deltaSenderValue
+}
+
+// NewDeltaSender returns a DeltaSender which passes changed values to "sender"
+func NewDeltaSender(sender Sender) *DeltaSender {
+	return &DeltaSender{
+		sender:   sender,
+		current:  map[string]deltaSenderValue{},
+		previous: map[string]deltaSenderValue{},
+	}
+}
+
+// isChanged remembers the new value and returns true if it differs from the previous value of the key
+func (sender *DeltaSender) isChanged(key string, newValue deltaSenderValue) bool {
+	sender.locker.Lock()
+	defer sender.locker.Unlock()
+
+	oldValue, ok := sender.current[key]
+	if ok {
+		// the key is sent again, so it's a new iteration: forget values which were not sent during the previous one
+		sender.previous = sender.current
+		sender.current = make(map[string]deltaSenderValue, len(sender.previous))
+	} else {
+		oldValue, ok = sender.previous[key]
+	}
+	sender.current[key] = newValue
+	return !ok || oldValue != newValue
+}
+
+// Forget removes the remembered value of the key, so the next value will be passed through anyway.
+func (sender *DeltaSender) Forget(key string) {
+	sender.locker.Lock()
+	delete(sender.current, key)
+	delete(sender.previous, key)
+	sender.locker.Unlock()
+}
+
+// Reset removes all remembered values, so all next values will be passed through anyway.
+func (sender *DeltaSender) Reset() {
+	sender.locker.Lock()
+	sender.current = map[string]deltaSenderValue{}
+	sender.previous = map[string]deltaSenderValue{}
+	sender.locker.Unlock()
+}
+
+// SendInt64 passes the value to the underlying Sender if it was changed
+func (sender *DeltaSender) SendInt64(metric Metric, key string, value int64) error {
+	if !sender.isChanged(key, deltaSenderValue{kind: deltaSenderValueKindInt64, bits: uint64(value)}) {
+		return nil
+	}
+	err := sender.sender.SendInt64(metric, key, value)
+	if err != nil {
+		sender.Forget(key)
+	}
+	return err
+}
+
+// SendUint64 passes the value to the underlying Sender if it was changed
+func (sender *DeltaSender) SendUint64(metric Metric, key string, value uint64) error {
+	if !sender.isChanged(key, deltaSenderValue{kind: deltaSenderValueKindUint64, bits: value}) {
+		return nil
+	}
+	err := sender.sender.SendUint64(metric, key, value)
+	if err != nil {
+		sender.Forget(key)
+	}
+	return err
+}
+
+// SendFloat64 passes the value to the underlying Sender if it was changed
+func (sender *DeltaSender) SendFloat64(metric Metric, key string, value float64) error {
+	if !sender.isChanged(key, deltaSenderValue{kind: deltaSenderValueKindFloat64, bits: math.Float64bits(value)}) {
+		return nil
+	}
+	err := sender.sender.SendFloat64(metric, key, value)
+	if err != nil {
+		sender.Forget(key)
+	}
+	return err
+}
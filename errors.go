@@ -8,4 +8,25 @@ var (
 	// ErrAlreadyExists should never be returned: it's an internal error.
 	// If you get this error then please let us know.
 	ErrAlreadyExists = errors.New(`such metric is already registered`)
+
+	// ErrCreationVetoed is returned by "Register" if a creation of a metric was vetoed by an "OnCreateHook".
+	ErrCreationVetoed = errors.New(`the creation of the metric was vetoed by a hook`)
+
+	// ErrRegistryClosed is returned if the registry is already closed (see "Close").
+	ErrRegistryClosed = errors.New(`the registry is closed`)
+
+	// ErrInvalidAggregationPeriods is returned if aggregation periods are not supported
+	// (see "ValidateAggregationPeriods").
+	ErrInvalidAggregationPeriods = errors.New(`invalid aggregation periods`)
+
+	// ErrInvalidPercentiles is returned if a list of percentiles is empty or a percentile is out of range 0.0 .. 1.0
+	// (see "ValidatePercentiles").
+	ErrInvalidPercentiles = errors.New(`invalid percentiles`)
+
+	// ErrInvalidBinaryData is returned if serialized data is corrupted (see "Serialization" in README.md).
+	ErrInvalidBinaryData = errors.New(`invalid binary data`)
+
+	// ErrUnsupportedFormatVersion is returned if data was serialized with an unknown version of the wire format
+	// (see "MetricState").
+	ErrUnsupportedFormatVersion = errors.New(`unsupported version of the wire format`)
 )
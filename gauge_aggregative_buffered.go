@@ -9,14 +9,14 @@ type MetricGaugeAggregativeBuffered struct {
 	commonAggregativeBuffered
 }
 
-func (r *Registry) newMetricGaugeAggregativeBuffered(key string, tags AnyTags) *MetricGaugeAggregativeBuffered {
+func (r *Registry) newMetricGaugeAggregativeBuffered(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeBuffered {
 	metric := metricGaugeAggregativeBufferedPool.Get().(*MetricGaugeAggregativeBuffered)
-	metric.init(r, key, tags)
+	metric.init(r, key, tags, opts...)
 	return metric
 }
 
-func (m *MetricGaugeAggregativeBuffered) init(r *Registry, key string, tags AnyTags) {
-	m.commonAggregativeBuffered.init(r, m, key, tags)
+func (m *MetricGaugeAggregativeBuffered) init(r *Registry, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregativeBuffered.init(r, m, key, tags, opts...)
 }
 
 // GaugeAggregativeBuffered returns a metric of type "MetricGaugeAggregativeBuffered".
@@ -31,8 +31,8 @@ func (m *MetricGaugeAggregativeBuffered) init(r *Registry, key string, tags AnyT
 //
 // MetricGaugeAggregativeBuffered uses the "Buffered" method to aggregate the statistics
 // (see "Buffered" in README.md)
-func GaugeAggregativeBuffered(key string, tags AnyTags) *MetricGaugeAggregativeBuffered {
-	return registry.GaugeAggregativeBuffered(key, tags)
+func GaugeAggregativeBuffered(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeBuffered {
+	return registry.GaugeAggregativeBuffered(key, tags, opts...)
 }
 
 // GaugeAggregativeBuffered returns a metric of type "MetricGaugeAggregativeBuffered".
@@ -47,7 +47,7 @@ func GaugeAggregativeBuffered(key string, tags AnyTags) *MetricGaugeAggregativeB
 //
 // MetricGaugeAggregativeBuffered uses the "Buffered" method to aggregate the statistics
 // (see "Buffered" in README.md)
-func (r *Registry) GaugeAggregativeBuffered(key string, tags AnyTags) *MetricGaugeAggregativeBuffered {
+func (r *Registry) GaugeAggregativeBuffered(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeBuffered {
 	if IsDisabled() {
 		return (*MetricGaugeAggregativeBuffered)(nil)
 	}
@@ -57,7 +57,7 @@ func (r *Registry) GaugeAggregativeBuffered(key string, tags AnyTags) *MetricGau
 		return m.(*MetricGaugeAggregativeBuffered)
 	}
 
-	return r.newMetricGaugeAggregativeBuffered(key, tags)
+	return r.newMetricGaugeAggregativeBuffered(key, tags, opts...)
 }
 
 // ConsiderValue adds a value to the statistics, it's an analog of prometheus' "Observe"
@@ -2,9 +2,62 @@ package metrics
 
 import (
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMetricInterfaceOnGaugeAggregativeBuffered(t *testing.T) {
 	m := registry.newMetricGaugeAggregativeBuffered(``, nil)
 	checkForInfiniteRecursion(m)
 }
+
+func TestBufferSize(t *testing.T) {
+	r := New()
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	assert.Equal(t, uint(defaultBufferSize), r.GetDefaultBufferSize())
+	r.SetDefaultBufferSize(200)
+
+	small := r.GaugeAggregativeBuffered(`small`, nil, WithBufferSize(10))
+	byDefault := r.GaugeAggregativeBuffered(`default`, nil)
+	decaying := r.GaugeAggregativeBuffered(`decaying`, nil, WithBufferSize(20), WithDecayingReservoir(time.Minute))
+
+	// changing the default size doesn't affect existing metrics
+	r.SetDefaultBufferSize(0)
+	assert.Equal(t, uint(defaultBufferSize), r.GetDefaultBufferSize())
+
+	for i := 0; i < 1000; i++ {
+		small.ConsiderValue(float64(i))
+		byDefault.ConsiderValue(float64(i))
+		decaying.ConsiderValue(float64(i))
+	}
+
+	smallTotal := small.GetValuePointers().Total()
+	assert.Len(t, smallTotal.AggregativeStatistics.(*aggregativeStatisticsBuffered).data, 10)
+	assert.Equal(t, uint32(10), smallTotal.AggregativeStatistics.(*aggregativeStatisticsBuffered).filledSize)
+	assert.Len(t, byDefault.GetValuePointers().Total().AggregativeStatistics.(*aggregativeStatisticsBuffered).data, 200)
+	assert.Len(t, decaying.GetValuePointers().Total().AggregativeStatistics.(*aggregativeStatisticsDecaying).samples, 20)
+
+	// the highest percentile doesn't overflow the buffer
+	notFilled := r.GaugeAggregativeBuffered(`not_filled`, nil, WithBufferSize(10))
+	for i := 0; i < 5; i++ {
+		notFilled.ConsiderValue(float64(i))
+	}
+	assert.Equal(t, float64(4), *notFilled.GetValuePointers().Total().GetPercentile(1))
+	assert.Equal(t, float64(0), *notFilled.GetValuePointers().Total().GetPercentile(0))
+}
+
+func TestBufferSizePools(t *testing.T) {
+	// a released big buffer is not reused for a small one
+	for i := 0; i < 10; i++ {
+		newAggregativeStatisticsBuffered(defaultFlowPercentiles, 10000).Release()
+	}
+	for _, size := range []uint{10, 1000, 1024, 1025} {
+		stats := newAggregativeStatisticsBuffered(defaultFlowPercentiles, size)
+		assert.Len(t, stats.data, int(size))
+		assert.True(t, uint(cap(stats.data)) < 2*size, size)
+		stats.Release()
+	}
+}
@@ -8,14 +8,14 @@ type MetricGaugeAggregativeFlow struct {
 	commonAggregativeFlow
 }
 
-func (r *Registry) newMetricGaugeAggregativeFlow(key string, tags AnyTags) *MetricGaugeAggregativeFlow {
+func (r *Registry) newMetricGaugeAggregativeFlow(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeFlow {
 	metric := metricGaugeAggregativeFlowPool.Get().(*MetricGaugeAggregativeFlow)
-	metric.init(r, key, tags)
+	metric.init(r, key, tags, opts...)
 	return metric
 }
 
-func (m *MetricGaugeAggregativeFlow) init(r *Registry, key string, tags AnyTags) {
-	m.commonAggregativeFlow.init(r, m, key, tags)
+func (m *MetricGaugeAggregativeFlow) init(r *Registry, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregativeFlow.init(r, m, key, tags, opts...)
 }
 
 // GaugeAggregativeFlow returns a metric of type "MetricGaugeAggregativeFlow".
@@ -29,8 +29,8 @@ func (m *MetricGaugeAggregativeFlow) init(r *Registry, key string, tags AnyTags)
 // It's an analog of prometheus' "Summary" (see https://prometheus.io/docs/concepts/metric_types/#summary).
 //
 // MetricGaugeAggregativeFlow uses the "Flow" method to aggregate the statistics (see "Flow" in README.md)
-func GaugeAggregativeFlow(key string, tags AnyTags) *MetricGaugeAggregativeFlow {
-	return registry.GaugeAggregativeFlow(key, tags)
+func GaugeAggregativeFlow(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeFlow {
+	return registry.GaugeAggregativeFlow(key, tags, opts...)
 }
 
 // GaugeAggregativeFlow returns a metric of type "MetricGaugeAggregativeFlow".
@@ -44,7 +44,7 @@ func GaugeAggregativeFlow(key string, tags AnyTags) *MetricGaugeAggregativeFlow
 // It's an analog of prometheus' "Summary" (see https://prometheus.io/docs/concepts/metric_types/#summary).
 //
 // MetricGaugeAggregativeFlow uses the "Flow" method to aggregate the statistics (see "Flow" in README.md)
-func (r *Registry) GaugeAggregativeFlow(key string, tags AnyTags) *MetricGaugeAggregativeFlow {
+func (r *Registry) GaugeAggregativeFlow(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeFlow {
 	if IsDisabled() {
 		return (*MetricGaugeAggregativeFlow)(nil)
 	}
@@ -54,7 +54,7 @@ func (r *Registry) GaugeAggregativeFlow(key string, tags AnyTags) *MetricGaugeAg
 		return m.(*MetricGaugeAggregativeFlow)
 	}
 
-	return r.newMetricGaugeAggregativeFlow(key, tags)
+	return r.newMetricGaugeAggregativeFlow(key, tags, opts...)
 }
 
 // ConsiderValue adds a value to the statistics, it's an analog of prometheus' "Observe"
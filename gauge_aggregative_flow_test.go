@@ -1,10 +1,86 @@
 package metrics
 
 import (
+	"errors"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMetricInterfaceOnGaugeAggregativeFlow(t *testing.T) {
 	m := registry.newMetricGaugeAggregativeFlow(``, nil)
 	checkForInfiniteRecursion(m)
 }
+
+func TestAggregativeStatisticsFlowInterpolation(t *testing.T) {
+	stats := newAggregativeStatisticsFlow([]float64{0.5, 0.9})
+	defer stats.Release()
+	stats.ConsiderValue(10)
+	stats.percentileValues[1] = 50
+
+	assert.Equal(t, float64(10), *stats.GetPercentile(0.5))
+	assert.InDelta(t, 30, *stats.GetPercentile(0.7), 1e-9)
+	assert.Equal(t, float64(10), *stats.GetPercentile(0.1))
+	assert.Equal(t, float64(50), *stats.GetPercentile(0.99))
+
+	empty := newAggregativeStatisticsFlow(nil)
+	defer empty.Release()
+	assert.Nil(t, empty.GetPercentile(0.5))
+}
+
+func TestFlowPercentiles(t *testing.T) {
+	r := New()
+	defer r.Reset()
+
+	percentiles := []float64{0.999, 0.5, 0.75, 0.9, 0.95, 0.99}
+	metric := r.GaugeAggregativeFlow(`flow`, nil, WithPercentiles(percentiles...))
+	for i := 0; i < 1000; i++ {
+		metric.doConsiderValue(float64(i % 100))
+	}
+	total := metric.GetValuePointers().Total()
+	tracked, values := total.GetDefaultPercentiles()
+	assert.Equal(t, []float64{0.5, 0.75, 0.9, 0.95, 0.99, 0.999}, tracked)
+	assert.Len(t, values, 6)
+	assert.Equal(t, 6, strings.Count(total.String(), `"per`))
+	assert.NotNil(t, total.GetPercentile(0.8))
+
+	assert.True(t, errors.Is(ValidatePercentiles([]float64{0.5, 1.5}), ErrInvalidPercentiles))
+	assert.Panics(t, func() {
+		r.SetDefaultPercentiles([]float64{0.5, 1.5})
+	})
+	assert.Equal(t, defaultFlowPercentiles, r.GetDefaultPercentiles())
+	assert.NoError(t, ValidatePercentiles([]float64{0.99, 0.5}))
+	r.SetDefaultPercentiles([]float64{0.99, 0.5, 0.75, 0.9, 0.95, 0.999, 0.25})
+	_, values = r.GaugeAggregativeFlow(`default`, nil).GetValuePointers().Total().GetDefaultPercentiles()
+	assert.Len(t, values, 7)
+
+	assert.Panics(t, func() {
+		r.GaugeAggregativeFlow(`invalid`, nil, WithPercentiles(-1))
+	})
+	assert.Panics(t, func() {
+		r.GaugeAggregativeFlow(`empty`, nil, WithPercentiles())
+	})
+	assert.True(t, errors.Is(ValidatePercentiles([]float64{}), ErrInvalidPercentiles))
+	assert.Panics(t, func() {
+		r.SetDefaultPercentiles([]float64{})
+	})
+}
+
+func TestFlowSendPercentiles(t *testing.T) {
+	r := New()
+	defer r.Reset()
+
+	metric := r.GaugeAggregativeFlow(`flow`, nil, WithPercentiles(0.5, 0.999))
+	metric.doConsiderValue(1)
+	sender := &testSender{}
+	metric.Send(sender)
+
+	sent := map[string]bool{}
+	for _, record := range sender.records {
+		sent[strings.TrimPrefix(record.key, string(metric.GetKey())+`_total_`)] = true
+	}
+	assert.True(t, sent[`per50`])
+	assert.True(t, sent[`per99.9`])
+	assert.False(t, sent[`per99`])
+}
@@ -8,14 +8,14 @@ type MetricGaugeAggregativeSimple struct {
 	commonAggregativeSimple
 }
 
-func (r *Registry) newMetricGaugeAggregativeSimple(key string, tags AnyTags) *MetricGaugeAggregativeSimple {
+func (r *Registry) newMetricGaugeAggregativeSimple(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeSimple {
 	metric := metricGaugeAggregativeSimplePool.Get().(*MetricGaugeAggregativeSimple)
-	metric.init(r, key, tags)
+	metric.init(r, key, tags, opts...)
 	return metric
 }
 
-func (m *MetricGaugeAggregativeSimple) init(r *Registry, key string, tags AnyTags) {
-	m.commonAggregativeSimple.init(r, m, key, tags)
+func (m *MetricGaugeAggregativeSimple) init(r *Registry, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregativeSimple.init(r, m, key, tags, opts...)
 }
 
 // GaugeAggregativeSimple returns a metric of type "MetricGaugeAggregativeSimple".
@@ -29,11 +29,11 @@ func (m *MetricGaugeAggregativeSimple) init(r *Registry, key string, tags AnyTag
 // It's an analog of prometheus' "Summary" (see https://prometheus.io/docs/concepts/metric_types/#summary).
 //
 // MetricGaugeAggregativeSimple uses the "Simple" method to aggregate the statistics (see "Simple" in README.md)
-func GaugeAggregativeSimple(key string, tags AnyTags) *MetricGaugeAggregativeSimple {
-	return registry.GaugeAggregativeSimple(key, tags)
+func GaugeAggregativeSimple(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeSimple {
+	return registry.GaugeAggregativeSimple(key, tags, opts...)
 }
 
-func (r *Registry) GaugeAggregativeSimple(key string, tags AnyTags) *MetricGaugeAggregativeSimple {
+func (r *Registry) GaugeAggregativeSimple(key string, tags AnyTags, opts ...AggregativeOption) *MetricGaugeAggregativeSimple {
 	if IsDisabled() {
 		return (*MetricGaugeAggregativeSimple)(nil)
 	}
@@ -43,7 +43,7 @@ func (r *Registry) GaugeAggregativeSimple(key string, tags AnyTags) *MetricGauge
 		return m.(*MetricGaugeAggregativeSimple)
 	}
 
-	return r.newMetricGaugeAggregativeSimple(key, tags)
+	return r.newMetricGaugeAggregativeSimple(key, tags, opts...)
 }
 
 // ConsiderValue adds a value to the statistics, it's an analog of prometheus' "Observe"
@@ -0,0 +1,229 @@
+// Package graphite implements a metrics.Sender which ships values of metrics to Graphite (Carbon) via the plaintext
+// or the pickle protocol.
+//
+// Tags of a metric are mapped to a dotted path ("prefix.name.value1.value2.1m.avg") or, if option "WithTaggedSeries"
+// is used, to a tagged series of Graphite 1.1 ("prefix.name.1m.avg;key1=value1;key2=value2").
+package graphite
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/trafficstars/metrics"
+)
+
+const (
+	defaultBufferSize    = 100000
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	defaultTimeout       = 5 * time.Second
+)
+
+type config struct {
+	prefix        string
+	tagOrder      []string
+	tagKeys       bool
+	tagged        bool
+	sanitizer     func(string) string
+	pickle        bool
+	bufferSize    int
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	clock         metrics.Clock
+	errorHandler  func(error)
+}
+
+// Option is an option of a Sender (see "NewSender")
+type Option func(cfg *config)
+
+// WithPrefix sets the prefix of paths of all metrics (for example "servers.web1")
+func WithPrefix(prefix string) Option {
+	return func(cfg *config) {
+		cfg.prefix = prefix
+	}
+}
+
+// WithTagOrder sets the order of tags in dotted paths: the tags of the keys go first (in the order of the keys),
+// the rest tags go after them sorted by keys.
+func WithTagOrder(keys ...string) Option {
+	return func(cfg *config) {
+		cfg.tagOrder = append([]string{}, keys...)
+	}
+}
+
+// WithTagKeys makes tags to be mapped to pairs of segments "key.value" in dotted paths (instead of only values)
+func WithTagKeys() Option {
+	return func(cfg *config) {
+		cfg.tagKeys = true
+	}
+}
+
+// WithTaggedSeries makes tags to be mapped to tagged series of Graphite 1.1 ("name;key1=value1;key2=value2")
+// instead of dotted paths
+func WithTaggedSeries() Option {
+	return func(cfg *config) {
+		cfg.tagged = true
+	}
+}
+
+// WithSanitizer sets the function which is applied to every segment of a path and to every tag key and value.
+//
+// The default one replaces every character except letters, digits, "_", "-" and ":" with "_" (see "Sanitize").
+func WithSanitizer(sanitizer func(string) string) Option {
+	return func(cfg *config) {
+		cfg.sanitizer = sanitizer
+	}
+}
+
+// WithPickle makes the Sender to use the pickle protocol (batches of datapoints) instead of the plaintext one
+// (a line per datapoint). Carbon listens for it on port 2004 by default.
+func WithPickle() Option {
+	return func(cfg *config) {
+		cfg.pickle = true
+	}
+}
+
+// WithBufferSize sets the maximal amount of datapoints kept in memory until they are sent (the default one is 100000).
+// If the buffer is full (for example Carbon is not available for a long time) then the oldest datapoints are dropped.
+func WithBufferSize(size int) Option {
+	return func(cfg *config) {
+		cfg.bufferSize = size
+	}
+}
+
+// WithBatchSize sets the maximal amount of datapoints sent by one write (the default one is 500)
+func WithBatchSize(size int) Option {
+	return func(cfg *config) {
+		cfg.batchSize = size
+	}
+}
+
+// WithFlushInterval sets how often buffered datapoints are sent (the default interval is a second). If the interval
+// is zero then datapoints are sent only by "Flush" (and when the buffer reaches the batch size).
+func WithFlushInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.flushInterval = interval
+	}
+}
+
+// WithTimeout sets the timeout of connecting and of writing (the default one is 5 seconds)
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithClock sets the source of timestamps of datapoints (the default one is metrics.RealClock). The clock of
+// the registry should be passed if it was changed (see "Registry.SetClock").
+func WithClock(clock metrics.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = clock
+	}
+}
+
+// WithErrorHandler sets the function to be called on every failure of background sending (for example to log it)
+func WithErrorHandler(handler func(error)) Option {
+	return func(cfg *config) {
+		cfg.errorHandler = handler
+	}
+}
+
+// Sanitize replaces every character except letters, digits, "_", "-" and ":" with "_". It's the default sanitizer
+// (see "WithSanitizer").
+func Sanitize(s string) string {
+	isValid := func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			r == '_' || r == '-' || r == ':'
+	}
+	if strings.IndexFunc(s, func(r rune) bool { return !isValid(r) }) < 0 {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if isValid(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// sanitizeName sanitizes every segment of a dotted name
+func (cfg *config) sanitizeName(name string) string {
+	segments := strings.Split(name, `.`)
+	for idx, segment := range segments {
+		segments[idx] = cfg.sanitizer(segment)
+	}
+	return strings.Join(segments, `.`)
+}
+
+// orderedTags returns tags of the metric in the order of the paths (see "WithTagOrder")
+func (cfg *config) orderedTags(tags *metrics.FastTags) []*metrics.FastTag {
+	if tags == nil {
+		return nil
+	}
+	result := make([]*metrics.FastTag, 0, len(tags.Slice))
+	for _, key := range cfg.tagOrder {
+		for _, tag := range tags.Slice {
+			if tag.Key == key {
+				result = append(result, tag)
+			}
+		}
+	}
+	var rest []*metrics.FastTag
+	for _, tag := range tags.Slice {
+		isOrdered := false
+		for _, key := range cfg.tagOrder {
+			if tag.Key == key {
+				isOrdered = true
+				break
+			}
+		}
+		if !isOrdered {
+			rest = append(rest, tag)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].Key < rest[j].Key })
+	return append(result, rest...)
+}
+
+// path returns the path of the value of the metric sent with the key (see "metrics.Sender"): values of aggregative
+// metrics are sent with keys "<key of the metric>_<label>_<aggregate>", they are mapped to ".<label>.<aggregate>".
+func (cfg *config) path(metric metrics.Metric, key string) string {
+	var path strings.Builder
+	if cfg.prefix != `` {
+		path.WriteString(cfg.prefix)
+		path.WriteByte('.')
+	}
+	path.WriteString(cfg.sanitizeName(metric.GetName()))
+
+	tags := cfg.orderedTags(metric.GetTags())
+	if !cfg.tagged {
+		for _, tag := range tags {
+			if cfg.tagKeys {
+				path.WriteByte('.')
+				path.WriteString(cfg.sanitizer(tag.Key))
+			}
+			path.WriteByte('.')
+			path.WriteString(cfg.sanitizer(tag.StringValue))
+		}
+	}
+
+	if suffix := strings.TrimPrefix(key, string(metric.GetKey())); suffix != key && suffix != `` {
+		for _, segment := range strings.Split(strings.TrimPrefix(suffix, `_`), `_`) {
+			path.WriteByte('.')
+			path.WriteString(cfg.sanitizer(segment))
+		}
+	}
+
+	if cfg.tagged {
+		sort.SliceStable(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+		for _, tag := range tags {
+			path.WriteByte(';')
+			path.WriteString(cfg.sanitizer(tag.Key))
+			path.WriteByte('=')
+			path.WriteString(cfg.sanitizer(tag.StringValue))
+		}
+	}
+	return path.String()
+}
@@ -0,0 +1,197 @@
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trafficstars/metrics"
+)
+
+var testNow = time.Unix(1600000000, 0)
+
+// listenCarbon starts a TCP listener which passes every received line (or pickle message) to the returned channel
+func listenCarbon(t *testing.T, address string, isPickle bool) (net.Listener, <-chan string) {
+	listener, err := net.Listen(`tcp`, address)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	received := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					if !isPickle {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						received <- line
+						continue
+					}
+					var size uint32
+					if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+						return
+					}
+					message := make([]byte, size)
+					if _, err := io.ReadFull(reader, message); err != nil {
+						return
+					}
+					received <- string(message)
+				}
+			}()
+		}
+	}()
+	return listener, received
+}
+
+func receive(t *testing.T, received <-chan string, count int) (result []string) {
+	for i := 0; i < count; i++ {
+		select {
+		case line := <-received:
+			result = append(result, line)
+		case <-time.After(time.Second):
+			t.Fatalf("received only %d lines", len(result))
+		}
+	}
+	return
+}
+
+func TestSenderPlaintext(t *testing.T) {
+	listener, received := listenCarbon(t, `127.0.0.1:0`, false)
+	defer listener.Close()
+
+	r, _ := metrics.NewManualRegistry(testNow)
+	defer r.Reset()
+	sender := NewSender(listener.Addr().String(),
+		WithPrefix(`servers.web1`),
+		WithTagOrder(`service`),
+		WithFlushInterval(0),
+		WithClock(metrics.NewManualClock(testNow)),
+	)
+	defer sender.Close()
+
+	r.Count(`http.requests`, metrics.Tags{`method`: `GET`, `service`: `api/v1`}).Add(-3)
+	r.Count(`http.requests`, metrics.Tags{`method`: `GET`, `service`: `api/v1`}).Send(sender)
+	r.GaugeFloat64(`temperature`, nil).Set(36.6)
+	r.GaugeFloat64(`temperature`, nil).Send(sender)
+	assert.NoError(t, sender.Flush())
+	assert.Equal(t, []string{
+		"servers.web1.http.requests.api_v1.GET -3 1600000000\n",
+		"servers.web1.temperature 36.6 1600000000\n",
+	}, receive(t, received, 2))
+
+	// values of aggregative metrics
+	load := r.GaugeAggregativeSimple(`load`, metrics.Tags{`host`: `db1`})
+	load.ConsiderValue(5)
+	load.Send(sender)
+	assert.NoError(t, sender.Flush())
+	labelsCount := 0
+	load.EachAggregativeValue(func(string, *metrics.AggregativeValue) bool {
+		labelsCount++
+		return true
+	})
+	lines := receive(t, received, labelsCount*6)
+	assert.Equal(t, "servers.web1.load.db1.last.count 1 1600000000\n", lines[0])
+	assert.Equal(t, "servers.web1.load.db1.last.avg 5 1600000000\n", lines[2])
+
+	// keys of tags
+	keysSender := NewSender(listener.Addr().String(), WithTagKeys(), WithFlushInterval(0), WithBatchSize(1))
+	defer keysSender.Close()
+	r.GaugeInt64(`connections`, metrics.Tags{`b`: 2, `a`: `x.y`}).Set(-1)
+	r.GaugeInt64(`connections`, metrics.Tags{`b`: 2, `a`: `x.y`}).Send(keysSender)
+	line := receive(t, received, 1)[0]
+	assert.Regexp(t, `^connections\.a\.x_y\.b\.2 -1 \d+\n$`, line)
+}
+
+func TestSenderTaggedSeries(t *testing.T) {
+	listener, received := listenCarbon(t, `127.0.0.1:0`, false)
+	defer listener.Close()
+
+	r, _ := metrics.NewManualRegistry(testNow)
+	defer r.Reset()
+	sender := NewSender(listener.Addr().String(),
+		WithTaggedSeries(),
+		WithTagOrder(`service`),
+		WithFlushInterval(0),
+		WithClock(metrics.NewManualClock(testNow)),
+	)
+	defer sender.Close()
+
+	r.Count(`requests`, metrics.Tags{`service`: `api`, `method`: `GET`}).Add(5)
+	r.Count(`requests`, metrics.Tags{`service`: `api`, `method`: `GET`}).Send(sender)
+	r.GaugeAggregativeSimple(`load`, nil).ConsiderValue(5)
+	r.GaugeAggregativeSimple(`load`, nil).Send(sender)
+	assert.NoError(t, sender.Flush())
+	lines := receive(t, received, 2)
+	assert.Equal(t, "requests;method=GET;service=api 5 1600000000\n", lines[0])
+	assert.Equal(t, "load.last.count 1 1600000000\n", lines[1])
+}
+
+func TestSenderPickle(t *testing.T) {
+	listener, received := listenCarbon(t, `127.0.0.1:0`, true)
+	defer listener.Close()
+
+	r, _ := metrics.NewManualRegistry(testNow)
+	defer r.Reset()
+	sender := NewSender(listener.Addr().String(),
+		WithPickle(),
+		WithBatchSize(2),
+		WithFlushInterval(0),
+		WithClock(metrics.NewManualClock(testNow)),
+	)
+	defer sender.Close()
+
+	for _, name := range []string{`a`, `b`, `c`} {
+		r.GaugeFloat64(name, nil).Set(0.5)
+		r.GaugeFloat64(name, nil).Send(sender)
+	}
+	assert.NoError(t, sender.Flush())
+	messages := receive(t, received, 2)
+
+	// [(u'c', (1600000000, 0.5))]
+	expected := []byte{0x80, 2, ']', '(', 'X', 1, 0, 0, 0, 'c', 0x8a, 8}
+	expected = append(expected, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(expected[len(expected)-8:], uint64(testNow.Unix()))
+	expected = append(expected, 'G', 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(expected[len(expected)-8:], math.Float64bits(0.5))
+	expected = append(expected, 0x86, 0x86, 'e', '.')
+	assert.Equal(t, string(expected), messages[1])
+	assert.Len(t, messages[0], 2*(len(expected)-6)+6)
+}
+
+func TestSenderRetry(t *testing.T) {
+	listener, received := listenCarbon(t, `127.0.0.1:0`, false)
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	r, _ := metrics.NewManualRegistry(testNow)
+	defer r.Reset()
+	sender := NewSender(address, WithBufferSize(2), WithFlushInterval(0), WithClock(metrics.NewManualClock(testNow)))
+	defer sender.Close()
+
+	for _, name := range []string{`a`, `b`, `c`} {
+		r.GaugeInt64(name, nil).Set(1)
+		r.GaugeInt64(name, nil).Send(sender)
+	}
+	assert.Equal(t, uint64(1), sender.GetDroppedCount())
+	assert.Error(t, sender.Flush())
+
+	// the buffered datapoints are sent when Carbon becomes available
+	listener, received = listenCarbon(t, address, false)
+	defer listener.Close()
+	assert.NoError(t, sender.Flush())
+	assert.Equal(t, []string{"b 1 1600000000\n", "c 1 1600000000\n"}, receive(t, received, 2))
+}
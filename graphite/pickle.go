@@ -0,0 +1,61 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// opcodes of the pickle protocol (see "pickletools" of Python) which are required to encode a list of datapoints
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleBinUnicode = 'X'
+	pickleLong1      = 0x8a
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleAppends    = 'e'
+	pickleStop       = '.'
+)
+
+// datapoint is a value of a metric at a moment
+type datapoint struct {
+	path      string
+	value     float64
+	timestamp int64
+}
+
+// appendPlaintext appends the datapoint in the plaintext protocol ("path value timestamp\n")
+func (point *datapoint) appendPlaintext(buf []byte) []byte {
+	buf = append(buf, point.path...)
+	buf = append(buf, ' ')
+	buf = strconv.AppendFloat(buf, point.value, 'g', -1, 64)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, point.timestamp, 10)
+	return append(buf, '\n')
+}
+
+// appendPickle appends a message of the pickle protocol: the length (4 bytes, big-endian) and the pickled list
+// of tuples "(path, (timestamp, value))" (the protocol version 2).
+func appendPickle(buf []byte, points []datapoint) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, pickleProto, 2, pickleEmptyList, pickleMark)
+	for _, point := range points {
+		buf = append(buf, pickleBinUnicode)
+		buf = append(buf, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(buf[len(buf)-4:], uint32(len(point.path)))
+		buf = append(buf, point.path...)
+
+		buf = append(buf, pickleLong1, 8, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint64(buf[len(buf)-8:], uint64(point.timestamp))
+
+		buf = append(buf, pickleBinFloat, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], math.Float64bits(point.value))
+
+		buf = append(buf, pickleTuple2, pickleTuple2)
+	}
+	buf = append(buf, pickleAppends, pickleStop)
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(buf)-start-4))
+	return buf
+}
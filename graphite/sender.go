@@ -0,0 +1,219 @@
+package graphite
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/trafficstars/metrics"
+)
+
+// Sender is a metrics.Sender which ships values of metrics to Graphite (Carbon) over TCP.
+//
+// Values are buffered in memory and sent in batches (see "WithFlushInterval" and "WithBatchSize"). The connection
+// is established on the first sending and reestablished on the next sending after a failure; not sent datapoints
+// are kept in the buffer and retried (see "WithBufferSize").
+type Sender struct {
+	config
+	address string
+
+	bufferLocker sync.Mutex
+	buffer       []datapoint
+	droppedCount uint64
+
+	// sendLocker serializes sendings (and protects the connection)
+	sendLocker sync.Mutex
+	conn       net.Conn
+
+	flushChan chan struct{}
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewSender returns a Sender which ships values to Carbon listening on the TCP address (for example
+// "graphite:2003" for the plaintext protocol or "graphite:2004" for the pickle protocol, see "WithPickle")
+func NewSender(address string, opts ...Option) *Sender {
+	sender := &Sender{
+		config: config{
+			sanitizer:     Sanitize,
+			bufferSize:    defaultBufferSize,
+			batchSize:     defaultBatchSize,
+			flushInterval: defaultFlushInterval,
+			timeout:       defaultTimeout,
+			clock:         metrics.RealClock,
+		},
+		address:   address,
+		flushChan: make(chan struct{}, 1),
+		stopChan:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&sender.config)
+	}
+
+	sender.wg.Add(1)
+	go sender.loop()
+	return sender
+}
+
+// loop sends buffered datapoints every flush interval and when the buffer reaches the batch size
+func (sender *Sender) loop() {
+	defer sender.wg.Done()
+
+	var tickChan <-chan time.Time
+	if sender.flushInterval > 0 {
+		ticker := time.NewTicker(sender.flushInterval)
+		defer ticker.Stop()
+		tickChan = ticker.C
+	}
+	for {
+		select {
+		case <-sender.stopChan:
+			return
+		case <-tickChan:
+		case <-sender.flushChan:
+		}
+		if err := sender.Flush(); err != nil && sender.errorHandler != nil {
+			sender.errorHandler(err)
+		}
+	}
+}
+
+// GetDroppedCount returns the amount of datapoints dropped due to the overflow of the buffer (see "WithBufferSize")
+func (sender *Sender) GetDroppedCount() uint64 {
+	return atomic.LoadUint64(&sender.droppedCount)
+}
+
+// enqueue puts datapoints to the buffer (see "appendPoints") and triggers the sending if a batch is ready
+func (sender *Sender) enqueue(points ...datapoint) {
+	sender.bufferLocker.Lock()
+	sender.appendPoints(points)
+	isBatchReady := len(sender.buffer) >= sender.batchSize
+	sender.bufferLocker.Unlock()
+
+	if isBatchReady {
+		select {
+		case sender.flushChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// requeue puts not sent datapoints back to the head of the buffer. It doesn't trigger the sending, so a failed
+// sending is retried only on the next flush interval.
+func (sender *Sender) requeue(points []datapoint) {
+	sender.bufferLocker.Lock()
+	newPoints := sender.buffer
+	sender.buffer = points
+	sender.appendPoints(newPoints)
+	sender.bufferLocker.Unlock()
+}
+
+// appendPoints appends datapoints to the buffer dropping the oldest ones if it's full. "bufferLocker" should be locked.
+func (sender *Sender) appendPoints(points []datapoint) {
+	sender.buffer = append(sender.buffer, points...)
+	if overflow := len(sender.buffer) - sender.bufferSize; overflow > 0 {
+		sender.buffer = append(sender.buffer[:0], sender.buffer[overflow:]...)
+		atomic.AddUint64(&sender.droppedCount, uint64(overflow))
+	}
+}
+
+// Flush sends all buffered datapoints. Not sent datapoints are kept in the buffer.
+func (sender *Sender) Flush() error {
+	sender.sendLocker.Lock()
+	defer sender.sendLocker.Unlock()
+
+	sender.bufferLocker.Lock()
+	points := sender.buffer
+	sender.buffer = nil
+	sender.bufferLocker.Unlock()
+
+	for len(points) > 0 {
+		batchSize := sender.batchSize
+		if batchSize > len(points) {
+			batchSize = len(points)
+		}
+		if err := sender.write(points[:batchSize]); err != nil {
+			sender.requeue(points)
+			return err
+		}
+		points = points[batchSize:]
+	}
+	return nil
+}
+
+// write sends a batch of datapoints. "sendLocker" should be locked.
+func (sender *Sender) write(points []datapoint) error {
+	var buf []byte
+	if sender.pickle {
+		buf = appendPickle(buf, points)
+	} else {
+		for idx := range points {
+			buf = points[idx].appendPlaintext(buf)
+		}
+	}
+
+	if sender.conn == nil {
+		conn, err := net.DialTimeout(`tcp`, sender.address, sender.timeout)
+		if err != nil {
+			return err
+		}
+		sender.conn = conn
+	}
+	err := sender.conn.SetWriteDeadline(time.Now().Add(sender.timeout))
+	if err == nil {
+		_, err = sender.conn.Write(buf)
+	}
+	if err != nil {
+		// it's unknown how much was received, so the batch will be sent again via a new connection
+		_ = sender.conn.Close()
+		sender.conn = nil
+	}
+	return err
+}
+
+// send buffers a datapoint of the value of the metric
+func (sender *Sender) send(metric metrics.Metric, key string, value float64) error {
+	sender.enqueue(datapoint{
+		path:      sender.path(metric, key),
+		value:     value,
+		timestamp: sender.clock.Now().Unix(),
+	})
+	return nil
+}
+
+// SendInt64 buffers the value to be sent to Graphite (see "metrics.Sender")
+func (sender *Sender) SendInt64(metric metrics.Metric, key string, value int64) error {
+	return sender.send(metric, key, float64(value))
+}
+
+// SendUint64 buffers the value to be sent to Graphite (see "metrics.Sender")
+func (sender *Sender) SendUint64(metric metrics.Metric, key string, value uint64) error {
+	return sender.send(metric, key, float64(int64(value)))
+}
+
+// SendFloat64 buffers the value to be sent to Graphite (see "metrics.Sender")
+func (sender *Sender) SendFloat64(metric metrics.Metric, key string, value float64) error {
+	return sender.send(metric, key, value)
+}
+
+// Close sends buffered datapoints and closes the connection
+func (sender *Sender) Close() error {
+	sender.stopOnce.Do(func() {
+		close(sender.stopChan)
+	})
+	sender.wg.Wait()
+
+	err := sender.Flush()
+
+	sender.sendLocker.Lock()
+	defer sender.sendLocker.Unlock()
+	if sender.conn != nil {
+		if closeErr := sender.conn.Close(); err == nil {
+			err = closeErr
+		}
+		sender.conn = nil
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OnCreateHook is a function to be called before a new metric is registered in a registry (see "AddOnCreateHook").
+//
+// If it returns a non-nil error then the creation is vetoed: the metric is not registered (and not run), so it's
+// not exported, sent or collected by anything.
+type OnCreateHook func(metricType Type, name string, tags *FastTags) error
+
+// OnStopHook is a function to be called after a metric is stopped (see "AddOnStopHook").
+type OnStopHook func(metricType Type, name string, tags *FastTags)
+
+// OnRemoveHook is a function to be called after a metric is removed from a registry by GC or "Reset"
+// (see "AddOnRemoveHook").
+type OnRemoveHook func(metricType Type, name string, tags *FastTags)
+
+// OnSliceHook is a function to be called every time an aggregative metric is sliced (see "AddOnSliceHook").
+//
+// "slice" is the statistics of values considered since the previous slicing. It's owned by the metric, so it
+// shouldn't be modified or retained after the hook returns (use "MergeData" to copy it).
+type OnSliceHook func(metric AggregativeMetric, slice *AggregativeValue)
+
+// registryHooks is a collection of lifecycle hooks of a registry.
+//
+// Hooks are called without the lock of the metric being held, so it's safe to access the metric (or the registry)
+// from a hook. The tags passed to a hook shouldn't be modified or retained after the hook returns
+// (use "ToMap" or "String" to copy them).
+type registryHooks struct {
+	sync.RWMutex
+
+	onCreate []OnCreateHook
+	onStop   []OnStopHook
+	onRemove []OnRemoveHook
+	onSlice  []*OnSliceHook
+}
+
+// AddOnCreateHook adds a hook to be called on every creation of a new metric (a new series) in the registry.
+// It could be used to catch cardinality bugs early or to veto a creation (see "OnCreateHook").
+func (r *Registry) AddOnCreateHook(hook OnCreateHook) {
+	r.hooks.Lock()
+	r.hooks.onCreate = append(r.hooks.onCreate, hook)
+	r.hooks.Unlock()
+}
+
+// AddOnCreateHook adds a hook to be called on every creation of a new metric in the default registry
+// (see "Registry.AddOnCreateHook").
+func AddOnCreateHook(hook OnCreateHook) {
+	registry.AddOnCreateHook(hook)
+}
+
+// AddOnStopHook adds a hook to be called every time a metric of the registry is stopped (including stopping
+// of useless metrics, see "Garbage collection" in README.md).
+func (r *Registry) AddOnStopHook(hook OnStopHook) {
+	r.hooks.Lock()
+	r.hooks.onStop = append(r.hooks.onStop, hook)
+	r.hooks.Unlock()
+}
+
+// AddOnStopHook adds a hook to be called every time a metric of the default registry is stopped
+// (see "Registry.AddOnStopHook").
+func AddOnStopHook(hook OnStopHook) {
+	registry.AddOnStopHook(hook)
+}
+
+// AddOnRemoveHook adds a hook to be called every time a metric is removed from the registry (by "GC" or "Reset").
+func (r *Registry) AddOnRemoveHook(hook OnRemoveHook) {
+	r.hooks.Lock()
+	r.hooks.onRemove = append(r.hooks.onRemove, hook)
+	r.hooks.Unlock()
+}
+
+// AddOnRemoveHook adds a hook to be called every time a metric is removed from the default registry
+// (see "Registry.AddOnRemoveHook").
+func AddOnRemoveHook(hook OnRemoveHook) {
+	registry.AddOnRemoveHook(hook)
+}
+
+// AddOnSliceHook adds a hook to be called every time an aggregative metric of the registry is sliced (see "Slicing"
+// in README.md). It could be used to ship statistics of every slice somewhere else (see "OnSliceHook").
+//
+// The hook is called by the slicer of the metric, so it should be fast.
+//
+// The returned function removes the hook (for example when the shipper of statistics is closed).
+func (r *Registry) AddOnSliceHook(hook OnSliceHook) (remove func()) {
+	// the hooks are identified by the pointer, because functions are not comparable
+	hookPtr := &hook
+	r.hooks.Lock()
+	r.hooks.onSlice = append(r.hooks.onSlice, hookPtr)
+	r.hooks.Unlock()
+
+	return func() {
+		r.hooks.Lock()
+		defer r.hooks.Unlock()
+
+		// copying, because the hooks could be being called concurrently (see "callOnSliceHooks")
+		hooks := make([]*OnSliceHook, 0, len(r.hooks.onSlice))
+		for _, otherHookPtr := range r.hooks.onSlice {
+			if otherHookPtr != hookPtr {
+				hooks = append(hooks, otherHookPtr)
+			}
+		}
+		r.hooks.onSlice = hooks
+	}
+}
+
+// AddOnSliceHook adds a hook to be called every time an aggregative metric of the default registry is sliced
+// (see "Registry.AddOnSliceHook").
+func AddOnSliceHook(hook OnSliceHook) (remove func()) {
+	return registry.AddOnSliceHook(hook)
+}
+
+// RemoveHooks removes all lifecycle hooks of the registry
+func (r *Registry) RemoveHooks() {
+	r.hooks.Lock()
+	r.hooks.onCreate = nil
+	r.hooks.onStop = nil
+	r.hooks.onRemove = nil
+	r.hooks.onSlice = nil
+	r.hooks.Unlock()
+}
+
+// RemoveHooks removes all lifecycle hooks of the default registry
+func RemoveHooks() {
+	registry.RemoveHooks()
+}
+
+func (r *Registry) callOnCreateHooks(metricType Type, name string, tags *FastTags) error {
+	r.hooks.RLock()
+	hooks := r.hooks.onCreate
+	r.hooks.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(metricType, name, tags); err != nil {
+			return fmt.Errorf("%w: %v", ErrCreationVetoed, err)
+		}
+	}
+	return nil
+}
+
+func (r *Registry) callOnStopHooks(metric Metric) {
+	r.hooks.RLock()
+	hooks := r.hooks.onStop
+	r.hooks.RUnlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+	metricType, name, tags := metric.GetType(), metric.GetName(), metric.GetTags()
+	for _, hook := range hooks {
+		hook(metricType, name, tags)
+	}
+}
+
+func (r *Registry) callOnRemoveHooks(metric Metric) {
+	r.hooks.RLock()
+	hooks := r.hooks.onRemove
+	r.hooks.RUnlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+	metricType, name, tags := metric.GetType(), metric.GetName(), metric.GetTags()
+	for _, hook := range hooks {
+		hook(metricType, name, tags)
+	}
+}
+
+func (r *Registry) callOnSliceHooks(metric AggregativeMetric, slice *AggregativeValue) {
+	r.hooks.RLock()
+	hooks := r.hooks.onSlice
+	r.hooks.RUnlock()
+
+	for _, hook := range hooks {
+		(*hook)(metric, slice)
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	r := New()
+	r.SetDefaultIsRan(true)
+	defer r.Reset()
+
+	var created, stopped, removed []string
+	r.AddOnCreateHook(func(metricType Type, name string, tags *FastTags) error {
+		if name == `forbidden` {
+			return errors.New(`forbidden name`)
+		}
+		created = append(created, name+`@`+metricType.String())
+		return nil
+	})
+	r.AddOnStopHook(func(metricType Type, name string, tags *FastTags) {
+		// the lock of the metric is not held, so it's safe to lock it
+		if metric, ok := storageGet(r, metricType, name, tags).(Metric); ok {
+			metric.lock()
+			assert.False(t, metric.IsRunning())
+			metric.unlock()
+		}
+		stopped = append(stopped, name)
+	})
+	r.AddOnRemoveHook(func(metricType Type, name string, tags *FastTags) {
+		removed = append(removed, name+`,`+tags.String())
+	})
+
+	metric := r.Count(`requests`, Tags{`method`: `GET`})
+	assert.Equal(t, metric, r.Count(`requests`, Tags{`method`: `GET`}))
+	r.GaugeAggregativeFlow(`latency`, nil)
+	assert.Equal(t, []string{`requests@count`, `latency@gauge_aggregative_flow`}, created)
+
+	forbidden := r.Count(`forbidden`, nil)
+	assert.False(t, forbidden.IsRunning())
+	assert.Nil(t, r.Get(TypeCount, `forbidden`, nil))
+	forbidden.Increment()
+	assert.Equal(t, int64(1), forbidden.Get())
+
+	metric.Stop()
+	metric.Stop()
+	assert.Equal(t, []string{`requests`}, stopped)
+
+	r.GC()
+	assert.Equal(t, []string{`requests,method=GET`}, removed)
+	assert.Nil(t, storageGet(r, TypeCount, `requests`, Tags{`method`: `GET`}))
+}
+
+func TestOnSliceHook(t *testing.T) {
+	r := New()
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	var slices []uint64
+	r.AddOnSliceHook(func(metric AggregativeMetric, slice *AggregativeValue) {
+		assert.Equal(t, `latency`, metric.GetName())
+		slices = append(slices, slice.Count.Get())
+	})
+	metric := r.GaugeAggregativeSimple(`latency`, nil)
+	metric.ConsiderValue(1)
+	metric.ConsiderValue(2)
+	metric.DoSlice()
+	metric.DoSlice()
+	assert.Equal(t, []uint64{2, 0}, slices)
+
+	// pre-aggregated statistics are considered as the values since the last slicing
+	other := r.GaugeAggregativeSimple(`other`, nil)
+	other.MergeAggregativeValue(metric.GetValuePointers().Total())
+	assert.Equal(t, uint64(2), other.GetValuePointers().Total().Count.Get())
+	assert.Equal(t, 1.5, other.GetValuePointers().Last().Avg.Get())
+	r.RemoveHooks()
+	other.DoSlice()
+	assert.Equal(t, uint64(2), other.GetValuePointers().ByPeriod(0).Count.Get())
+	assert.Len(t, slices, 2)
+}
+
+func TestRemoveOnSliceHook(t *testing.T) {
+	r := New()
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	var first, second int
+	removeFirst := r.AddOnSliceHook(func(metric AggregativeMetric, slice *AggregativeValue) {
+		first++
+	})
+	r.AddOnSliceHook(func(metric AggregativeMetric, slice *AggregativeValue) {
+		second++
+	})
+	metric := r.GaugeAggregativeSimple(`latency`, nil)
+	metric.DoSlice()
+	removeFirst()
+	removeFirst()
+	metric.DoSlice()
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, second)
+}
+
+// storageGet returns the metric stored in the registry without creating it
+func storageGet(r *Registry, metricType Type, key string, tags AnyTags) interface{} {
+	buf := generateStorageKey(metricType, key, tags)
+	defer buf.Release()
+	v, _ := r.storage.GetByBytes(buf.buf.Bytes())
+	return v
+}
@@ -0,0 +1,275 @@
+// Package influxdb implements export of metrics in the InfluxDB line protocol: a dump to an io.Writer (see "Write")
+// and a metrics.Sender which pushes the lines to InfluxDB over HTTP (see "NewSender").
+//
+// The measurement of a line is the name of a metric and the tags are the tags of the metric. A non-aggregative
+// metric is a line with field "value". Every aggregative value of an aggregative metric ("last", "1s", ..., "total")
+// is a line with tag "period" and fields "count", "min", "avg", "max", "sum", "stddev" and "p1", ..., "p99":
+//
+//	latency,handler=index,period=1m count=1200i,min=0.5,avg=3.2,max=50,sum=3840,stddev=1.1,p99=12 1600000000000000000
+package influxdb
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trafficstars/metrics"
+)
+
+const (
+	defaultPeriodTagKey  = `period`
+	defaultFlushInterval = 10 * time.Second
+	defaultTimeout       = 10 * time.Second
+)
+
+type config struct {
+	periodTagKey  string
+	clock         metrics.Clock
+	headers       http.Header
+	httpClient    *http.Client
+	flushInterval time.Duration
+	errorHandler  func(error)
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		periodTagKey:  defaultPeriodTagKey,
+		clock:         metrics.RealClock,
+		headers:       http.Header{},
+		httpClient:    &http.Client{Timeout: defaultTimeout},
+		flushInterval: defaultFlushInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// Option is an option of the export (see "Write" and "NewSender")
+type Option func(cfg *config)
+
+// WithPeriodTagKey sets the key of the tag of the aggregation period of lines of aggregative metrics (the default
+// one is "period")
+func WithPeriodTagKey(key string) Option {
+	return func(cfg *config) {
+		cfg.periodTagKey = key
+	}
+}
+
+// WithClock sets the source of timestamps of lines (the default one is metrics.RealClock). The clock of the registry
+// should be passed if it was changed (see "Registry.SetClock").
+func WithClock(clock metrics.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = clock
+	}
+}
+
+// WithHeader adds a header to push requests (for example "Authorization: Token <token>" for InfluxDB 2)
+func WithHeader(key, value string) Option {
+	return func(cfg *config) {
+		cfg.headers.Add(key, value)
+	}
+}
+
+// WithHTTPClient sets the client to be used for push requests (the default one has a 10 seconds timeout)
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *config) {
+		cfg.httpClient = client
+	}
+}
+
+// WithFlushInterval sets how often the collected lines are pushed (the default interval is 10 seconds). If
+// the interval is zero then lines are pushed only by "Flush".
+func WithFlushInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.flushInterval = interval
+	}
+}
+
+// WithErrorHandler sets the function to be called on every failure of background pushing (for example to log it)
+func WithErrorHandler(handler func(error)) Option {
+	return func(cfg *config) {
+		cfg.errorHandler = handler
+	}
+}
+
+// Write writes all running metrics of the registry to "w" in the line protocol
+func Write(w io.Writer, registry *metrics.Registry, opts ...Option) error {
+	cfg := newConfig(opts)
+	batch := newBatch(&cfg)
+	list := registry.List()
+	for _, metric := range *list {
+		metric.Send(batch)
+	}
+	list.Release()
+	_, err := w.Write(batch.appendLines(nil))
+	return err
+}
+
+// field is a field of a line (the value is already formatted)
+type field struct {
+	key   string
+	value string
+}
+
+// point is a line of the line protocol
+type point struct {
+	measurement string
+	tags        string
+	fields      []field
+	timestamp   int64
+}
+
+// setField sets the value of the field (replacing the previous value if it's set)
+func (p *point) setField(key, value string) {
+	for idx := range p.fields {
+		if p.fields[idx].key == key {
+			p.fields[idx].value = value
+			return
+		}
+	}
+	p.fields = append(p.fields, field{key: key, value: value})
+}
+
+func (p *point) appendLine(buf []byte) []byte {
+	buf = append(buf, p.measurement...)
+	buf = append(buf, p.tags...)
+	for idx, field := range p.fields {
+		if idx == 0 {
+			buf = append(buf, ' ')
+		} else {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, field.key...)
+		buf = append(buf, '=')
+		buf = append(buf, field.value...)
+	}
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, p.timestamp, 10)
+	return append(buf, '\n')
+}
+
+// batch is a metrics.Sender which collects values to lines: all values of the same metric and the same aggregation
+// period are fields of the same line. If a value is sent again then the previous one is replaced.
+type batch struct {
+	cfg    *config
+	points map[string]*point
+
+	// order is keys of "points" in the order of appearance
+	order []string
+}
+
+func newBatch(cfg *config) *batch {
+	return &batch{
+		cfg:    cfg,
+		points: map[string]*point{},
+	}
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
+
+// set sets the value of the metric sent with the key (see "metrics.Sender"): values of aggregative metrics are sent
+// with keys "<key of the metric>_<label>_<aggregate>", they are mapped to field "<aggregate>" of the line of
+// the label.
+func (b *batch) set(metric metrics.Metric, key string, value string) {
+	metricKey := string(metric.GetKey())
+	label, fieldKey := ``, `value`
+	if suffix := strings.TrimPrefix(key, metricKey); suffix != key && suffix != `` {
+		if idx := strings.LastIndexByte(suffix, '_'); idx > 0 {
+			label, fieldKey = strings.TrimPrefix(suffix[:idx], `_`), suffix[idx+1:]
+		}
+		if strings.HasPrefix(fieldKey, `per`) {
+			fieldKey = `p` + strings.TrimPrefix(fieldKey, `per`)
+		}
+	}
+
+	pointKey := metricKey + "\x00" + label
+	p := b.points[pointKey]
+	if p == nil {
+		p = &point{
+			measurement: measurementEscaper.Replace(metric.GetName()),
+			tags:        b.tags(metric.GetTags(), label),
+		}
+		b.points[pointKey] = p
+		b.order = append(b.order, pointKey)
+	}
+	p.timestamp = b.cfg.clock.Now().UnixNano()
+	p.setField(keyEscaper.Replace(fieldKey), value)
+}
+
+// tags returns the tag set of a line (sorted by keys, as it's recommended by InfluxDB)
+func (b *batch) tags(tags *metrics.FastTags, label string) string {
+	type tag struct{ key, value string }
+	var list []tag
+	if tags != nil {
+		for _, t := range tags.Slice {
+			if t.StringValue == `` {
+				// empty tag values are not allowed
+				continue
+			}
+			list = append(list, tag{key: t.Key, value: t.StringValue})
+		}
+	}
+	if label != `` {
+		list = append(list, tag{key: b.cfg.periodTagKey, value: label})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].key < list[j].key })
+
+	var result strings.Builder
+	for _, t := range list {
+		result.WriteByte(',')
+		result.WriteString(keyEscaper.Replace(t.key))
+		result.WriteByte('=')
+		result.WriteString(keyEscaper.Replace(t.value))
+	}
+	return result.String()
+}
+
+// SendInt64 sets the value as an integer field (see "metrics.Sender")
+func (b *batch) SendInt64(metric metrics.Metric, key string, value int64) error {
+	b.set(metric, key, strconv.FormatInt(value, 10)+`i`)
+	return nil
+}
+
+// SendUint64 sets the value as an integer field (see "metrics.Sender")
+func (b *batch) SendUint64(metric metrics.Metric, key string, value uint64) error {
+	return b.SendInt64(metric, key, int64(value))
+}
+
+// SendFloat64 sets the value as a float field (see "metrics.Sender"). NaN and infinite values are skipped, because
+// they are not supported by the line protocol.
+func (b *batch) SendFloat64(metric metrics.Metric, key string, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	b.set(metric, key, strconv.FormatFloat(value, 'g', -1, 64))
+	return nil
+}
+
+// appendLines appends all lines of the batch
+func (b *batch) appendLines(buf []byte) []byte {
+	for _, pointKey := range b.order {
+		buf = b.points[pointKey].appendLine(buf)
+	}
+	return buf
+}
+
+// merge adds lines of the older batch which are missing in the batch (it's used to retry a failed push)
+func (b *batch) merge(older *batch) {
+	var order []string
+	for _, pointKey := range older.order {
+		if _, ok := b.points[pointKey]; ok {
+			continue
+		}
+		b.points[pointKey] = older.points[pointKey]
+		order = append(order, pointKey)
+	}
+	b.order = append(order, b.order...)
+}
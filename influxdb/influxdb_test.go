@@ -0,0 +1,105 @@
+package influxdb
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trafficstars/metrics"
+)
+
+var testNow = time.Unix(1600000000, 0)
+
+func TestWrite(t *testing.T) {
+	r, _ := metrics.NewManualRegistry(testNow)
+	defer r.Reset()
+
+	r.Count(`requests`, metrics.Tags{`handler`: `a b,c`, `method`: `GET`, `empty`: ``}).Add(5)
+	r.GaugeFloat64(`temperature`, nil).Set(36.6)
+	latency := r.GaugeAggregativeBuffered(`latency`, metrics.Tags{`handler`: `index`})
+	for i := 1; i <= 100; i++ {
+		latency.ConsiderValue(float64(i))
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, r, WithClock(metrics.NewManualClock(testNow))))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Contains(t, lines, `requests,handler=a\ b_c,method=GET value=5i 1600000000000000000`)
+	assert.Contains(t, lines, `temperature value=36.6 1600000000000000000`)
+
+	// a line per aggregative value
+	var labels []string
+	latency.EachAggregativeValue(func(label string, value *metrics.AggregativeValue) bool {
+		labels = append(labels, label)
+		return true
+	})
+	assert.Len(t, lines, 2+len(labels))
+	var totalLine string
+	for _, line := range lines {
+		if strings.HasPrefix(line, `latency,handler=index,period=total `) {
+			totalLine = line
+		}
+	}
+	assert.Regexp(t, `^latency,handler=index,period=total count=100i,min=1,avg=50.5,max=100,sum=5050,stddev=[0-9.]+,`+
+		`p1=[0-9.]+,p10=[0-9.]+,p50=[0-9.]+,p90=[0-9.]+,p99=[0-9.]+ 1600000000000000000$`, totalLine)
+}
+
+func TestSender(t *testing.T) {
+	var locker sync.Mutex
+	var bodies []string
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		locker.Lock()
+		defer locker.Unlock()
+		assert.Equal(t, `Token secret`, req.Header.Get(`Authorization`))
+		assert.Equal(t, `app`, req.URL.Query().Get(`bucket`))
+		if failures > 0 {
+			failures--
+			http.Error(w, `unavailable`, http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	r, _ := metrics.NewManualRegistry(testNow)
+	defer r.Reset()
+	sender := NewSender(server.URL+`/api/v2/write?org=o&bucket=app`,
+		WithHeader(`Authorization`, `Token secret`),
+		WithFlushInterval(0),
+		WithPeriodTagKey(`window`),
+		WithClock(metrics.NewManualClock(testNow)),
+	)
+
+	assert.NoError(t, sender.Flush()) // nothing to push
+	count := r.Count(`requests`, nil)
+	count.Add(3)
+	count.Send(sender)
+	load := r.GaugeAggregativeSimple(`load`, nil)
+	load.ConsiderValue(2)
+	load.Send(sender)
+
+	// the failed push is retried, newer values replace older ones
+	err := sender.Flush()
+	assert.True(t, errors.Is(err, ErrUnexpectedStatusCode), err)
+	assert.Contains(t, err.Error(), `unavailable`)
+	count.Add(1)
+	count.Send(sender)
+	assert.NoError(t, sender.Close())
+
+	assert.Len(t, bodies, 1)
+	lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+	assert.Contains(t, lines, `requests value=4i 1600000000000000000`)
+	assert.Contains(t, lines, `load,window=last count=1i,min=2,avg=2,max=2,sum=2,stddev=0 1600000000000000000`)
+	assert.Equal(t, 1, strings.Count(bodies[0], `requests`))
+}
@@ -0,0 +1,133 @@
+package influxdb
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/trafficstars/metrics"
+	"github.com/trafficstars/metrics/internal/httppush"
+)
+
+var (
+	// ErrUnexpectedStatusCode is returned if InfluxDB responded to a push with a non-2xx status code
+	ErrUnexpectedStatusCode = httppush.ErrUnexpectedStatusCode
+
+	// lineProtocolHeaders are the headers of push requests
+	lineProtocolHeaders = http.Header{`Content-Type`: {`text/plain; charset=utf-8`}}
+)
+
+// Sender is a metrics.Sender which pushes values of metrics to InfluxDB over HTTP in the line protocol (see
+// the description of the package).
+//
+// Values are collected to lines and pushed every flush interval (see "WithFlushInterval"). If a push fails then
+// the lines are retried with the next push (unless they are replaced by newer values of the same series).
+type Sender struct {
+	config
+	url string
+
+	batchLocker sync.Mutex
+	batch       *batch
+
+	// pushLocker serializes pushes
+	pushLocker sync.Mutex
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSender returns a Sender which pushes lines to the URL of the write endpoint of InfluxDB (for example
+// "http://influxdb:8086/write?db=app" for InfluxDB 1.x or "http://influxdb:8086/api/v2/write?org=o&bucket=b" for
+// InfluxDB 2.x with "WithHeader(`Authorization`, `Token <token>`)"). Timestamps are in nanoseconds (the default
+// precision).
+func NewSender(url string, opts ...Option) *Sender {
+	sender := &Sender{
+		config:   newConfig(opts),
+		url:      url,
+		stopChan: make(chan struct{}),
+	}
+	sender.batch = newBatch(&sender.config)
+
+	if sender.flushInterval > 0 {
+		sender.wg.Add(1)
+		go sender.loop()
+	}
+	return sender
+}
+
+// loop pushes the collected lines every flush interval
+func (sender *Sender) loop() {
+	defer sender.wg.Done()
+
+	ticker := time.NewTicker(sender.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sender.stopChan:
+			return
+		case <-ticker.C:
+		}
+		if err := sender.Flush(); err != nil && sender.errorHandler != nil {
+			sender.errorHandler(err)
+		}
+	}
+}
+
+// SendInt64 collects the value to be pushed to InfluxDB (see "metrics.Sender")
+func (sender *Sender) SendInt64(metric metrics.Metric, key string, value int64) error {
+	sender.batchLocker.Lock()
+	defer sender.batchLocker.Unlock()
+	return sender.batch.SendInt64(metric, key, value)
+}
+
+// SendUint64 collects the value to be pushed to InfluxDB (see "metrics.Sender")
+func (sender *Sender) SendUint64(metric metrics.Metric, key string, value uint64) error {
+	sender.batchLocker.Lock()
+	defer sender.batchLocker.Unlock()
+	return sender.batch.SendUint64(metric, key, value)
+}
+
+// SendFloat64 collects the value to be pushed to InfluxDB (see "metrics.Sender")
+func (sender *Sender) SendFloat64(metric metrics.Metric, key string, value float64) error {
+	sender.batchLocker.Lock()
+	defer sender.batchLocker.Unlock()
+	return sender.batch.SendFloat64(metric, key, value)
+}
+
+// Flush pushes the collected lines
+func (sender *Sender) Flush() error {
+	sender.pushLocker.Lock()
+	defer sender.pushLocker.Unlock()
+
+	sender.batchLocker.Lock()
+	pushed := sender.batch
+	sender.batch = newBatch(&sender.config)
+	sender.batchLocker.Unlock()
+
+	if len(pushed.order) == 0 {
+		return nil
+	}
+	if err := sender.push(pushed.appendLines(nil)); err != nil {
+		sender.batchLocker.Lock()
+		sender.batch.merge(pushed)
+		sender.batchLocker.Unlock()
+		return err
+	}
+	return nil
+}
+
+// push sends the lines to InfluxDB
+func (sender *Sender) push(body []byte) error {
+	_, err := httppush.Push(sender.httpClient, sender.url, body, sender.headers, lineProtocolHeaders)
+	return err
+}
+
+// Close stops pushing in background and pushes the collected lines
+func (sender *Sender) Close() error {
+	sender.stopOnce.Do(func() {
+		close(sender.stopChan)
+	})
+	sender.wg.Wait()
+	return sender.Flush()
+}
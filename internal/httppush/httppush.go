@@ -0,0 +1,49 @@
+// Package httppush implements pushing of encoded metrics to an HTTP endpoint which is shared by the exporters.
+package httppush
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxMessageSize is the maximal amount of bytes of the body of an error response to be included into the error
+const maxMessageSize = 1024
+
+var (
+	// ErrUnexpectedStatusCode is returned if the endpoint responded to a push with a non-2xx status code
+	ErrUnexpectedStatusCode = errors.New(`unexpected status code`)
+)
+
+// Push posts the body to the URL. The headers are set in the order of arguments (so the latter ones take
+// precedence, for example the content type over the headers configured by a user).
+//
+// It returns the status code of the response (zero if there is no response). A non-2xx status code is returned
+// with ErrUnexpectedStatusCode which contains the beginning of the body of the response.
+func Push(client *http.Client, url string, body []byte, headers ...http.Header) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for _, header := range headers {
+		for key, values := range header {
+			req.Header[key] = values
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+		return resp.StatusCode, fmt.Errorf("%w: %d: %s", ErrUnexpectedStatusCode, resp.StatusCode, bytes.TrimSpace(message))
+	}
+	// reading the body to the end to reuse the connection
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
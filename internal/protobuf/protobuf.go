@@ -0,0 +1,180 @@
+// Package protobuf implements the minimal subset of the Protocol Buffers wire format which is required by
+// the exporters (to avoid a dependency on a protobuf library and on generated code).
+//
+// See https://developers.google.com/protocol-buffers/docs/encoding
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Wire types
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+var (
+	// ErrInvalidData is returned by "Parse" if the data is not a valid protobuf message
+	ErrInvalidData = errors.New(`invalid protobuf data`)
+)
+
+// Encoder appends fields of a message to a buffer.
+//
+// Fields are appended even if they have default values, so the caller should skip them if it's required
+// (it's never required for correctness, but it makes messages smaller).
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the encoded message
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Reset empties the buffer (keeping the allocated memory)
+func (e *Encoder) Reset() {
+	e.buf = e.buf[:0]
+}
+
+func (e *Encoder) appendVarint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *Encoder) appendTag(field int, wireType int) {
+	e.appendVarint(uint64(field)<<3 | uint64(wireType))
+}
+
+// Varint appends a field of types "uint64", "uint32" and enums
+func (e *Encoder) Varint(field int, v uint64) {
+	e.appendTag(field, WireVarint)
+	e.appendVarint(v)
+}
+
+// Int64 appends a field of types "int64" and "int32" (a negative value takes 10 bytes)
+func (e *Encoder) Int64(field int, v int64) {
+	e.Varint(field, uint64(v))
+}
+
+// Bool appends a field of type "bool"
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Varint(field, 1)
+	} else {
+		e.Varint(field, 0)
+	}
+}
+
+// Fixed64 appends a field of types "fixed64" and "sfixed64"
+func (e *Encoder) Fixed64(field int, v uint64) {
+	e.appendTag(field, WireFixed64)
+	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], v)
+}
+
+// Double appends a field of type "double"
+func (e *Encoder) Double(field int, v float64) {
+	e.Fixed64(field, math.Float64bits(v))
+}
+
+// BytesField appends a field of type "bytes"
+func (e *Encoder) BytesField(field int, v []byte) {
+	e.appendTag(field, WireBytes)
+	e.appendVarint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// String appends a field of type "string"
+func (e *Encoder) String(field int, v string) {
+	e.appendTag(field, WireBytes)
+	e.appendVarint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// Message appends an embedded message which fields are appended by function "fn"
+func (e *Encoder) Message(field int, fn func(e *Encoder)) {
+	e.appendTag(field, WireBytes)
+
+	// the length is unknown in advance, so the message is encoded after a placeholder of the maximal length
+	// of the length and then moved
+	lengthPos := len(e.buf)
+	e.buf = append(e.buf, make([]byte, binary.MaxVarintLen64)...)
+	fn(e)
+	messageLen := len(e.buf) - lengthPos - binary.MaxVarintLen64
+
+	var length [binary.MaxVarintLen64]byte
+	lengthLen := binary.PutUvarint(length[:], uint64(messageLen))
+	copy(e.buf[lengthPos:], length[:lengthLen])
+	copy(e.buf[lengthPos+lengthLen:], e.buf[lengthPos+binary.MaxVarintLen64:])
+	e.buf = e.buf[:lengthPos+lengthLen+messageLen]
+}
+
+// Field is a decoded field of a message (see "Parse")
+type Field struct {
+	Number   int
+	WireType int
+
+	// Varint is the value of a field of wire type WireVarint, or the bits of a field of wire types WireFixed64
+	// and WireFixed32
+	Varint uint64
+
+	// Bytes is the value of a field of wire type WireBytes (a string, bytes or an embedded message)
+	Bytes []byte
+}
+
+// Double returns the value of a field of type "double"
+func (field Field) Double() float64 {
+	return math.Float64frombits(field.Varint)
+}
+
+// Parse decodes fields of a message (embedded messages could be decoded by calling Parse for "Bytes")
+func Parse(data []byte) ([]Field, error) {
+	var fields []Field
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, ErrInvalidData
+		}
+		data = data[n:]
+		field := Field{Number: int(tag >> 3), WireType: int(tag & 7)}
+		switch field.WireType {
+		case WireVarint:
+			field.Varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, ErrInvalidData
+			}
+			data = data[n:]
+		case WireFixed64:
+			if len(data) < 8 {
+				return nil, ErrInvalidData
+			}
+			field.Varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case WireFixed32:
+			if len(data) < 4 {
+				return nil, ErrInvalidData
+			}
+			field.Varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case WireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, ErrInvalidData
+			}
+			field.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		default:
+			return nil, ErrInvalidData
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
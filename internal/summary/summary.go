@@ -0,0 +1,81 @@
+// Package summary extracts summaries of aggregative metrics (a count, a sum and quantiles) which are shared by
+// the exporters.
+package summary
+
+import (
+	"math"
+
+	"github.com/trafficstars/metrics"
+)
+
+// Quantile is a value at a quantile
+type Quantile struct {
+	Quantile float64
+	Value    float64
+}
+
+// Summary is a summary of an aggregative metric
+type Summary struct {
+	// Count and Sum are of the aggregative value "total"
+	Count uint64
+	Sum   float64
+
+	// Quantiles are the minimum (quantile 0), the percentiles of the metric (see "metrics.WithPercentiles") and
+	// the maximum (quantile 1) of the aggregative value of the chosen period. Values which are NaN are skipped.
+	Quantiles []Quantile
+
+	// QuantilesPeriod is the label of the aggregative value of the quantiles (it's "total" if the metric has no
+	// chosen period)
+	QuantilesPeriod string
+}
+
+// Get returns the summary of the metric with quantiles of the aggregative value with the label ("1m", "5m", ...,
+// "total", see "EachAggregativeValue"). If the metric has no such aggregation period then "total" is used.
+//
+// It returns false if the metric has no "total" value.
+func Get(metric metrics.AggregativeMetric, quantilesPeriod string) (Summary, bool) {
+	var total, quantilesValue *metrics.AggregativeValue
+	metric.EachAggregativeValue(func(label string, value *metrics.AggregativeValue) bool {
+		switch label {
+		case `total`:
+			total = value
+		case quantilesPeriod:
+			quantilesValue = value
+		}
+		return true
+	})
+	if total == nil {
+		return Summary{}, false
+	}
+	if quantilesValue == nil {
+		quantilesPeriod = `total`
+		quantilesValue = total
+	}
+
+	summary := Summary{
+		Count:           total.Count.Get(),
+		Sum:             total.Sum.Get(),
+		QuantilesPeriod: quantilesPeriod,
+	}
+	if quantilesValue.Count.Get() == 0 {
+		return summary, true
+	}
+
+	addQuantile := func(quantile, value float64) {
+		if math.IsNaN(value) {
+			return
+		}
+		summary.Quantiles = append(summary.Quantiles, Quantile{Quantile: quantile, Value: value})
+	}
+	addQuantile(0, quantilesValue.Min.Get())
+	if quantilesValue.AggregativeStatistics != nil {
+		percentiles, values := quantilesValue.AggregativeStatistics.GetDefaultPercentiles()
+		for idx, percentile := range percentiles {
+			if percentile > 0 && percentile < 1 && idx < len(values) {
+				addQuantile(percentile, values[idx])
+			}
+		}
+	}
+	addQuantile(1, quantilesValue.Max.Get())
+	return summary, true
+}
@@ -4,6 +4,7 @@ package metrics
 // Iterate()-s them in the specified interval
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +25,10 @@ type iterationHandler struct {
 	iterateInterval time.Duration
 	iterators       []iterator
 	stopChan        chan struct{}
+	isStopped       bool
+
+	owner  *iterationHandlersT
+	ticker Ticker
 }
 
 type iterationHandlersT struct {
@@ -31,40 +36,85 @@ type iterationHandlersT struct {
 
 	m             atomicmap.Map
 	routinesCount int64
+	clock         Clock
 	//iterators []*metricIterator
 }
 
 var (
 	iterationHandlers = iterationHandlersT{
-		m: atomicmap.New(),
+		m:     atomicmap.New(),
+		clock: RealClock,
 	}
 )
 
+// newIterationHandlers returns a new collection of iterationHandlers which uses the clock (see "Clock")
+func newIterationHandlers(clock Clock) *iterationHandlersT {
+	return &iterationHandlersT{
+		m:     atomicmap.New(),
+		clock: clock,
+	}
+}
+
 func (iterationHandler *iterationHandler) loop() {
-	ticker := time.NewTicker(iterationHandler.iterateInterval)
+	ticker := iterationHandler.ticker
+	acker, _ := ticker.(tickAcker)
 	for {
 		select {
 		case <-iterationHandler.stopChan:
 			ticker.Stop()
-			atomic.AddInt64(&iterationHandlers.routinesCount, -1)
+			atomic.AddInt64(&iterationHandler.owner.routinesCount, -1)
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 		}
 		iterationHandler.RLock()
 		iterators := iterationHandler.iterators
 		iterationHandler.RUnlock()
 
+		iterationHandler.flushBeforeSlicing(iterators)
 		for _, iterator := range iterators {
 			if !iterator.IsRunning() {
 				continue
 			}
 			iterator.Iterate()
 		}
+
+		if acker != nil {
+			acker.ack()
+		}
 	}
 }
 
+// flushBeforeSlicing processes values of aggregative metrics which are waiting in the queue if there are slicers
+// among the iterators, so the values get to the slices. It's done once per tick (not by every slicer) and the wait is
+// limited by the interval, so a stuck worker doesn't stall the handler.
+func (iterationHandler *iterationHandler) flushBeforeSlicing(iterators []iterator) {
+	hasSlicers := false
+	for _, iterator := range iterators {
+		if _, ok := iterator.(*commonAggregativeSlicer); ok {
+			hasSlicers = true
+			break
+		}
+	}
+	if !hasSlicers {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), iterationHandler.iterateInterval)
+	defer cancel()
+	if iterationHandler.owner.clock == RealClock {
+		flushStaleConsiderValueQueue(ctx, iterationHandler.iterateInterval)
+		return
+	}
+	// the time is controlled manually (most likely in tests), so the slicing should be deterministic
+	_ = flushConsiderValueQueue(ctx)
+}
+
 func (iterationHandler *iterationHandler) start() {
-	atomic.AddInt64(&iterationHandlers.routinesCount, 1)
+	atomic.AddInt64(&iterationHandler.owner.routinesCount, 1)
+
+	// the ticker is created before the goroutine is started, so no tick will be missed by the handler
+	// (it's important for ManualClock)
+	iterationHandler.ticker = newAckedTicker(iterationHandler.owner.clock, iterationHandler.iterateInterval)
 	go func() {
 		iterationHandler.loop()
 	}()
@@ -76,8 +126,10 @@ func (iterationHandler *iterationHandler) stop() {
 	}()
 }
 
-// Add add a metric to the iterationHandler. It will periodically call method Iterate() of the metric
-func (iterationHandler *iterationHandler) Add(iterator iterator) {
+// Add add a metric to the iterationHandler. It will periodically call method Iterate() of the metric.
+//
+// It returns false if the iterationHandler is already stopped (see "stopIdle").
+func (iterationHandler *iterationHandler) Add(iterator iterator) bool {
 	iterationHandler.RLock()
 	iterators := iterationHandler.iterators
 	found := false
@@ -90,19 +142,23 @@ func (iterationHandler *iterationHandler) Add(iterator iterator) {
 	iterationHandler.RUnlock()
 
 	if found {
-		return
+		return true
 	}
 
 	// RLock is preferred over Lock and a real adding is a rare event, so…
 
 	iterationHandler.Lock()
 	defer iterationHandler.Unlock()
+	if iterationHandler.isStopped {
+		return false
+	}
 	for _, curIterator := range iterationHandler.iterators {
 		if curIterator.EqualsTo(iterator) {
-			return
+			return true
 		}
 	}
 	iterationHandler.iterators = append(iterationHandler.iterators, iterator)
+	return true
 }
 
 // Remove removed a metric from the iterationHandler.
@@ -181,6 +237,7 @@ func (iterationHandlers *iterationHandlersT) getOrCreateIterationHandler(iterato
 	}
 
 	iterationHandler = newIterationHandler()
+	iterationHandler.owner = iterationHandlers
 	iterationHandler.iterateInterval = iterator.GetInterval()
 	if iterationHandler.iterateInterval == time.Duration(0) {
 		return nil
@@ -192,8 +249,13 @@ func (iterationHandlers *iterationHandlersT) getOrCreateIterationHandler(iterato
 
 // Add adds a metric to the iterators registry. So it will be called method Iterate() of the metric in the interval returned by metric.GetInterval()
 func (iterators *iterationHandlersT) Add(iterator iterator) {
-	iterationHandler := iterators.getOrCreateIterationHandler(iterator)
-	iterationHandler.Add(iterator)
+	for {
+		iterationHandler := iterators.getOrCreateIterationHandler(iterator)
+		if iterationHandler.Add(iterator) {
+			return
+		}
+		// the handler was stopped concurrently (see "stopIdle"), so a new one should be created
+	}
 }
 
 // Remove removes a metric from the iterators registry (see `(*metricIterators).Add()`).
@@ -201,3 +263,40 @@ func (iterators *iterationHandlersT) Remove(iterator iterator) {
 	iterationHandler := iterators.getIterationHandler(iterator)
 	iterationHandler.Remove(iterator)
 }
+
+// stopIdle stops and removes all iterationHandlers without iterators (metrics).
+//
+// It waits until the goroutines of the handlers exit (or until the context is done).
+func (iterators *iterationHandlersT) stopIdle(ctx context.Context) error {
+	var stopped []*iterationHandler
+
+	iterators.Lock()
+	for _, key := range iterators.m.Keys() {
+		iterationHandlerI, _ := iterators.m.Get(key)
+		if iterationHandlerI == nil {
+			continue
+		}
+		iterationHandler := iterationHandlerI.(*iterationHandler)
+		iterationHandler.Lock()
+		if len(iterationHandler.iterators) == 0 && !iterationHandler.isStopped {
+			iterationHandler.isStopped = true
+			_ = iterators.m.Unset(key)
+			stopped = append(stopped, iterationHandler)
+		}
+		iterationHandler.Unlock()
+	}
+	iterators.Unlock()
+
+	for idx, handler := range stopped {
+		select {
+		case handler.stopChan <- struct{}{}:
+		case <-ctx.Done():
+			// let the rest goroutines exit in background
+			for _, handler := range stopped[idx:] {
+				handler.stop()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
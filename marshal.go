@@ -0,0 +1,583 @@
+package metrics
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// See "Serialization" in README.md
+
+const (
+	// metricStateVersion is the version of the wire format of a MetricState. It should be incremented
+	// on every incompatible change of the format.
+	metricStateVersion = 1
+
+	// maxBinaryBufferSize is the maximal size of a deserialized buffer (or reservoir) of values. It protects from
+	// allocating of huge buffers due to corrupted (or malicious) data.
+	maxBinaryBufferSize = 1000 * defaultBufferSize
+)
+
+// aggregativeStatisticsKind defines the implementation of AggregativeStatistics in the wire format
+type aggregativeStatisticsKind uint8
+
+const (
+	aggregativeStatisticsKindNone = aggregativeStatisticsKind(iota)
+	aggregativeStatisticsKindFlow
+	aggregativeStatisticsKindBuffered
+	aggregativeStatisticsKindDecaying
+)
+
+// binaryEncoder is a helper to write the wire format
+type binaryEncoder struct {
+	buf []byte
+}
+
+func (e *binaryEncoder) putUvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *binaryEncoder) putFloat64(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *binaryEncoder) putFloat64s(vs []float64) {
+	e.putUvarint(uint64(len(vs)))
+	for _, v := range vs {
+		e.putFloat64(v)
+	}
+}
+
+func (e *binaryEncoder) putBytes(b []byte) {
+	e.putUvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *binaryEncoder) putString(s string) {
+	e.putUvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// binaryDecoder is a helper to read the wire format. The first error is remembered and all following reads
+// return zero values, so the error could be checked only once (see "finish").
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binaryDecoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidBinaryData}, args...)...)
+	}
+	d.buf = nil
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("cannot read an integer")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// length reads a length of a sequence of items of size "itemSize" (in bytes) and checks if there's enough data
+func (d *binaryDecoder) length(itemSize int) int {
+	l := d.uvarint()
+	if l > uint64(len(d.buf)/itemSize) {
+		d.fail("length %d is out of the data", l)
+		return 0
+	}
+	return int(l)
+}
+
+func (d *binaryDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 1 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	v := d.buf[0]
+	d.buf = d.buf[1:]
+	return v
+}
+
+func (d *binaryDecoder) float64() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *binaryDecoder) float64s() []float64 {
+	vs := make([]float64, d.length(8))
+	for idx := range vs {
+		vs[idx] = d.float64()
+	}
+	return vs
+}
+
+func (d *binaryDecoder) bytes() []byte {
+	l := d.length(1)
+	b := d.buf[:l]
+	d.buf = d.buf[l:]
+	return b
+}
+
+func (d *binaryDecoder) string() string {
+	return string(d.bytes())
+}
+
+// finish returns the first error of reading (if any) and checks that all the data was read
+func (d *binaryDecoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.fail("%d unexpected trailing bytes", len(d.buf))
+	}
+	return d.err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (s *aggregativeStatisticsFlow) MarshalBinary() ([]byte, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	var e binaryEncoder
+	e.putUvarint(s.tickID)
+	e.putFloat64s(s.percentiles)
+	e.putFloat64s(s.percentileValues)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (s *aggregativeStatisticsFlow) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	tickID := d.uvarint()
+	percentiles := d.float64s()
+	percentileValues := d.float64s()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if len(percentiles) != len(percentileValues) {
+		return fmt.Errorf("%w: %d percentiles, but %d values", ErrInvalidBinaryData, len(percentiles), len(percentileValues))
+	}
+	if _, err := normalizePercentiles(percentiles); err != nil {
+		return err
+	}
+	if !sort.Float64sAreSorted(percentiles) {
+		return fmt.Errorf("%w: percentiles are not sorted", ErrInvalidBinaryData)
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.tickID = tickID
+	s.percentiles = percentiles
+	s.percentileValues = percentileValues
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (s *aggregativeStatisticsBuffered) MarshalBinary() ([]byte, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	var e binaryEncoder
+	e.putUvarint(s.tickID)
+	e.putUvarint(uint64(len(s.data)))
+	e.putFloat64s(s.data[:s.filledSize])
+	e.putFloat64s(s.defaultPercentiles)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (s *aggregativeStatisticsBuffered) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	tickID := d.uvarint()
+	size := d.uvarint()
+	values := d.float64s()
+	defaultPercentiles := d.float64s()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if size == 0 || size > maxBinaryBufferSize || uint64(len(values)) > size {
+		return fmt.Errorf("%w: %d values in a buffer of size %d", ErrInvalidBinaryData, len(values), size)
+	}
+	if _, err := normalizePercentiles(defaultPercentiles); err != nil {
+		return err
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if uint64(cap(s.data)) < size {
+		s.data = make(aggregativeBufferItems, size)
+	} else {
+		s.data = s.data[:size]
+	}
+	copy(s.data, values)
+	s.filledSize = uint32(len(values))
+	s.isSorted = false
+	s.tickID = tickID
+	s.defaultPercentiles = defaultPercentiles
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (s *aggregativeStatisticsDecaying) MarshalBinary() ([]byte, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	var e binaryEncoder
+	e.putUvarint(s.tickID)
+	e.putUvarint(uint64(s.size))
+	e.putFloat64(s.alpha)
+	e.putUvarint(uint64(s.landmark.UnixNano()))
+	e.putUvarint(uint64(len(s.samples)))
+	for _, sample := range s.samples {
+		e.putFloat64(sample.value)
+		e.putFloat64(sample.logWeight)
+		e.putFloat64(sample.logPriority)
+	}
+	e.putFloat64(s.logThreshold)
+	e.putFloat64s(s.defaultPercentiles)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+//
+// The clock of the reservoir is the real one, it's used only if values are considered directly by
+// the deserialized reservoir (merging it to a metric uses the clock of the metric).
+func (s *aggregativeStatisticsDecaying) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	tickID := d.uvarint()
+	size := d.uvarint()
+	alpha := d.float64()
+	landmark := time.Unix(0, int64(d.uvarint()))
+	samples := make(decayingSamples, d.length(8*3))
+	for idx := range samples {
+		samples[idx] = decayingSample{
+			value:       d.float64(),
+			logWeight:   d.float64(),
+			logPriority: d.float64(),
+		}
+	}
+	logThreshold := d.float64()
+	defaultPercentiles := d.float64s()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	if math.IsNaN(logThreshold) {
+		return fmt.Errorf("%w: invalid threshold of priorities", ErrInvalidBinaryData)
+	}
+	if size > maxBinaryBufferSize || uint64(len(samples)) > size {
+		return fmt.Errorf("%w: %d samples in a reservoir of size %d", ErrInvalidBinaryData, len(samples), size)
+	}
+	if !(alpha > 0) || math.IsInf(alpha, 0) {
+		return fmt.Errorf("%w: invalid decay rate %v", ErrInvalidBinaryData, alpha)
+	}
+	if _, err := normalizePercentiles(defaultPercentiles); err != nil {
+		return err
+	}
+	heap.Init(&samples)
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.clock == nil {
+		s.clock = RealClock
+	}
+	s.tickID = tickID
+	s.size = int(size)
+	s.alpha = alpha
+	s.landmark = landmark
+	s.samples = samples
+	s.logThreshold = logThreshold
+	s.defaultPercentiles = defaultPercentiles
+	return nil
+}
+
+// marshalAggregativeStatistics returns the kind and the wire format of the statistics
+func marshalAggregativeStatistics(stats AggregativeStatistics) (aggregativeStatisticsKind, []byte, error) {
+	var (
+		kind aggregativeStatisticsKind
+		data []byte
+		err  error
+	)
+	switch stats := stats.(type) {
+	case nil:
+		kind = aggregativeStatisticsKindNone
+	case *aggregativeStatisticsFlow:
+		kind = aggregativeStatisticsKindFlow
+		data, err = stats.MarshalBinary()
+	case *aggregativeStatisticsBuffered:
+		kind = aggregativeStatisticsKindBuffered
+		data, err = stats.MarshalBinary()
+	case *aggregativeStatisticsDecaying:
+		kind = aggregativeStatisticsKindDecaying
+		data, err = stats.MarshalBinary()
+	default:
+		err = fmt.Errorf("%w: unknown aggregative statistics %T", ErrInvalidBinaryData, stats)
+	}
+	return kind, data, err
+}
+
+// unmarshalAggregativeStatistics returns new statistics (as a memory-reuse-aware constructor) of the wire format
+func unmarshalAggregativeStatistics(kind aggregativeStatisticsKind, data []byte) (AggregativeStatistics, error) {
+	var stats interface {
+		AggregativeStatistics
+		UnmarshalBinary([]byte) error
+	}
+	switch kind {
+	case aggregativeStatisticsKindNone:
+		if len(data) != 0 {
+			return nil, fmt.Errorf("%w: unexpected data of empty aggregative statistics", ErrInvalidBinaryData)
+		}
+		return nil, nil
+	case aggregativeStatisticsKindFlow:
+		stats = newAggregativeStatisticsFlow(nil)
+	case aggregativeStatisticsKindBuffered:
+		stats = &aggregativeStatisticsBuffered{}
+	case aggregativeStatisticsKindDecaying:
+		stats = aggregativeStatisticsDecayingPool.Get().(*aggregativeStatisticsDecaying)
+	default:
+		return nil, fmt.Errorf("%w: unknown kind of aggregative statistics %d", ErrInvalidBinaryData, kind)
+	}
+	if err := stats.UnmarshalBinary(data); err != nil {
+		stats.Release()
+		return nil, err
+	}
+	return stats, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The percentile-related statistics (see "AggregativeStatistics")
+// are serialized, too.
+func (aggrV *AggregativeValue) MarshalBinary() ([]byte, error) {
+	kind, statsData, err := marshalAggregativeStatistics(aggrV.AggregativeStatistics)
+	if err != nil {
+		return nil, err
+	}
+
+	var e binaryEncoder
+	e.putUvarint(aggrV.Count.Get())
+	e.putFloat64(aggrV.Min.Get())
+	e.putFloat64(aggrV.Avg.Get())
+	e.putFloat64(aggrV.Max.Get())
+	e.putFloat64(aggrV.Sum.Get())
+	e.putFloat64(aggrV.M2.Get())
+	e.buf = append(e.buf, byte(kind))
+	e.putBytes(statsData)
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The previous percentile-related statistics of the value
+// (if any) is released and replaced by the deserialized one.
+//
+// A deserialized value could be merged to a value of a metric of the same kind (see "MergeData").
+func (aggrV *AggregativeValue) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	count := d.uvarint()
+	min := d.float64()
+	avg := d.float64()
+	max := d.float64()
+	sum := d.float64()
+	m2 := d.float64()
+	kind := aggregativeStatisticsKind(d.byte())
+	statsData := d.bytes()
+	if err := d.finish(); err != nil {
+		return err
+	}
+	stats, err := unmarshalAggregativeStatistics(kind, statsData)
+	if err != nil {
+		return err
+	}
+
+	aggrV.Count.Set(count)
+	aggrV.Min.Set(min)
+	aggrV.Avg.Set(avg)
+	aggrV.Max.Set(max)
+	aggrV.Sum.Set(sum)
+	aggrV.M2.Set(m2)
+	if aggrV.AggregativeStatistics != nil {
+		aggrV.AggregativeStatistics.Release()
+	}
+	aggrV.AggregativeStatistics = stats
+	return nil
+}
+
+// MetricState is a serializable copy of a metric state. It's used to ship aggregated state between processes
+// (for example sidecar aggregation or a handover during a deploy), see "Serialization" in README.md.
+type MetricState struct {
+	Name string
+	Tags Tags
+	Type Type
+
+	// Value is the value of a non-aggregative metric (see "GetFloat64" of "Metric")
+	Value float64
+
+	// AggregativeValues are values of an aggregative metric by labels ("last", "1s", "5s", ..., "total").
+	// It's nil for non-aggregative metrics.
+	AggregativeValues map[string]*AggregativeValue
+}
+
+// NewMetricState returns a copy of the state of the metric
+func NewMetricState(metric Metric) (*MetricState, error) {
+	state := &MetricState{
+		Name: metric.GetName(),
+		Tags: Tags(metric.GetTags().ToMap()),
+		Type: metric.GetType(),
+	}
+
+	aggregativeMetric, ok := metric.(AggregativeMetric)
+	if !ok {
+		state.Value = metric.GetFloat64()
+		return state, nil
+	}
+
+	var err error
+	state.AggregativeValues = map[string]*AggregativeValue{}
+	aggregativeMetric.EachAggregativeValue(func(label string, value *AggregativeValue) bool {
+		var data []byte
+		data, err = value.MarshalBinary()
+		if err != nil {
+			return false
+		}
+		valueCopy := newAggregativeValue()
+		if err = valueCopy.UnmarshalBinary(data); err != nil {
+			valueCopy.Release()
+			return false
+		}
+		state.AggregativeValues[label] = valueCopy
+		return true
+	})
+	if err != nil {
+		state.Release()
+		return nil, err
+	}
+	return state, nil
+}
+
+// Release should be called when the state won't be used anymore (to put the aggregative values into the pool)
+// to reduce pressure on GC.
+func (state *MetricState) Release() {
+	for _, value := range state.AggregativeValues {
+		value.Release()
+	}
+	state.AggregativeValues = nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The wire format is versioned, so a state could be
+// deserialized by a process with a newer version of the package.
+func (state *MetricState) MarshalBinary() ([]byte, error) {
+	e := binaryEncoder{buf: []byte{metricStateVersion}}
+	e.putString(state.Name)
+	e.putUvarint(uint64(state.Type))
+	e.putFloat64(state.Value)
+
+	tagKeys := state.Tags.Keys()
+	sort.Strings(tagKeys)
+	e.putUvarint(uint64(len(tagKeys)))
+	for _, key := range tagKeys {
+		e.putString(key)
+		e.putString(TagValueToString(state.Tags[key]))
+	}
+
+	if state.AggregativeValues == nil {
+		e.buf = append(e.buf, 0)
+		return e.buf, nil
+	}
+	e.buf = append(e.buf, 1)
+	labels := make([]string, 0, len(state.AggregativeValues))
+	for label := range state.AggregativeValues {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	e.putUvarint(uint64(len(labels)))
+	for _, label := range labels {
+		data, err := state.AggregativeValues[label].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		e.putString(label)
+		e.putBytes(data)
+	}
+	return e.buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. Tag values are deserialized as strings.
+//
+// ErrUnsupportedFormatVersion is returned if the data was serialized with an unknown version of the wire format.
+func (state *MetricState) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{buf: data}
+	if version := d.byte(); d.err == nil && version != metricStateVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedFormatVersion, version)
+	}
+	name := d.string()
+	metricType := Type(d.uvarint())
+	value := d.float64()
+
+	tags := Tags{}
+	tagsCount := d.length(2)
+	for i := 0; i < tagsCount; i++ {
+		key := d.string()
+		tags[key] = d.string()
+	}
+
+	var aggregativeValues map[string]*AggregativeValue
+	release := func() {
+		for _, value := range aggregativeValues {
+			value.Release()
+		}
+	}
+	if hasAggregativeValues := d.byte(); hasAggregativeValues != 0 {
+		aggregativeValues = map[string]*AggregativeValue{}
+		valuesCount := d.length(2)
+		for i := 0; i < valuesCount; i++ {
+			label := d.string()
+			valueData := d.bytes()
+			if d.err != nil {
+				break
+			}
+			value := newAggregativeValue()
+			if err := value.UnmarshalBinary(valueData); err != nil {
+				value.Release()
+				release()
+				return err
+			}
+			if previousValue := aggregativeValues[label]; previousValue != nil {
+				previousValue.Release()
+			}
+			aggregativeValues[label] = value
+		}
+	}
+	if err := d.finish(); err != nil {
+		release()
+		return err
+	}
+	if _, ok := typeStrings[metricType]; !ok {
+		release()
+		return fmt.Errorf("%w: unknown metric type %d", ErrInvalidBinaryData, metricType)
+	}
+
+	state.Release()
+	state.Name = name
+	state.Tags = tags
+	state.Type = metricType
+	state.Value = value
+	state.AggregativeValues = aggregativeValues
+	return nil
+}
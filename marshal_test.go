@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregativeValueMarshalBinary(t *testing.T) {
+	r := New()
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	for name, metric := range map[string]interface {
+		AggregativeMetric
+		ConsiderValue(float64)
+		NewAggregativeValue() *AggregativeValue
+	}{
+		`simple`:   r.GaugeAggregativeSimple(`simple`, nil),
+		`flow`:     r.GaugeAggregativeFlow(`flow`, nil),
+		`buffered`: r.GaugeAggregativeBuffered(`buffered`, nil),
+		`decaying`: r.GaugeAggregativeBuffered(`decaying`, nil, WithDecayingReservoir(time.Minute)),
+	} {
+		for i := 1; i <= 100; i++ {
+			metric.ConsiderValue(float64(i))
+		}
+		total := metric.GetValuePointers().Total()
+		data, err := total.MarshalBinary()
+		assert.NoError(t, err, name)
+
+		restored := &AggregativeValue{}
+		assert.NoError(t, restored.UnmarshalBinary(data), name)
+		assert.Equal(t, total.Snapshot(), restored.Snapshot(), name)
+		if total.AggregativeStatistics == nil {
+			assert.Nil(t, restored.AggregativeStatistics, name)
+		} else {
+			assert.IsType(t, total.AggregativeStatistics, restored.AggregativeStatistics, name)
+			assert.Equal(t, total.GetPercentiles([]float64{0.1, 0.5, 0.99}), restored.GetPercentiles([]float64{0.1, 0.5, 0.99}), name)
+		}
+
+		// a deserialized value could be merged to a value of the metric
+		merged := metric.NewAggregativeValue()
+		merged.MergeData(total)
+		merged.MergeData(restored)
+		assert.Equal(t, uint64(200), merged.Count.Get(), name)
+		assert.Equal(t, float64(50.5), merged.Avg.Get(), name)
+		assert.InDelta(t, total.GetVariance(), merged.GetVariance(), 1e-9, name)
+		if merged.AggregativeStatistics != nil {
+			assert.InDelta(t, *total.GetPercentile(0.5), *merged.GetPercentile(0.5), 1, name)
+		}
+		merged.Release()
+		restored.Release()
+	}
+}
+
+func TestMetricStateMarshalBinary(t *testing.T) {
+	r := New()
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	metric := r.TimingBuffered(`latency`, Tags{`handler`: `index`, `code`: 200})
+	for i := 0; i < 10; i++ {
+		metric.ConsiderValue(time.Duration(i) * time.Millisecond)
+	}
+	state, err := NewMetricState(metric)
+	assert.NoError(t, err)
+	defer state.Release()
+	data, err := state.MarshalBinary()
+	assert.NoError(t, err)
+
+	restored := &MetricState{}
+	assert.NoError(t, restored.UnmarshalBinary(data))
+	defer restored.Release()
+	assert.Equal(t, `latency`, restored.Name)
+	assert.Equal(t, Tags{`handler`: `index`, `code`: `200`}, restored.Tags)
+	assert.Equal(t, Type(TypeTimingBuffered), restored.Type)
+	assert.Len(t, restored.AggregativeValues, len(state.AggregativeValues))
+	for label, value := range state.AggregativeValues {
+		assert.Equal(t, value.Snapshot(), restored.AggregativeValues[label].Snapshot(), label)
+	}
+
+	count := r.Count(`requests`, nil)
+	count.Add(5)
+	state, err = NewMetricState(count)
+	assert.NoError(t, err)
+	data, err = state.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, restored.UnmarshalBinary(data))
+	assert.Equal(t, float64(5), restored.Value)
+	assert.Nil(t, restored.AggregativeValues)
+
+	// corrupted data
+	for idx := range data {
+		assert.Error(t, (&MetricState{}).UnmarshalBinary(data[:idx]))
+	}
+	assert.True(t, errors.Is((&MetricState{}).UnmarshalBinary(append(data, 0)), ErrInvalidBinaryData))
+	data[0] = metricStateVersion + 1
+	assert.True(t, errors.Is((&MetricState{}).UnmarshalBinary(data), ErrUnsupportedFormatVersion))
+}
+
+func TestUnmarshalHugeBuffer(t *testing.T) {
+	for _, size := range []uint64{0, maxBinaryBufferSize + 1, math.MaxUint32} {
+		var e binaryEncoder
+		e.putUvarint(0)    // tickID
+		e.putUvarint(size) // size
+		e.putFloat64s(nil)
+		e.putFloat64s(defaultFlowPercentiles)
+		err := (&aggregativeStatisticsBuffered{}).UnmarshalBinary(e.buf)
+		assert.True(t, errors.Is(err, ErrInvalidBinaryData), size)
+	}
+
+	var e binaryEncoder
+	e.putUvarint(0)                   // tickID
+	e.putUvarint(maxBinaryBufferSize) // size
+	e.putFloat64s([]float64{1, 2})
+	e.putFloat64s(defaultFlowPercentiles)
+	stats := &aggregativeStatisticsBuffered{}
+	assert.NoError(t, stats.UnmarshalBinary(e.buf))
+	assert.Len(t, stats.data, maxBinaryBufferSize)
+	assert.Equal(t, uint32(2), stats.filledSize)
+
+	e = binaryEncoder{}
+	e.putUvarint(0)                       // tickID
+	e.putUvarint(maxBinaryBufferSize + 1) // size
+	e.putFloat64(0.1)                     // alpha
+	e.putUvarint(0)                       // landmark
+	e.putUvarint(0)                       // samples
+	e.putFloat64s(defaultFlowPercentiles)
+	err := (&aggregativeStatisticsDecaying{}).UnmarshalBinary(e.buf)
+	assert.True(t, errors.Is(err, ErrInvalidBinaryData))
+}
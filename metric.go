@@ -20,6 +20,9 @@ type Metric interface {
 	IsGCEnabled() bool
 	SetGCEnabled(bool)
 	GetTag(string) interface{}
+	GetDescription() string
+	GetUnit() Unit
+	GetMetricInfo() *MetricInfo
 	Registry() *Registry
 
 	run(time.Duration)
@@ -27,3 +30,12 @@ type Metric interface {
 	lock()
 	unlock()
 }
+
+// AggregativeMetric is an interface of all aggregative metrics (see "Aggregative metrics" in README.md)
+type AggregativeMetric interface {
+	Metric
+
+	GetValuePointers() *AggregativeValues
+	GetAggregationPeriods() []AggregationPeriod
+	EachAggregativeValue(func(label string, value *AggregativeValue) bool)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+// Unit is a unit of metric values (see "MetricInfo")
+type Unit string
+
+const (
+	UnitNone         = Unit(``)
+	UnitNanoseconds  = Unit(`nanoseconds`)
+	UnitMicroseconds = Unit(`microseconds`)
+	UnitMilliseconds = Unit(`milliseconds`)
+	UnitSeconds      = Unit(`seconds`)
+	UnitBytes        = Unit(`bytes`)
+	UnitRatio        = Unit(`ratio`)
+	UnitPercent      = Unit(`percent`)
+)
+
+// String returns the unit as a string
+func (unit Unit) String() string {
+	return string(unit)
+}
+
+// MetricInfo is a description of metrics with the same name (for example the help text for prometheus). It's
+// declared once per metric name (see "SetMetricInfo") and it's shared by all series (tags) of the name.
+type MetricInfo struct {
+	// Description is a human readable description of the metric (like prometheus' HELP)
+	Description string
+
+	// Unit is the unit of metric values (like prometheus' UNIT)
+	Unit Unit
+
+	// Metadata is an arbitrary metadata to be passed to exporters
+	Metadata map[string]string
+}
+
+// SetMetricInfo sets the description, unit and metadata of metrics with the name "name".
+//
+// It affects already created metrics, too.
+func (r *Registry) SetMetricInfo(name string, info MetricInfo) {
+	metadata := make(map[string]string, len(info.Metadata))
+	for k, v := range info.Metadata {
+		metadata[k] = v
+	}
+	info.Metadata = metadata
+	r.metricInfos.Store(name, &info)
+}
+
+// SetMetricInfo sets the description, unit and metadata of metrics with the name "name" of the default registry.
+//
+// It affects already created metrics, too.
+func SetMetricInfo(name string, info MetricInfo) {
+	registry.SetMetricInfo(name, info)
+}
+
+// GetMetricInfo returns the description, unit and metadata of metrics with the name "name" (see "SetMetricInfo").
+//
+// It returns nil if the info wasn't set. The returned value shouldn't be modified.
+func (r *Registry) GetMetricInfo(name string) *MetricInfo {
+	info, _ := r.metricInfos.Load(name)
+	if info == nil {
+		return nil
+	}
+	return info.(*MetricInfo)
+}
+
+// GetMetricInfo returns the description, unit and metadata of metrics with the name "name" of the default registry
+// (see "SetMetricInfo").
+//
+// It returns nil if the info wasn't set. The returned value shouldn't be modified.
+func GetMetricInfo(name string) *MetricInfo {
+	return registry.GetMetricInfo(name)
+}
+
+// RemoveMetricInfo removes the description, unit and metadata of metrics with the name "name"
+func (r *Registry) RemoveMetricInfo(name string) {
+	r.metricInfos.Delete(name)
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricInfo(t *testing.T) {
+	r := New()
+	defer r.Reset()
+
+	metric := r.GaugeInt64(`queue_size`, Tags{`queue`: `a`})
+	assert.Equal(t, ``, metric.GetDescription())
+	assert.Equal(t, UnitNone, metric.GetUnit())
+	assert.Equal(t, UnitNanoseconds, r.TimingSimple(`latency`, nil).GetUnit())
+
+	r.SetMetricInfo(`queue_size`, MetricInfo{
+		Description: `The amount of items in the queue`,
+		Unit:        UnitBytes,
+		Metadata:    map[string]string{`owner`: `team-a`},
+	})
+	assert.Equal(t, `The amount of items in the queue`, metric.GetDescription())
+	assert.Equal(t, UnitBytes, r.GaugeInt64(`queue_size`, Tags{`queue`: `b`}).GetUnit())
+
+	var parsed map[string]interface{}
+	b, err := metric.MarshalJSON()
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &parsed))
+	assert.Equal(t, `The amount of items in the queue`, parsed[`description`])
+	assert.Equal(t, `bytes`, parsed[`unit`])
+	assert.Equal(t, map[string]interface{}{`owner`: `team-a`}, parsed[`metadata`])
+}
@@ -0,0 +1,316 @@
+package otlp
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/trafficstars/metrics"
+	"github.com/trafficstars/metrics/internal/httppush"
+	"github.com/trafficstars/metrics/internal/protobuf"
+	"github.com/trafficstars/metrics/internal/summary"
+)
+
+var (
+	// ErrUnexpectedStatusCode is returned if the collector responded to a push with a non-2xx status code
+	ErrUnexpectedStatusCode = httppush.ErrUnexpectedStatusCode
+
+	// protobufHeaders are the headers of push requests
+	protobufHeaders = http.Header{`Content-Type`: {`application/x-protobuf`}}
+)
+
+// Values of enum "AggregationTemporality"
+const (
+	aggregationTemporalityCumulative = 2
+)
+
+// Exporter pushes metrics of a registry to an OpenTelemetry collector (see the description of the package).
+//
+// All values are cumulative, so a failed push is not retried: the next push contains the actual state anyway.
+type Exporter struct {
+	config
+	registry *metrics.Registry
+	endpoint string
+
+	// locker serializes pushes (and protects "startTimes")
+	locker sync.Mutex
+
+	// startTimes are the times of the first export of series (by the key of a metric), they are used as start times
+	// of cumulative values
+	startTimes map[string]uint64
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewExporter returns an Exporter which pushes metrics of the registry to the OTLP/HTTP endpoint of a collector
+// (for example "http://otel-collector:4318/v1/metrics") every interval (see "WithInterval") of the clock
+// of the registry.
+func NewExporter(registry *metrics.Registry, endpoint string, opts ...Option) *Exporter {
+	exporter := &Exporter{
+		config: config{
+			interval:           defaultInterval,
+			headers:            http.Header{},
+			httpClient:         &http.Client{Timeout: defaultTimeout},
+			resourceAttributes: metrics.Tags{},
+			quantilesPeriod:    `total`,
+		},
+		registry:   registry,
+		endpoint:   endpoint,
+		startTimes: map[string]uint64{},
+		stopChan:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&exporter.config)
+	}
+
+	if exporter.interval > 0 {
+		ticker := registry.GetClock().NewTicker(exporter.interval)
+		exporter.wg.Add(1)
+		go exporter.loop(ticker)
+	}
+	return exporter
+}
+
+// loop pushes metrics on every tick
+func (exporter *Exporter) loop(ticker metrics.Ticker) {
+	defer exporter.wg.Done()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exporter.stopChan:
+			return
+		case <-ticker.C():
+		}
+		if err := exporter.Push(); err != nil && exporter.errorHandler != nil {
+			exporter.errorHandler(err)
+		}
+	}
+}
+
+// Push pushes the current state of the metrics
+func (exporter *Exporter) Push() error {
+	exporter.locker.Lock()
+	defer exporter.locker.Unlock()
+
+	_, err := httppush.Push(exporter.httpClient, exporter.endpoint, exporter.encodeRequest(), exporter.headers,
+		protobufHeaders)
+	return err
+}
+
+// Close stops pushing in background and pushes the metrics for the last time
+func (exporter *Exporter) Close() error {
+	exporter.stopOnce.Do(func() {
+		close(exporter.stopChan)
+	})
+	exporter.wg.Wait()
+	return exporter.Push()
+}
+
+// metricKind is the kind of data of an OTLP metric
+type metricKind int
+
+const (
+	metricKindSum = metricKind(iota)
+	metricKindGauge
+	metricKindSummary
+)
+
+func getMetricKind(metric metrics.Metric) metricKind {
+	switch metric.GetType() {
+	case metrics.TypeCount:
+		return metricKindSum
+	case metrics.TypeGaugeInt64, metrics.TypeGaugeInt64Func, metrics.TypeGaugeFloat64, metrics.TypeGaugeFloat64Func:
+		return metricKindGauge
+	}
+	return metricKindSummary
+}
+
+// metricGroup is the series of an OTLP metric
+type metricGroup struct {
+	name   string
+	kind   metricKind
+	series []metrics.Metric
+}
+
+// encodeRequest returns an encoded "ExportMetricsServiceRequest" with the current state of the metrics.
+// "locker" should be locked.
+func (exporter *Exporter) encodeRequest() []byte {
+	now := uint64(exporter.registry.Now().UnixNano())
+
+	list := exporter.registry.List()
+	defer list.Release()
+
+	// series of the same name (and kind) are data points of the same OTLP metric
+	groups := map[string]*metricGroup{}
+	var groupKeys []string
+	seen := map[string]struct{}{}
+	for _, metric := range *list {
+		kind := getMetricKind(metric)
+		groupKey := fmt.Sprintf("%s\x00%d", metric.GetName(), kind)
+		group := groups[groupKey]
+		if group == nil {
+			group = &metricGroup{name: metric.GetName(), kind: kind}
+			groups[groupKey] = group
+			groupKeys = append(groupKeys, groupKey)
+		}
+		group.series = append(group.series, metric)
+
+		key := string(metric.GetKey())
+		seen[key] = struct{}{}
+		if _, ok := exporter.startTimes[key]; !ok {
+			exporter.startTimes[key] = now
+		}
+	}
+	for key := range exporter.startTimes {
+		if _, ok := seen[key]; !ok {
+			delete(exporter.startTimes, key)
+		}
+	}
+	sort.Strings(groupKeys)
+
+	var e protobuf.Encoder
+	e.Message(1, func(e *protobuf.Encoder) { // ResourceMetrics
+		e.Message(1, func(e *protobuf.Encoder) { // Resource
+			exporter.encodeResourceAttributes(e)
+		})
+		e.Message(2, func(e *protobuf.Encoder) { // ScopeMetrics
+			e.Message(1, func(e *protobuf.Encoder) { // InstrumentationScope
+				e.String(1, scopeName)
+			})
+			for _, groupKey := range groupKeys {
+				group := groups[groupKey]
+				e.Message(2, func(e *protobuf.Encoder) { // Metric
+					exporter.encodeMetric(e, group, now)
+				})
+			}
+		})
+	})
+	return e.Bytes()
+}
+
+// encodeKeyValue encodes a "KeyValue" with a string value
+func encodeKeyValue(e *protobuf.Encoder, key, value string) {
+	e.String(1, key)
+	e.Message(2, func(e *protobuf.Encoder) { // AnyValue
+		e.String(1, value)
+	})
+}
+
+// encodeResourceAttributes encodes the default tags and the attributes of option "WithResourceAttributes"
+func (exporter *Exporter) encodeResourceAttributes(e *protobuf.Encoder) {
+	attributes := map[string]string{}
+	metrics.GetDefaultTags().Each(func(key string, value interface{}) bool {
+		attributes[key] = metrics.TagValueToString(value)
+		return true
+	})
+	for key, value := range exporter.resourceAttributes {
+		attributes[key] = metrics.TagValueToString(value)
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.Message(1, func(e *protobuf.Encoder) {
+			encodeKeyValue(e, key, attributes[key])
+		})
+	}
+}
+
+// encodeAttributes encodes tags of the metric (except the default tags, they are attributes of the resource)
+func encodeAttributes(e *protobuf.Encoder, metric metrics.Metric) {
+	tags := metric.GetTags()
+	if tags == nil {
+		return
+	}
+	defaultTags := metrics.GetDefaultTags()
+	for _, tag := range tags.Slice {
+		if defaultTags.IsSet(tag.Key) {
+			continue
+		}
+		e.Message(7, func(e *protobuf.Encoder) {
+			encodeKeyValue(e, tag.Key, tag.StringValue)
+		})
+	}
+}
+
+// encodeMetric encodes a "Metric" with data points of all series of the group
+func (exporter *Exporter) encodeMetric(e *protobuf.Encoder, group *metricGroup, now uint64) {
+	e.String(1, group.name)
+	first := group.series[0]
+	if description := first.GetDescription(); description != `` {
+		e.String(2, description)
+	}
+	if unit := unitUCUM(first.GetUnit()); unit != `` {
+		e.String(3, unit)
+	}
+
+	switch group.kind {
+	case metricKindSum:
+		e.Message(7, func(e *protobuf.Encoder) { // Sum
+			for _, metric := range group.series {
+				e.Message(1, func(e *protobuf.Encoder) {
+					exporter.encodeNumberDataPoint(e, metric, now)
+				})
+			}
+			e.Varint(2, aggregationTemporalityCumulative)
+			e.Bool(3, true)
+		})
+	case metricKindGauge:
+		e.Message(5, func(e *protobuf.Encoder) { // Gauge
+			for _, metric := range group.series {
+				e.Message(1, func(e *protobuf.Encoder) {
+					exporter.encodeNumberDataPoint(e, metric, now)
+				})
+			}
+		})
+	case metricKindSummary:
+		e.Message(11, func(e *protobuf.Encoder) { // Summary
+			for _, metric := range group.series {
+				aggregativeMetric, ok := metric.(metrics.AggregativeMetric)
+				if !ok {
+					continue
+				}
+				e.Message(1, func(e *protobuf.Encoder) {
+					exporter.encodeSummaryDataPoint(e, aggregativeMetric, now)
+				})
+			}
+		})
+	}
+}
+
+// encodeNumberDataPoint encodes a "NumberDataPoint" of a non-aggregative metric
+func (exporter *Exporter) encodeNumberDataPoint(e *protobuf.Encoder, metric metrics.Metric, now uint64) {
+	encodeAttributes(e, metric)
+	e.Fixed64(2, exporter.startTimes[string(metric.GetKey())])
+	e.Fixed64(3, now)
+	switch metric := metric.(type) {
+	case interface{ Get() int64 }:
+		e.Fixed64(6, uint64(metric.Get())) // as_int
+	default:
+		e.Double(4, metric.GetFloat64()) // as_double
+	}
+}
+
+// encodeSummaryDataPoint encodes a "SummaryDataPoint" of an aggregative metric
+func (exporter *Exporter) encodeSummaryDataPoint(e *protobuf.Encoder, metric metrics.AggregativeMetric, now uint64) {
+	encodeAttributes(e, metric)
+	e.Fixed64(2, exporter.startTimes[string(metric.GetKey())])
+	e.Fixed64(3, now)
+	metricSummary, ok := summary.Get(metric, exporter.quantilesPeriod)
+	if !ok {
+		return
+	}
+	e.Fixed64(4, metricSummary.Count)
+	e.Double(5, metricSummary.Sum)
+	for _, quantile := range metricSummary.Quantiles {
+		e.Message(6, func(e *protobuf.Encoder) { // ValueAtQuantile
+			e.Double(1, quantile.Quantile)
+			e.Double(2, quantile.Value)
+		})
+	}
+}
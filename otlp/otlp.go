@@ -0,0 +1,110 @@
+// Package otlp implements an exporter of metrics of a registry to an OpenTelemetry collector via OTLP/HTTP
+// (binary protobuf encoding).
+//
+// Metrics are converted to OTLP metrics of the same names:
+//   - "Count" is a monotonic cumulative "Sum";
+//   - gauges are "Gauge";
+//   - aggregative metrics are "Summary": the count and the sum are of value "total", and quantiles (including
+//     0 for the minimum and 1 for the maximum) are of value of the aggregation period chosen by option
+//     "WithQuantilesPeriod" (the percentiles of the metric are used, see "metrics.WithPercentiles"). There are no
+//     histograms with buckets in the package, so "Histogram" is not used.
+//
+// The default tags (see "SetDefaultTags") are attributes of the resource, the rest tags are attributes of data
+// points.
+package otlp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/trafficstars/metrics"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 10 * time.Second
+
+	// scopeName is the name of the instrumentation scope of exported metrics
+	scopeName = `github.com/trafficstars/metrics`
+)
+
+type config struct {
+	interval           time.Duration
+	headers            http.Header
+	httpClient         *http.Client
+	resourceAttributes metrics.Tags
+	quantilesPeriod    string
+	errorHandler       func(error)
+}
+
+// Option is an option of an Exporter (see "NewExporter")
+type Option func(cfg *config)
+
+// WithInterval sets how often metrics are pushed (the default interval is 10 seconds). If the interval is zero then
+// metrics are pushed only by "Push".
+func WithInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.interval = interval
+	}
+}
+
+// WithHeader adds a header to push requests (for example for authentication)
+func WithHeader(key, value string) Option {
+	return func(cfg *config) {
+		cfg.headers.Add(key, value)
+	}
+}
+
+// WithHTTPClient sets the client to be used for push requests (the default one has a 10 seconds timeout)
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *config) {
+		cfg.httpClient = client
+	}
+}
+
+// WithResourceAttributes adds attributes to the resource (in addition to the default tags, for example
+// "service.name")
+func WithResourceAttributes(attributes metrics.Tags) Option {
+	return func(cfg *config) {
+		for key, value := range attributes {
+			cfg.resourceAttributes[key] = value
+		}
+	}
+}
+
+// WithQuantilesPeriod sets the label of the aggregative value ("1m", "5m", ..., "total", see
+// "EachAggregativeValue") which quantiles are exported in summaries (the default one is "total"). If a metric has no
+// such aggregation period then "total" is used.
+func WithQuantilesPeriod(label string) Option {
+	return func(cfg *config) {
+		cfg.quantilesPeriod = label
+	}
+}
+
+// WithErrorHandler sets the function to be called on every failure of background pushing (for example to log it)
+func WithErrorHandler(handler func(error)) Option {
+	return func(cfg *config) {
+		cfg.errorHandler = handler
+	}
+}
+
+// unitUCUM returns the unit in the UCUM notation (which is expected by OpenTelemetry)
+func unitUCUM(unit metrics.Unit) string {
+	switch unit {
+	case metrics.UnitNanoseconds:
+		return `ns`
+	case metrics.UnitMicroseconds:
+		return `us`
+	case metrics.UnitMilliseconds:
+		return `ms`
+	case metrics.UnitSeconds:
+		return `s`
+	case metrics.UnitBytes:
+		return `By`
+	case metrics.UnitRatio:
+		return `1`
+	case metrics.UnitPercent:
+		return `%`
+	}
+	return string(unit)
+}
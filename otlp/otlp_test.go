@@ -0,0 +1,170 @@
+package otlp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trafficstars/metrics"
+	"github.com/trafficstars/metrics/internal/protobuf"
+)
+
+// message is a decoded protobuf message: fields by numbers
+type message map[int][]protobuf.Field
+
+func parse(t *testing.T, data []byte) message {
+	fields, err := protobuf.Parse(data)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	result := message{}
+	for _, field := range fields {
+		result[field.Number] = append(result[field.Number], field)
+	}
+	return result
+}
+
+func (m message) message(t *testing.T, number int) message {
+	if !assert.NotEmpty(t, m[number], number) {
+		t.FailNow()
+	}
+	return parse(t, m[number][0].Bytes)
+}
+
+func (m message) messages(t *testing.T, number int) (result []message) {
+	for _, field := range m[number] {
+		result = append(result, parse(t, field.Bytes))
+	}
+	return
+}
+
+func (m message) string(number int) string {
+	if len(m[number]) == 0 {
+		return ``
+	}
+	return string(m[number][0].Bytes)
+}
+
+// attributes returns "KeyValue"-s of the field as a map
+func (m message) attributes(t *testing.T, number int) map[string]string {
+	result := map[string]string{}
+	for _, keyValue := range m.messages(t, number) {
+		result[keyValue.string(1)] = keyValue.message(t, 2).string(1)
+	}
+	return result
+}
+
+func TestExporter(t *testing.T) {
+	metrics.SetDefaultTags(metrics.Tags{`host`: `web1`})
+	defer metrics.SetDefaultTags(metrics.Tags{})
+
+	var locker sync.Mutex
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, `/v1/metrics`, req.URL.Path)
+		assert.Equal(t, `application/x-protobuf`, req.Header.Get(`Content-Type`))
+		body, _ := ioutil.ReadAll(req.Body)
+		locker.Lock()
+		bodies = append(bodies, body)
+		locker.Unlock()
+	}))
+	defer server.Close()
+
+	now := time.Unix(1600000000, 0)
+	r, clock := metrics.NewManualRegistry(now)
+	defer r.Reset()
+
+	r.SetMetricInfo(`latency`, metrics.MetricInfo{Description: `request latency`})
+	r.Count(`requests`, metrics.Tags{`method`: `GET`, `host`: `web1`}).Add(5)
+	r.GaugeFloat64(`temperature`, nil).Set(36.6)
+	latency := r.TimingBuffered(`latency`, nil, metrics.WithPercentiles(0.5, 0.99))
+	for i := 1; i <= 100; i++ {
+		latency.ConsiderValue(time.Duration(i))
+	}
+
+	exporter := NewExporter(r, server.URL+`/v1/metrics`,
+		WithInterval(time.Minute),
+		WithResourceAttributes(metrics.Tags{`service.name`: `app`}),
+	)
+	clock.Advance(time.Minute)
+	assert.Eventually(t, func() bool {
+		locker.Lock()
+		defer locker.Unlock()
+		return len(bodies) == 1
+	}, time.Second, time.Millisecond)
+	clock.Advance(30 * time.Second)
+	assert.NoError(t, exporter.Close())
+	assert.Len(t, bodies, 2)
+
+	request := parse(t, bodies[0])
+	resourceMetrics := request.message(t, 1)
+	assert.Equal(t, map[string]string{`host`: `web1`, `service.name`: `app`},
+		resourceMetrics.message(t, 1).attributes(t, 1))
+	scopeMetrics := resourceMetrics.message(t, 2)
+	assert.Equal(t, scopeName, scopeMetrics.message(t, 1).string(1))
+
+	metricsByName := map[string]message{}
+	for _, metric := range scopeMetrics.messages(t, 2) {
+		metricsByName[metric.string(1)] = metric
+	}
+	assert.Len(t, metricsByName, 3)
+	pushedAt := uint64(now.Add(time.Minute).UnixNano())
+
+	sum := metricsByName[`requests`].message(t, 7)
+	assert.Equal(t, uint64(aggregationTemporalityCumulative), sum[2][0].Varint)
+	assert.Equal(t, uint64(1), sum[3][0].Varint)
+	point := sum.message(t, 1)
+	assert.Equal(t, map[string]string{`method`: `GET`}, point.attributes(t, 7))
+	assert.Equal(t, pushedAt, point[2][0].Varint)
+	assert.Equal(t, pushedAt, point[3][0].Varint)
+	assert.Equal(t, uint64(5), point[6][0].Varint)
+
+	point = metricsByName[`temperature`].message(t, 5).message(t, 1)
+	assert.Equal(t, 36.6, point[4][0].Double())
+
+	assert.Equal(t, `request latency`, metricsByName[`latency`].string(2))
+	assert.Equal(t, `ns`, metricsByName[`latency`].string(3))
+	point = metricsByName[`latency`].message(t, 11).message(t, 1)
+	assert.Equal(t, uint64(100), point[4][0].Varint)
+	assert.Equal(t, float64(5050), point[5][0].Double())
+	quantiles := map[float64]float64{}
+	for _, quantile := range point.messages(t, 6) {
+		quantiles[quantile[1][0].Double()] = quantile[2][0].Double()
+	}
+	assert.Len(t, quantiles, 4)
+	assert.Equal(t, float64(1), quantiles[0])
+	assert.Equal(t, float64(100), quantiles[1])
+	assert.InDelta(t, 50, quantiles[0.5], 2)
+	assert.InDelta(t, 99, quantiles[0.99], 2)
+
+	// the start time of cumulative values is kept
+	point = nil
+	for _, metric := range parse(t, bodies[1]).message(t, 1).message(t, 2).messages(t, 2) {
+		if metric.string(1) == `requests` {
+			point = metric.message(t, 7).message(t, 1)
+		}
+	}
+	assert.Equal(t, pushedAt, point[2][0].Varint)
+	assert.Equal(t, pushedAt+uint64(30*time.Second), point[3][0].Varint)
+}
+
+func TestExporterFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, `overloaded`, http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	r := metrics.New()
+	defer r.Reset()
+	exporter := NewExporter(r, server.URL, WithInterval(0))
+	err := exporter.Push()
+	assert.True(t, errors.Is(err, ErrUnexpectedStatusCode), err)
+	assert.Contains(t, err.Error(), `overloaded`)
+	assert.Error(t, exporter.Close())
+}
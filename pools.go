@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"bytes"
+	"math/bits"
 	"sync"
 	"sync/atomic"
 )
@@ -112,24 +113,14 @@ var (
 	}
 	aggregativeBufferPool = &sync.Pool{
 		New: func() interface{} {
-			buf := &aggregativeBuffer{}
-			if uint(cap(buf.data)) < bufferSize {
-				buf.data = make(aggregativeBufferItems, bufferSize)
-			} else if uint(len(buf.data)) != bufferSize {
-				buf.data = buf.data[:bufferSize]
+			return &aggregativeBuffer{
+				data: make(aggregativeBufferItems, defaultBufferSize),
 			}
-			return buf
 		},
 	}
-	aggregativeStatisticsBufferedPool = &sync.Pool{
+	aggregativeStatisticsDecayingPool = &sync.Pool{
 		New: func() interface{} {
-			buf := &aggregativeStatisticsBuffered{}
-			if uint(cap(buf.data)) < bufferSize {
-				buf.data = make(aggregativeBufferItems, bufferSize)
-			} else if uint(len(buf.data)) != bufferSize {
-				buf.data = buf.data[:bufferSize]
-			}
-			return buf
+			return &aggregativeStatisticsDecaying{}
 		},
 	}
 	iterationHandlerPool = &sync.Pool{
@@ -182,17 +173,33 @@ func (s *stringSlice) Release() {
 // Release should be called when the buffer won't be used anymore (to put into into the pool of free buffers) to
 // reduce pressure on GC.
 func (s *aggregativeStatisticsBuffered) Release() {
-	if !MemoryReuseEnabled() {
+	if !MemoryReuseEnabled() || cap(s.data) == 0 {
 		return
 	}
 	s.filledSize = 0
 	s.tickID = 0
-	aggregativeStatisticsBufferedPool.Put(s)
+	// the pool of buffers which capacity is at least 2^N, where 2^N is the highest power of two within the capacity
+	aggregativeStatisticsBufferedPools[bits.Len(uint(cap(s.data)))-1].Put(s)
 }
 
-func newAggregativeStatisticsBuffered(defaultPercentiles []float64) *aggregativeStatisticsBuffered {
-	stats := aggregativeStatisticsBufferedPool.Get().(*aggregativeStatisticsBuffered)
+// aggregativeStatisticsBufferedPools are pools of buffers by their capacity: the pool with index N contains buffers
+// of capacity from 2^N to 2^(N+1)-1. Buffers of metrics could be of different sizes (see "WithBufferSize"), so
+// a big buffer shouldn't be reused for a small metric.
+var aggregativeStatisticsBufferedPools [64]sync.Pool
+
+func newAggregativeStatisticsBuffered(defaultPercentiles []float64, size uint) *aggregativeStatisticsBuffered {
+	if size == 0 {
+		size = 1
+	}
+	// the pool of buffers which capacity is at least the lowest power of two which is not less than the size
+	poolIdx := bits.Len(size - 1)
+	stats, _ := aggregativeStatisticsBufferedPools[poolIdx].Get().(*aggregativeStatisticsBuffered)
+	if stats == nil {
+		stats = &aggregativeStatisticsBuffered{}
+		stats.data = make(aggregativeBufferItems, size, 1<<poolIdx)
+	}
 	stats.defaultPercentiles = defaultPercentiles
+	stats.data = stats.data[:size]
 	return stats
 }
 
@@ -216,11 +223,19 @@ func (s *aggregativeStatisticsFlow) Release() {
 	}
 	s.Set(0)
 	s.tickID = 0
+	s.percentiles = nil
 	aggregativeStatisticsFlowPool.Put(s)
 }
 
-func newAggregativeStatisticsFlow() *aggregativeStatisticsFlow {
-	return aggregativeStatisticsFlowPool.Get().(*aggregativeStatisticsFlow)
+func newAggregativeStatisticsFlow(percentiles []float64) *aggregativeStatisticsFlow {
+	s := aggregativeStatisticsFlowPool.Get().(*aggregativeStatisticsFlow)
+	s.percentiles = percentiles
+	if cap(s.percentileValues) < len(percentiles) {
+		s.percentileValues = make([]float64, len(percentiles))
+	} else {
+		s.percentileValues = s.percentileValues[:len(percentiles)]
+	}
+	return s
 }
 
 // Release is an opposite to NewAggregativeValue and it saves the variable to a pool to a prevent memory allocation in future.
@@ -237,6 +252,8 @@ func (v *AggregativeValue) Release() {
 	v.Min.SetFast(0)
 	v.Avg.SetFast(0)
 	v.Max.SetFast(0)
+	v.Sum.SetFast(0)
+	v.M2.SetFast(0)
 
 	if v.AggregativeStatistics != nil {
 		v.AggregativeStatistics.Release()
@@ -0,0 +1,406 @@
+package metrics
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TagMatcher is a condition on a tag value (see "Query.Where")
+type TagMatcher interface {
+	// Match returns true if the tag value satisfies the condition
+	Match(value string) bool
+}
+
+type tagMatcherEqual string
+
+func (m tagMatcherEqual) Match(value string) bool {
+	return string(m) == value
+}
+
+// Equal returns a TagMatcher which matches only the value "value"
+func Equal(value interface{}) TagMatcher {
+	return tagMatcherEqual(TagValueToString(value))
+}
+
+type tagMatcherRegex struct {
+	regexp *regexp.Regexp
+}
+
+func (m tagMatcherRegex) Match(value string) bool {
+	return m.regexp.MatchString(value)
+}
+
+// Regex returns a TagMatcher which matches values by the regular expression "expr".
+//
+// The expression is anchored: it should match the whole value (like in Prometheus), so `Regex("5..")` matches
+// "500", but doesn't match "1500".
+//
+// It panics if the expression cannot be compiled.
+func Regex(expr string) TagMatcher {
+	return tagMatcherRegex{regexp: regexp.MustCompile(`^(?:` + expr + `)$`)}
+}
+
+type tagMatcherIn map[string]struct{}
+
+func (m tagMatcherIn) Match(value string) bool {
+	_, ok := m[value]
+	return ok
+}
+
+// In returns a TagMatcher which matches any of values "values"
+func In(values ...interface{}) TagMatcher {
+	m := make(tagMatcherIn, len(values))
+	for _, value := range values {
+		m[TagValueToString(value)] = struct{}{}
+	}
+	return m
+}
+
+// AggregativeValueGetter is a function to get a value from an aggregative value to be reduced by a Query.
+//
+// If the value cannot be calculated then it should return NaN (such series are skipped by reducers).
+type AggregativeValueGetter func(*AggregativeValue) float64
+
+var (
+	// AggregativeCount is an AggregativeValueGetter which returns the count of considered values
+	AggregativeCount = AggregativeValueGetter(func(v *AggregativeValue) float64 { return float64(v.Count.Get()) })
+
+	// AggregativeMin is an AggregativeValueGetter which returns the minimal considered value
+	AggregativeMin = AggregativeValueGetter(func(v *AggregativeValue) float64 { return v.Min.Get() })
+
+	// AggregativeAvg is an AggregativeValueGetter which returns the average of considered values
+	AggregativeAvg = AggregativeValueGetter(func(v *AggregativeValue) float64 { return v.Avg.Get() })
+
+	// AggregativeMax is an AggregativeValueGetter which returns the maximal considered value
+	AggregativeMax = AggregativeValueGetter(func(v *AggregativeValue) float64 { return v.Max.Get() })
+
+	// AggregativeSum is an AggregativeValueGetter which returns the sum of considered values
+	AggregativeSum = AggregativeValueGetter(func(v *AggregativeValue) float64 { return v.Sum.Get() })
+
+	// AggregativeVariance is an AggregativeValueGetter which returns the variance of considered values
+	AggregativeVariance = AggregativeValueGetter(func(v *AggregativeValue) float64 { return v.GetVariance() })
+
+	// AggregativeStdDev is an AggregativeValueGetter which returns the standard deviation of considered values
+	AggregativeStdDev = AggregativeValueGetter(func(v *AggregativeValue) float64 { return v.GetStdDev() })
+)
+
+// AggregativePercentile returns an AggregativeValueGetter which returns the value of the percentile "percentile"
+// (0.0 .. 1.0).
+func AggregativePercentile(percentile float64) AggregativeValueGetter {
+	return func(v *AggregativeValue) float64 {
+		if v.AggregativeStatistics == nil {
+			return math.NaN()
+		}
+		r := v.AggregativeStatistics.GetPercentile(percentile)
+		if r == nil {
+			return math.NaN()
+		}
+		return *r
+	}
+}
+
+type queryCondition struct {
+	tagKey  string
+	matcher TagMatcher
+}
+
+// Query is a query over metrics of a registry. It selects metrics by name, type and tags, groups them by tags
+// and reduces values of every group (sum, avg, max, min, count).
+//
+// An example:
+//
+//	registry.Query().Name("requests").Where("status", Regex("5..")).SumBy("method")
+type Query struct {
+	registry    *Registry
+	name        *string
+	metricType  *Type
+	conditions  []queryCondition
+	period      string
+	valueGetter AggregativeValueGetter
+}
+
+// Query returns a new query over metrics of the registry
+func (r *Registry) Query() *Query {
+	return &Query{
+		registry:    r,
+		period:      `total`,
+		valueGetter: AggregativeAvg,
+	}
+}
+
+// NewQuery returns a new query over metrics of the default registry
+func NewQuery() *Query {
+	return registry.Query()
+}
+
+// Name selects only metrics with the name "name"
+func (q *Query) Name(name string) *Query {
+	q.name = &name
+	return q
+}
+
+// Type selects only metrics of the type "metricType"
+func (q *Query) Type(metricType Type) *Query {
+	q.metricType = &metricType
+	return q
+}
+
+// Where selects only metrics which has tag "tagKey" with a value matched by "matcher" (see "Equal", "Regex" and "In").
+func (q *Query) Where(tagKey string, matcher TagMatcher) *Query {
+	q.conditions = append(q.conditions, queryCondition{
+		tagKey:  tagKey,
+		matcher: matcher,
+	})
+	return q
+}
+
+// Period selects the aggregative value to be used for aggregative metrics by its label ("last", "1s", "5s", "1m",
+// ..., "total"; see "Slicing" in README.md). The default is "total".
+func (q *Query) Period(label string) *Query {
+	q.period = label
+	return q
+}
+
+// Value defines which value of aggregative metrics should be reduced (see "AggregativeCount", "AggregativeAvg",
+// "AggregativePercentile" and so on). The default is "AggregativeAvg".
+func (q *Query) Value(getter AggregativeValueGetter) *Query {
+	q.valueGetter = getter
+	return q
+}
+
+func (q *Query) isMatched(metric Metric) bool {
+	if q.name != nil && metric.GetName() != *q.name {
+		return false
+	}
+	if q.metricType != nil && metric.GetType() != *q.metricType {
+		return false
+	}
+	for _, condition := range q.conditions {
+		value := metric.GetTag(condition.tagKey)
+		if value == nil {
+			return false
+		}
+		if !condition.matcher.Match(TagValueToString(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Metrics returns all metrics matched by the query
+func (q *Query) Metrics() *Metrics {
+	result := newMetrics()
+	list := q.registry.List()
+	for _, metric := range *list {
+		if !q.isMatched(metric) {
+			continue
+		}
+		*result = append(*result, metric)
+	}
+	list.Release()
+	return result
+}
+
+// QueryGroup is a group of metrics with the same values of "group by" tags (see "QueryResult")
+type QueryGroup struct {
+	// Tags are the values of the "group by" tags of the group
+	Tags Tags
+
+	// Value is the reduced value of the group
+	Value float64
+
+	// Count is the amount of series reduced into the group
+	Count int
+
+	// AggregativeValue is the merge (see "MergeData") of the selected aggregative values of the group.
+	// It's nil if there're no aggregative metrics in the group. It's taken from the pool of free values,
+	// see "QueryResult.Release".
+	AggregativeValue *AggregativeValue
+
+	key string
+}
+
+// QueryResult is the result of reducing of a Query. Groups are sorted by the values of the "group by" tags.
+type QueryResult []*QueryGroup
+
+// Reducer is a function to reduce values of a group (see "Query.ReduceBy")
+type Reducer func(values []float64) float64
+
+var (
+	// ReducerSum is a Reducer which returns the sum of values
+	ReducerSum = Reducer(func(values []float64) (r float64) {
+		for _, v := range values {
+			r += v
+		}
+		return
+	})
+
+	// ReducerAvg is a Reducer which returns the average of values
+	ReducerAvg = Reducer(func(values []float64) float64 {
+		if len(values) == 0 {
+			return math.NaN()
+		}
+		return ReducerSum(values) / float64(len(values))
+	})
+
+	// ReducerMax is a Reducer which returns the maximal value
+	ReducerMax = Reducer(func(values []float64) float64 {
+		r := math.Inf(-1)
+		for _, v := range values {
+			r = math.Max(r, v)
+		}
+		return r
+	})
+
+	// ReducerMin is a Reducer which returns the minimal value
+	ReducerMin = Reducer(func(values []float64) float64 {
+		r := math.Inf(1)
+		for _, v := range values {
+			r = math.Min(r, v)
+		}
+		return r
+	})
+
+	// ReducerCount is a Reducer which returns the amount of values
+	ReducerCount = Reducer(func(values []float64) float64 {
+		return float64(len(values))
+	})
+)
+
+// getValue returns the value of the metric to be reduced and the aggregative value (if the metric is aggregative)
+func (q *Query) getValue(metric Metric) (float64, *AggregativeValue) {
+	aggregativeMetric, ok := metric.(AggregativeMetric)
+	if !ok {
+		return metric.GetFloat64(), nil
+	}
+
+	var result *AggregativeValue
+	aggregativeMetric.EachAggregativeValue(func(label string, value *AggregativeValue) bool {
+		if label != q.period {
+			return true
+		}
+		result = value
+		return false
+	})
+	if result == nil {
+		return math.NaN(), nil
+	}
+	return q.valueGetter(result), result
+}
+
+// ReduceBy groups matched metrics by values of tags "groupByTagKeys" and reduces values of every group using
+// "reducer".
+func (q *Query) ReduceBy(reducer Reducer, groupByTagKeys ...string) QueryResult {
+	groups := map[string]*QueryGroup{}
+	values := map[*QueryGroup][]float64{}
+
+	list := q.Metrics()
+	defer list.Release()
+
+	var keyBuilder strings.Builder
+	for _, metric := range *list {
+		keyBuilder.Reset()
+		for _, tagKey := range groupByTagKeys {
+			keyBuilder.WriteString(tagKey)
+			keyBuilder.WriteString(`=`)
+			keyBuilder.WriteString(TagValueToString(metric.GetTag(tagKey)))
+			keyBuilder.WriteString(`,`)
+		}
+		key := keyBuilder.String()
+
+		group := groups[key]
+		if group == nil {
+			group = &QueryGroup{
+				Tags: Tags{},
+				key:  key,
+			}
+			for _, tagKey := range groupByTagKeys {
+				group.Tags[tagKey] = metric.GetTag(tagKey)
+			}
+			groups[key] = group
+		}
+
+		value, aggregativeValue := q.getValue(metric)
+		if aggregativeValue != nil {
+			group.mergeAggregativeValue(metric, aggregativeValue)
+		}
+		group.Count++
+		if math.IsNaN(value) {
+			continue
+		}
+		values[group] = append(values[group], value)
+	}
+
+	result := make(QueryResult, 0, len(groups))
+	for _, group := range groups {
+		group.Value = reducer(values[group])
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].key < result[j].key
+	})
+	return result
+}
+
+func (group *QueryGroup) mergeAggregativeValue(metric Metric, value *AggregativeValue) {
+	if group.AggregativeValue == nil {
+		group.AggregativeValue = metric.(interface{ NewAggregativeValue() *AggregativeValue }).NewAggregativeValue()
+	}
+	value.LockDo(func(value *AggregativeValue) {
+		group.AggregativeValue.MergeData(value)
+	})
+}
+
+// SumBy groups matched metrics by values of tags "groupByTagKeys" and sums values of every group
+func (q *Query) SumBy(groupByTagKeys ...string) QueryResult {
+	return q.ReduceBy(ReducerSum, groupByTagKeys...)
+}
+
+// AvgBy groups matched metrics by values of tags "groupByTagKeys" and calculates the average value of every group
+func (q *Query) AvgBy(groupByTagKeys ...string) QueryResult {
+	return q.ReduceBy(ReducerAvg, groupByTagKeys...)
+}
+
+// MaxBy groups matched metrics by values of tags "groupByTagKeys" and finds the maximal value of every group
+func (q *Query) MaxBy(groupByTagKeys ...string) QueryResult {
+	return q.ReduceBy(ReducerMax, groupByTagKeys...)
+}
+
+// MinBy groups matched metrics by values of tags "groupByTagKeys" and finds the minimal value of every group
+func (q *Query) MinBy(groupByTagKeys ...string) QueryResult {
+	return q.ReduceBy(ReducerMin, groupByTagKeys...)
+}
+
+// CountBy groups matched metrics by values of tags "groupByTagKeys" and counts series of every group
+func (q *Query) CountBy(groupByTagKeys ...string) QueryResult {
+	return q.ReduceBy(ReducerCount, groupByTagKeys...)
+}
+
+// Release puts the merged aggregative values of the groups (see "QueryGroup.AggregativeValue") to the pool of free
+// values to reduce pressure on GC. The result shouldn't be used after that.
+func (result QueryResult) Release() {
+	for _, group := range result {
+		group.AggregativeValue.Release()
+		group.AggregativeValue = nil
+	}
+}
+
+// Get returns the group with tag values "tags" (only "group by" tags are considered). It returns nil if there's
+// no such group.
+func (result QueryResult) Get(tags Tags) *QueryGroup {
+	for _, group := range result {
+		isMatched := true
+		for k, v := range group.Tags {
+			if TagValueToString(tags[k]) != TagValueToString(v) {
+				isMatched = false
+				break
+			}
+		}
+		if isMatched {
+			return group
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery(t *testing.T) {
+	r := New()
+	defer r.Reset()
+
+	r.Count(`requests`, Tags{`method`: `GET`, `status`: 200}).Add(10)
+	r.Count(`requests`, Tags{`method`: `GET`, `status`: 500}).Add(1)
+	r.Count(`requests`, Tags{`method`: `GET`, `status`: 503}).Add(2)
+	r.Count(`requests`, Tags{`method`: `POST`, `status`: 502}).Add(4)
+	r.Count(`requests`, Tags{`method`: `POST`, `status`: 1500}).Add(8)
+	r.Count(`other`, Tags{`method`: `GET`, `status`: 500}).Add(16)
+
+	result := r.Query().Name(`requests`).Where(`status`, Regex(`5..`)).SumBy(`method`)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, float64(3), result.Get(Tags{`method`: `GET`}).Value)
+		assert.Equal(t, 2, result.Get(Tags{`method`: `GET`}).Count)
+		assert.Equal(t, float64(4), result.Get(Tags{`method`: `POST`}).Value)
+	}
+
+	result = r.Query().Name(`requests`).Where(`status`, In(200, 502)).MaxBy()
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, float64(10), result[0].Value)
+	}
+
+	result = r.Query().Where(`method`, Equal(`GET`)).CountBy()
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, float64(4), result[0].Value)
+	}
+}
+
+func TestQueryAggregative(t *testing.T) {
+	r := New()
+	defer r.Reset()
+
+	r.TimingBuffered(`latency`, Tags{`endpoint`: `a`}).doConsiderValue(1)
+	r.TimingBuffered(`latency`, Tags{`endpoint`: `a`}).doConsiderValue(3)
+	r.TimingBuffered(`latency`, Tags{`endpoint`: `b`}).doConsiderValue(10)
+
+	result := r.Query().Name(`latency`).Value(AggregativeMax).MaxBy()
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, float64(10), result[0].Value)
+		assert.Equal(t, uint64(3), result[0].AggregativeValue.Count.Get())
+		assert.Equal(t, float64(14), result[0].AggregativeValue.Sum.Get())
+		assert.Equal(t, float64(1), result[0].AggregativeValue.Min.Get())
+	}
+	result.Release()
+	assert.Nil(t, result[0].AggregativeValue)
+
+	result = r.Query().Name(`latency`).AvgBy(`endpoint`)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, float64(2), result.Get(Tags{`endpoint`: `a`}).Value)
+		assert.Equal(t, float64(10), result.Get(Tags{`endpoint`: `b`}).Value)
+	}
+}
@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// historyItem is a piece of statistics stored in a history with its position in the time (see
+// "ReconfigureAggregationPeriods")
+type historyItem struct {
+	value *AggregativeValue
+
+	// age is the amount of slicer intervals passed since the end of the piece (0 is the last slice)
+	age uint64
+
+	// duration is the length of the piece (in slicer intervals)
+	duration uint64
+
+	// period is the aggregation period of the history of the piece (in slicer intervals)
+	period uint64
+}
+
+// historySlot returns the index of the element (counting from the current one back in the time) of a history
+// with granularity "granularity" where a value of age "age" should be stored.
+//
+// The current element of a history stores values since the last rotation (which happens every "granularity"
+// slicer intervals, see "sinceHistoryRotation"), and every previous element stores "granularity" slicer intervals.
+func historySlot(sinceRotation, granularity, age uint64) uint64 {
+	if age <= sinceRotation {
+		return 0
+	}
+	return 1 + (age-sinceRotation-1)/granularity
+}
+
+// collectHistoryItems returns the pieces of statistics stored in the histories (from the most recent to the
+// oldest ones).
+//
+// In the default mode the pieces don't overlap (see "nonOverlappingHistoryItems"). In the sliding window mode
+// all the buckets are returned, because the value of every aggregation period is calculated only from the buckets
+// of the period (see "sourceHistoryPeriod").
+func (m *commonAggregative) collectHistoryItems() (items []historyItem) {
+	for hIdx, h := range m.histories.ByPeriod {
+		granularity := m.historyGranularity(m.aggregationPeriods, hIdx)
+		sinceRotation := m.sinceHistoryRotation(granularity)
+		period := m.aggregationPeriods[hIdx].Interval
+
+		offset := h.currentOffset
+		for depth := uint64(0); depth < uint64(len(h.storage)); depth++ {
+			e := h.storage[offset]
+			if e == nil {
+				break
+			}
+			if offset == 0 {
+				offset = uint32(len(h.storage))
+			}
+			offset--
+
+			var item historyItem
+			switch {
+			case depth == 0 && !m.IsSlidingWindow() && hIdx != 0:
+				// in the default mode the current element of a higher period is a sliding value which is always
+				// recalculated from the lower period, so it's not a new data
+				continue
+			case depth == 0:
+				item = historyItem{value: e, age: 0, duration: sinceRotation + 1, period: period}
+			default:
+				item = historyItem{value: e, age: sinceRotation + 1 + (depth-1)*granularity, duration: granularity, period: period}
+			}
+			items = append(items, item)
+		}
+	}
+	if !m.IsSlidingWindow() {
+		items = nonOverlappingHistoryItems(items)
+	}
+	return
+}
+
+// nonOverlappingHistoryItems returns the pieces of statistics without overlaps: the most detailed data is preferred,
+// so a piece of a higher period is taken only if it's older than all the pieces of lower periods.
+func nonOverlappingHistoryItems(items []historyItem) []historyItem {
+	sorted := make([]historyItem, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].period != sorted[j].period {
+			return sorted[i].period < sorted[j].period
+		}
+		return sorted[i].age < sorted[j].age
+	})
+
+	var covered uint64
+	result := sorted[:0]
+	for _, item := range sorted {
+		if item.age < covered {
+			continue
+		}
+		result = append(result, item)
+		covered = item.age + item.duration
+	}
+	return result
+}
+
+// sourceHistoryPeriod returns the aggregation period of pieces of statistics which should be used to rebuild
+// the history of period "period" in the sliding window mode: the same period if it exists, otherwise the shortest
+// longer one (it covers the whole period), otherwise the longest one.
+func sourceHistoryPeriod(items []historyItem, period uint64) (source uint64) {
+	for _, item := range items {
+		switch {
+		case source == period:
+		case item.period == period:
+			source = period
+		case source < period && item.period > source:
+			source = item.period
+		case source > period && item.period > period && item.period < source:
+			source = item.period
+		}
+	}
+	return
+}
+
+// ReconfigureAggregationPeriods changes aggregation periods (see "Slicing" in README.md) of the running metric
+// without resetting its statistics.
+//
+// Histories of the new periods are rebuilt from the existing data: values of lower periods are merged to
+// values of higher periods and values of the same periods are copied. Only the data which doesn't fit into any
+// history is lost (for example it's impossible to rebuild "1d" if only "1h" is left).
+//
+// Every period should be a multiple of the slicer interval of the metric (see "WithPeriods").
+func (m *commonAggregative) ReconfigureAggregationPeriods(periods ...time.Duration) error {
+	if m == nil {
+		return nil
+	}
+	cfg := aggregativeConfig{
+		periods:        append([]time.Duration{}, periods...),
+		slicerInterval: m.GetSlicerInterval(),
+	}
+	newAggregationPeriods, err := cfg.getAggregationPeriods()
+	if err != nil {
+		return err
+	}
+
+	m.lock()
+	defer m.unlock()
+	m.histories.Lock()
+	defer m.histories.Unlock()
+
+	m.rebuildHistories(newAggregationPeriods, m.collectHistoryItems())
+	return nil
+}
+
+// rebuildHistories replaces the histories and the values of aggregation periods by ones of "newAggregationPeriods"
+// built from the pieces of statistics "items" (see "collectHistoryItems"). The old values are released, while
+// the values of "items" are only merged (so they could be not owned by the metric).
+//
+// Both "lock" of the metric and "histories" should be locked.
+func (m *commonAggregative) rebuildHistories(newAggregationPeriods []AggregationPeriod, items []historyItem) {
+	newHistories := m.newHistories(newAggregationPeriods)
+	for hIdx, hist := range newHistories {
+		granularity := m.historyGranularity(newAggregationPeriods, hIdx)
+		sinceRotation := m.sinceHistoryRotation(granularity)
+		var sourcePeriod uint64
+		if m.IsSlidingWindow() {
+			sourcePeriod = sourceHistoryPeriod(items, newAggregationPeriods[hIdx].Interval)
+		}
+		lastSlot := -1
+		for _, item := range items {
+			if m.IsSlidingWindow() && item.period != sourcePeriod {
+				continue
+			}
+			// the value is placed by its oldest part, so it leaves the history when the oldest part
+			// becomes out of the aggregation period
+			slot := historySlot(sinceRotation, granularity, item.age+item.duration-1)
+			if slot >= uint64(len(hist.storage)) {
+				continue
+			}
+			if !m.IsSlidingWindow() && hIdx != 0 && slot == 0 {
+				// will be recalculated from the lower period (see below)
+				continue
+			}
+			storageIdx := (uint64(len(hist.storage)) - slot) % uint64(len(hist.storage))
+			if hist.storage[storageIdx] == nil {
+				hist.storage[storageIdx] = m.NewAggregativeValue()
+			}
+			hist.storage[storageIdx].MergeData(item.value)
+			if int(slot) > lastSlot {
+				lastSlot = int(slot)
+			}
+		}
+
+		// there should be no gaps, otherwise older values will be ignored (see "calculateValue"); in the default mode
+		// the current elements are set below
+		firstSlot := 1
+		if m.IsSlidingWindow() {
+			firstSlot = 0
+		}
+		for slot := firstSlot; slot <= lastSlot; slot++ {
+			storageIdx := (len(hist.storage) - slot) % len(hist.storage)
+			if hist.storage[storageIdx] == nil {
+				hist.storage[storageIdx] = m.NewAggregativeValue()
+			}
+		}
+	}
+
+	newByPeriod := make([]*AggregativeValue, 0, len(newAggregationPeriods)+1)
+	switch {
+	case m.IsSlidingWindow():
+		// the base value is not stored in histories in the sliding window mode
+		newValue := m.NewAggregativeValue()
+		newValue.MergeData(m.data.ByPeriod(0))
+		newByPeriod = append(newByPeriod, newValue)
+	case newHistories[0].storage[0] != nil:
+		newByPeriod = append(newByPeriod, newHistories[0].storage[0])
+	default:
+		newValue := m.NewAggregativeValue()
+		newHistories[0].storage[0] = newValue
+		newByPeriod = append(newByPeriod, newValue)
+	}
+	for idx := 1; idx <= len(newAggregationPeriods); idx++ {
+		newValue := m.calculateValue(newHistories[idx-1])
+		if newValue == nil {
+			newValue = m.NewAggregativeValue()
+		}
+		if !m.IsSlidingWindow() && idx < len(newHistories) {
+			newHistories[idx].storage[0] = newValue
+		}
+		newByPeriod = append(newByPeriod, newValue)
+	}
+
+	// The same value could be stored in a history and in "byPeriod", so releasing every value only once
+	oldValues := map[*AggregativeValue]struct{}{}
+	for _, h := range m.histories.ByPeriod {
+		for _, e := range h.storage {
+			if e != nil {
+				oldValues[e] = struct{}{}
+			}
+		}
+	}
+	for _, e := range m.data.byPeriod {
+		oldValues[e] = struct{}{}
+	}
+
+	m.dataLocker.Lock()
+	m.aggregationPeriods = newAggregationPeriods
+	m.histories.ByPeriod = newHistories
+	m.data.byPeriod = newByPeriod
+	m.dataLocker.Unlock()
+
+	for e := range oldValues {
+		e.Release()
+	}
+}
+
+// ReconfigureAggregationPeriods changes aggregation periods of all existing aggregative metrics of the registry
+// without resetting their statistics (see "commonAggregative.ReconfigureAggregationPeriods").
+//
+// It doesn't affect new metrics, so "SetAggregationPeriods" (or option "WithPeriods") should be used as well.
+// If the periods are invalid for any metric then no metric is changed and the error is returned.
+func (r *Registry) ReconfigureAggregationPeriods(periods ...time.Duration) error {
+	type reconfigurable interface {
+		GetSlicerInterval() time.Duration
+		ReconfigureAggregationPeriods(periods ...time.Duration) error
+	}
+
+	var metrics []reconfigurable
+	for _, metricKey := range r.storage.Keys() {
+		metricI, _ := r.storage.GetByBytes(metricKey.([]byte))
+		metric, ok := metricI.(reconfigurable)
+		if !ok {
+			continue
+		}
+		cfg := aggregativeConfig{
+			periods:        append([]time.Duration{}, periods...),
+			slicerInterval: metric.GetSlicerInterval(),
+		}
+		if _, err := cfg.getAggregationPeriods(); err != nil {
+			return fmt.Errorf("metric %v: %w", metricI.(Metric).GetName(), err)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	for _, metric := range metrics {
+		if err := metric.ReconfigureAggregationPeriods(periods...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReconfigureAggregationPeriods changes aggregation periods of all existing aggregative metrics of the default
+// registry (see "Registry.ReconfigureAggregationPeriods")
+func ReconfigureAggregationPeriods(periods ...time.Duration) error {
+	return registry.ReconfigureAggregationPeriods(periods...)
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconfigureAggregationPeriods(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	r := New()
+	r.SetClock(clock)
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	metric := r.GaugeAggregativeFlow(`reconfigured`, nil, WithPeriods(5*time.Second, time.Minute, 5*time.Minute))
+	for i := 0; i < 120; i++ {
+		metric.ConsiderValue(1)
+		clock.Advance(time.Second)
+	}
+	assert.Equal(t, uint64(60), metric.GetValuePointers().ByPeriod(2).Count.Get())
+
+	assert.NoError(t, metric.ReconfigureAggregationPeriods(time.Minute, time.Hour))
+	assert.Equal(t, []string{`last`, `1s`, `1m`, `1h`, `total`}, aggregativeLabels(metric))
+	assert.Len(t, metric.histories.ByPeriod, 2)
+	assert.Equal(t, uint64(120), metric.GetValuePointers().Total().Count.Get())
+
+	// "1m" is rebuilt from the last 5 values of "1s" and the older (not overlapping them) pieces of "5s"
+	assert.Equal(t, uint64(55), metric.GetValuePointers().ByPeriod(1).Count.Get())
+
+	// the old values leave "1m" in time, but they're still in "1h"
+	clock.Advance(time.Minute)
+	assert.Equal(t, uint64(0), metric.GetValuePointers().ByPeriod(1).Count.Get())
+	assert.Equal(t, uint64(114), metric.GetValuePointers().ByPeriod(2).Count.Get())
+
+	metric.ConsiderValue(1)
+	clock.Advance(time.Second)
+	assert.Equal(t, uint64(1), metric.GetValuePointers().ByPeriod(1).Count.Get())
+
+	err := metric.ReconfigureAggregationPeriods(time.Minute, 90*time.Second)
+	assert.True(t, errors.Is(err, ErrInvalidAggregationPeriods))
+	assert.Equal(t, []AggregationPeriod{{60}, {3600}}, metric.GetAggregationPeriods())
+}
+
+func TestRegistryReconfigureAggregationPeriods(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	r := New()
+	r.SetClock(clock)
+	defer r.Reset()
+
+	metric := r.TimingFlow(`timing`, nil)
+	coarse := r.GaugeAggregativeSimple(`coarse`, nil, WithSlicerInterval(10*time.Second))
+	r.GaugeInt64(`not_aggregative`, nil)
+
+	err := r.ReconfigureAggregationPeriods(5*time.Second, time.Minute)
+	assert.True(t, errors.Is(err, ErrInvalidAggregationPeriods))
+	assert.Equal(t, GetAggregationPeriods(), metric.GetAggregationPeriods())
+
+	assert.NoError(t, r.ReconfigureAggregationPeriods(time.Minute, time.Hour))
+	assert.Equal(t, []AggregationPeriod{{60}, {3600}}, metric.GetAggregationPeriods())
+	assert.Equal(t, []AggregationPeriod{{6}, {360}}, coarse.GetAggregationPeriods())
+}
@@ -3,7 +3,6 @@ package metrics
 import (
 	"bytes"
 	"runtime"
-	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,7 +14,6 @@ import (
 const (
 	defaultIterateInterval = time.Minute
 	gcUselessLimit         = 5
-	maxPercentileValues    = 5
 )
 
 const (
@@ -43,7 +41,17 @@ type Registry struct {
 	hiddenTags               *hiddenTagInternal
 	defaultGCEnabled         uint32
 	defaultIsRunned          uint32
-	defaultPercentiles       []float64
+	defaultPercentiles       *[]float64
+	defaultBufferSize        uint32
+	metricInfos              sync.Map
+	hooks                    registryHooks
+	isClosed                 uint32
+	defaultConsiderValueSync uint32
+	clock                    *Clock
+
+	// clockIterationHandlers is the collection of iterationHandlers of the clock of the registry if it's not
+	// RealClock (see "SetClock")
+	clockIterationHandlers *iterationHandlersT
 }
 
 func SetLimit(newLimit uint) {
@@ -108,8 +116,7 @@ func (b *keyGeneratorReusables) Release() {
 
 func New() *Registry {
 	r := &Registry{
-		storage:            atomicmap.New(),
-		defaultPercentiles: defaultFlowPercentiles,
+		storage: atomicmap.New(),
 	}
 	r.SetDefaultGCEnabled(true)
 	r.SetDefaultIsRan(true)
@@ -128,7 +135,7 @@ func (r *Registry) get(metricType Type, key string, tags AnyTags) Metric {
 		return nil
 	}
 	m := mI.(Metric)
-	if m.IsRunning() {
+	if m.IsRunning() || r.IsClosed() {
 		return m
 	}
 
@@ -148,6 +155,33 @@ func (r *Registry) Get(metricType Type, key string, tags AnyTags) Metric {
 	return r.get(metricType, key, tags)
 }
 
+// GetOrCreate returns the metric of the type with the key and the tags (it's created with the default options if
+// it doesn't exist). It returns nil if a metric of the type couldn't be created without additional arguments (like
+// "GaugeInt64Func").
+func (r *Registry) GetOrCreate(metricType Type, key string, tags AnyTags) Metric {
+	switch metricType {
+	case TypeCount:
+		return r.Count(key, tags)
+	case TypeGaugeInt64:
+		return r.GaugeInt64(key, tags)
+	case TypeGaugeFloat64:
+		return r.GaugeFloat64(key, tags)
+	case TypeGaugeAggregativeFlow:
+		return r.GaugeAggregativeFlow(key, tags)
+	case TypeGaugeAggregativeBuffered:
+		return r.GaugeAggregativeBuffered(key, tags)
+	case TypeGaugeAggregativeSimple:
+		return r.GaugeAggregativeSimple(key, tags)
+	case TypeTimingFlow:
+		return r.TimingFlow(key, tags)
+	case TypeTimingBuffered:
+		return r.TimingBuffered(key, tags)
+	case TypeTimingSimple:
+		return r.TimingSimple(key, tags)
+	}
+	return nil
+}
+
 func (r *Registry) set(metric Metric) error {
 	_ = r.storage.Set(metric.GetKey(), metric)
 	return nil
@@ -223,6 +257,34 @@ func GetDefaultGCEnabled() bool {
 	return registry.GetDefaultGCEnabled()
 }
 
+// SetDefaultConsiderValueSync sets if values of new aggregative metrics should be applied synchronously
+// (see "SetConsiderValueSync" of aggregative metrics). It doesn't affect already created metrics.
+func (r *Registry) SetDefaultConsiderValueSync(newValue bool) {
+	if newValue {
+		atomic.StoreUint32(&r.defaultConsiderValueSync, 1)
+	} else {
+		atomic.StoreUint32(&r.defaultConsiderValueSync, 0)
+	}
+}
+
+// SetDefaultConsiderValueSync sets if values of new aggregative metrics of the default registry should be applied
+// synchronously (see "Registry.SetDefaultConsiderValueSync").
+func SetDefaultConsiderValueSync(newValue bool) {
+	registry.SetDefaultConsiderValueSync(newValue)
+}
+
+// GetDefaultConsiderValueSync returns if values of new aggregative metrics are applied synchronously
+// (see "SetDefaultConsiderValueSync").
+func (r *Registry) GetDefaultConsiderValueSync() bool {
+	return atomic.LoadUint32(&r.defaultConsiderValueSync) != 0
+}
+
+// GetDefaultConsiderValueSync returns if values of new aggregative metrics of the default registry are applied
+// synchronously (see "SetDefaultConsiderValueSync").
+func GetDefaultConsiderValueSync() bool {
+	return registry.GetDefaultConsiderValueSync()
+}
+
 func (r *Registry) SetDefaultIsRan(newIsRanValue bool) {
 	if newIsRanValue {
 		atomic.StoreUint32(&r.defaultIsRunned, 1)
@@ -362,11 +424,17 @@ func (r *Registry) GC() {
 		}
 
 		metric.lock()
+		isRemoved := false
 		if !metric.IsRunning() {
 			r.remove(metric)
-			metric.Release()
+			isRemoved = true
 		}
 		metric.unlock()
+
+		if isRemoved {
+			r.callOnRemoveHooks(metric)
+			metric.Release()
+		}
 	}
 }
 
@@ -399,6 +467,19 @@ func (r *Registry) Register(metric Metric, key string, inTags AnyTags) error {
 	copy(commons.storageKey, storageKey)
 	buf.Release()
 
+	// values of an aggregative metric are processed by a ConsiderValue queue shard chosen by the key
+	if aggregative, ok := metric.(interface{ setQueueShardHash(uint32) }); ok {
+		aggregative.setQueueShardHash(considerValueQueueHash(commons.storageKey))
+	}
+
+	if r.IsClosed() {
+		return ErrRegistryClosed
+	}
+
+	if err := r.callOnCreateHooks(metric.GetType(), key, tags); err != nil {
+		return err
+	}
+
 	return r.Set(metric)
 }
 
@@ -410,6 +491,11 @@ func Get(metricType Type, key string, tags AnyTags) Metric {
 	return registry.Get(metricType, key, tags)
 }
 
+// GetOrCreate returns the metric of the default registry (see "Registry.GetOrCreate")
+func GetOrCreate(metricType Type, key string, tags AnyTags) Metric {
+	return registry.GetOrCreate(metricType, key, tags)
+}
+
 // copied from https://github.com/demdxx/sort-algorithms/blob/master/algorithms.go
 func bubbleSort(data stringSlice) {
 	n := data.Len() - 1
@@ -545,9 +631,15 @@ func (r *Registry) Reset() {
 		}
 		metric := metricI.(Metric)
 		metric.lock()
+		wasRunning := metric.IsRunning()
 		metric.stop()
 		_ = r.storage.Unset(metricKey)
 		metric.unlock()
+
+		if wasRunning {
+			r.callOnStopHooks(metric)
+		}
+		r.callOnRemoveHooks(metric)
 	}
 }
 
@@ -563,11 +655,61 @@ func SetHiddenTags(newRawHiddenTags HiddenTags) {
 	registry.SetHiddenTags(newRawHiddenTags)
 }
 
+// SetDefaultPercentiles sets the default percentiles of the default registry (see "Registry.SetDefaultPercentiles")
 func SetDefaultPercentiles(p []float64) {
 	registry.SetDefaultPercentiles(p)
 }
 
+// GetDefaultPercentiles returns the default percentiles of the default registry (see "SetDefaultPercentiles")
+func GetDefaultPercentiles() []float64 {
+	return registry.GetDefaultPercentiles()
+}
+
+// SetDefaultPercentiles sets percentiles to be exported by new aggregative metrics of the registry (the default
+// ones are: 0.01, 0.1, 0.5, 0.9, 0.99). Any amount of percentiles is supported. To configure a specific metric use
+// option "WithPercentiles".
+//
+// It panics if the list is empty or a percentile is out of range 0.0 .. 1.0 (see "ValidatePercentiles").
 func (r *Registry) SetDefaultPercentiles(p []float64) {
-	sort.Float64s(p)
-	r.defaultPercentiles = p
+	percentiles, err := normalizePercentiles(p)
+	if err != nil {
+		panic(err)
+	}
+	atomic.StorePointer((*unsafe.Pointer)((unsafe.Pointer)(&r.defaultPercentiles)), (unsafe.Pointer)(&percentiles))
+}
+
+// GetDefaultPercentiles returns the default percentiles of the registry (see "SetDefaultPercentiles")
+func (r *Registry) GetDefaultPercentiles() []float64 {
+	percentiles := (*[]float64)(atomic.LoadPointer((*unsafe.Pointer)((unsafe.Pointer)(&r.defaultPercentiles))))
+	if percentiles == nil {
+		return defaultFlowPercentiles
+	}
+	return *percentiles
+}
+
+// SetDefaultBufferSize sets the size of the buffer with value samples of new "Buffered" metrics of the registry
+// (the default one is 1000, see "Buffered" in README.md). It doesn't affect already created metrics. To configure
+// a specific metric use option "WithBufferSize". Zero resets the size to the default one.
+func (r *Registry) SetDefaultBufferSize(size uint) {
+	atomic.StoreUint32(&r.defaultBufferSize, uint32(size))
+}
+
+// GetDefaultBufferSize returns the size of the buffer of new "Buffered" metrics of the registry
+// (see "SetDefaultBufferSize").
+func (r *Registry) GetDefaultBufferSize() uint {
+	size := atomic.LoadUint32(&r.defaultBufferSize)
+	if size == 0 {
+		return defaultBufferSize
+	}
+	return uint(size)
+}
+
+// SetDefaultBufferSize sets the default buffer size of the default registry (see "Registry.SetDefaultBufferSize")
+func SetDefaultBufferSize(size uint) {
+	registry.SetDefaultBufferSize(size)
+}
+
+// GetDefaultBufferSize returns the default buffer size of the default registry (see "SetDefaultBufferSize")
+func GetDefaultBufferSize() uint {
+	return registry.GetDefaultBufferSize()
 }
@@ -1,10 +1,9 @@
 package metrics
 
 type registryItem struct {
-	name        string
-	tags        *FastTags
-	description string
-	storageKey  []byte
+	name       string
+	tags       *FastTags
+	storageKey []byte
 
 	registry *Registry
 	parent   Metric
@@ -36,6 +35,40 @@ func (item *registryItem) GetName() string {
 func (item *registryItem) GetTags() *FastTags {
 	return item.tags.ToFastTags()
 }
+
+// GetMetricInfo returns the description, unit and metadata of the metric (see "SetMetricInfo").
+// It returns nil if they weren't set.
+func (item *registryItem) GetMetricInfo() *MetricInfo {
+	if item.registry == nil {
+		return nil
+	}
+	return item.registry.GetMetricInfo(item.name)
+}
+
+// GetDescription returns the description of the metric (see "SetMetricInfo")
+func (item *registryItem) GetDescription() string {
+	info := item.GetMetricInfo()
+	if info == nil {
+		return ``
+	}
+	return info.Description
+}
+
+// GetUnit returns the unit of the metric values (see "SetMetricInfo").
+//
+// If the unit wasn't set then "UnitNanoseconds" is returned for timing metrics and "UnitNone" for the rest metrics.
+func (item *registryItem) GetUnit() Unit {
+	info := item.GetMetricInfo()
+	if info != nil && info.Unit != UnitNone {
+		return info.Unit
+	}
+	switch item.parent.GetType() {
+	case TypeTimingFlow, TypeTimingBuffered, TypeTimingSimple:
+		return UnitNanoseconds
+	}
+	return UnitNone
+}
+
 func (item *registryItem) GetKey() []byte {
 	if item == nil {
 		return nil
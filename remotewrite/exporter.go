@@ -0,0 +1,410 @@
+package remotewrite
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/trafficstars/metrics"
+	"github.com/trafficstars/metrics/internal/httppush"
+	"github.com/trafficstars/metrics/internal/protobuf"
+	"github.com/trafficstars/metrics/internal/summary"
+)
+
+var (
+	// ErrUnexpectedStatusCode is returned if the receiver responded to a push with a non-2xx status code
+	ErrUnexpectedStatusCode = httppush.ErrUnexpectedStatusCode
+
+	// remoteWriteHeaders are the headers of push requests
+	remoteWriteHeaders = http.Header{
+		`Content-Encoding`:                  {`snappy`},
+		`Content-Type`:                      {`application/x-protobuf`},
+		`X-Prometheus-Remote-Write-Version`: {protocolVersion},
+	}
+)
+
+// request is a collected compressed "WriteRequest"
+type request struct {
+	body []byte
+}
+
+// Exporter pushes metrics of a registry via the remote write protocol (see the description of the package).
+//
+// The metrics are collected every interval (see "WithInterval") to a queue of requests (see "WithQueueSize"), and
+// the requests are pushed in background in the order of collection. A failed push is retried with an exponential
+// backoff (see "WithBackoff") unless the receiver rejected the request with a 4xx status code (except 429 "Too Many
+// Requests"): such request is dropped, because it will be rejected again.
+//
+// Quantiles of an aggregation period (see "WithQuantilesPeriod") are stamped with the time of the last slicing of
+// the metric (their values are changed only by the slicing), and the rest series (including "<name>_count",
+// "<name>_sum" and quantiles of "total", which are changed by every value) are stamped with the time of
+// the collection. Both times are of the clock of the registry.
+type Exporter struct {
+	config
+	registry *metrics.Registry
+	url      string
+
+	// sliceTimesLocker protects "sliceTimes"
+	sliceTimesLocker sync.Mutex
+
+	// sliceTimes are the times of the last slicing of aggregative metrics (by the key of a metric)
+	sliceTimes map[string]time.Time
+
+	// removeSliceHook removes the hook which fills "sliceTimes" (see "Close")
+	removeSliceHook func()
+
+	queueLocker  sync.Mutex
+	queue        []*request
+	droppedCount uint64
+
+	// pushLocker serializes pushes
+	pushLocker sync.Mutex
+
+	queueChan chan struct{}
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewExporter returns an Exporter which pushes metrics of the registry to the remote write endpoint (for example
+// "http://prometheus:9090/api/v1/write") every interval (see "WithInterval") of the clock of the registry.
+//
+// The Exporter adds a slice hook to the registry (see "AddOnSliceHook") until it's closed, so it should be created
+// once per registry.
+func NewExporter(registry *metrics.Registry, url string, opts ...Option) *Exporter {
+	exporter := &Exporter{
+		config: config{
+			interval:        defaultInterval,
+			headers:         http.Header{},
+			httpClient:      &http.Client{Timeout: defaultTimeout},
+			externalLabels:  metrics.Tags{},
+			quantilesPeriod: `total`,
+			queueSize:       defaultQueueSize,
+			minBackoff:      defaultMinBackoff,
+			maxBackoff:      defaultMaxBackoff,
+		},
+		registry:   registry,
+		url:        url,
+		sliceTimes: map[string]time.Time{},
+		queueChan:  make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&exporter.config)
+	}
+	exporter.removeSliceHook = registry.AddOnSliceHook(exporter.onSlice)
+
+	if exporter.interval > 0 {
+		ticker := registry.GetClock().NewTicker(exporter.interval)
+		exporter.wg.Add(1)
+		go exporter.collectLoop(ticker)
+	}
+	exporter.wg.Add(1)
+	go exporter.pushLoop()
+	return exporter
+}
+
+// onSlice remembers the time of the slicing of the metric
+func (exporter *Exporter) onSlice(metric metrics.AggregativeMetric, _ *metrics.AggregativeValue) {
+	now := exporter.registry.Now()
+	exporter.sliceTimesLocker.Lock()
+	exporter.sliceTimes[string(metric.GetKey())] = now
+	exporter.sliceTimesLocker.Unlock()
+}
+
+// collectLoop collects the metrics on every tick
+func (exporter *Exporter) collectLoop(ticker metrics.Ticker) {
+	defer exporter.wg.Done()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exporter.stopChan:
+			return
+		case <-ticker.C():
+		}
+		exporter.Collect()
+	}
+}
+
+// pushLoop pushes the queued requests retrying failed pushes with the backoff
+func (exporter *Exporter) pushLoop() {
+	defer exporter.wg.Done()
+	for {
+		select {
+		case <-exporter.stopChan:
+			return
+		case <-exporter.queueChan:
+		}
+
+		backoff := exporter.minBackoff
+		for {
+			err := exporter.Flush()
+			if err == nil {
+				break
+			}
+			if exporter.errorHandler != nil {
+				exporter.errorHandler(err)
+			}
+			if exporter.getQueueLength() == 0 {
+				// the failed requests were dropped, there's nothing to retry
+				break
+			}
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-exporter.stopChan:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff *= 2
+			if backoff > exporter.maxBackoff {
+				backoff = exporter.maxBackoff
+			}
+		}
+	}
+}
+
+// GetDroppedCount returns the amount of requests dropped due to the overflow of the queue (see "WithQueueSize")
+func (exporter *Exporter) GetDroppedCount() uint64 {
+	return atomic.LoadUint64(&exporter.droppedCount)
+}
+
+func (exporter *Exporter) getQueueLength() int {
+	exporter.queueLocker.Lock()
+	defer exporter.queueLocker.Unlock()
+	return len(exporter.queue)
+}
+
+// Collect encodes the current state of the metrics to a request and puts it to the queue to be pushed in background
+func (exporter *Exporter) Collect() {
+	body := encodeSnappy(nil, exporter.encodeRequest(exporter.registry.Now()))
+
+	exporter.queueLocker.Lock()
+	exporter.queue = append(exporter.queue, &request{body: body})
+	if overflow := len(exporter.queue) - exporter.queueSize; overflow > 0 {
+		exporter.queue = append(exporter.queue[:0], exporter.queue[overflow:]...)
+		atomic.AddUint64(&exporter.droppedCount, uint64(overflow))
+	}
+	exporter.queueLocker.Unlock()
+
+	select {
+	case exporter.queueChan <- struct{}{}:
+	default:
+	}
+}
+
+// Flush pushes the queued requests (without retries). It stops on the first failure which could be retried:
+// the failed request is kept in the queue. Requests rejected by the receiver are dropped (see "Exporter").
+func (exporter *Exporter) Flush() error {
+	exporter.pushLocker.Lock()
+	defer exporter.pushLocker.Unlock()
+
+	var result error
+	for {
+		exporter.queueLocker.Lock()
+		var head *request
+		if len(exporter.queue) > 0 {
+			head = exporter.queue[0]
+		}
+		exporter.queueLocker.Unlock()
+		if head == nil {
+			return result
+		}
+
+		isRetriable, err := exporter.push(head.body)
+		if err != nil && isRetriable {
+			return err
+		}
+		if err != nil && result == nil {
+			result = err
+		}
+
+		exporter.queueLocker.Lock()
+		if len(exporter.queue) > 0 && exporter.queue[0] == head {
+			// the request could be already dropped due to an overflow of the queue
+			exporter.queue = exporter.queue[1:]
+		}
+		exporter.queueLocker.Unlock()
+	}
+}
+
+// push sends a request to the receiver. It also returns if a failed push could be retried.
+func (exporter *Exporter) push(body []byte) (bool, error) {
+	statusCode, err := httppush.Push(exporter.httpClient, exporter.url, body, exporter.headers, remoteWriteHeaders)
+	if err == nil {
+		return false, nil
+	}
+	// there is no response on network errors
+	isRetriable := statusCode == 0 || statusCode >= 500 || statusCode == http.StatusTooManyRequests
+	return isRetriable, err
+}
+
+// Close stops collecting and pushing in background, removes the slice hook from the registry, collects the metrics
+// for the last time and pushes the queued requests
+func (exporter *Exporter) Close() error {
+	exporter.stopOnce.Do(func() {
+		close(exporter.stopChan)
+		exporter.removeSliceHook()
+	})
+	exporter.wg.Wait()
+	exporter.Collect()
+	return exporter.Flush()
+}
+
+// label is a label of a series
+type label struct {
+	name  string
+	value string
+}
+
+// encodeRequest returns an encoded "WriteRequest" with the current state of the metrics
+func (exporter *Exporter) encodeRequest(now time.Time) []byte {
+	list := exporter.registry.List()
+	defer list.Release()
+
+	exporter.sliceTimesLocker.Lock()
+	sliceTimes := make(map[string]time.Time, len(exporter.sliceTimes))
+	for key, sliceTime := range exporter.sliceTimes {
+		sliceTimes[key] = sliceTime
+	}
+	exporter.sliceTimesLocker.Unlock()
+
+	seen := map[string]struct{}{}
+	var e protobuf.Encoder
+	for _, metric := range *list {
+		name := sanitizeName(metric.GetName(), true)
+		aggregativeMetric, isAggregative := metric.(metrics.AggregativeMetric)
+		labels := exporter.labels(metric, isAggregative)
+
+		if !isAggregative {
+			var value float64
+			switch metric := metric.(type) {
+			case interface{ Get() int64 }:
+				value = float64(metric.Get())
+			default:
+				value = metric.GetFloat64()
+			}
+			encodeTimeSeries(&e, name, labels, value, now)
+			continue
+		}
+
+		key := string(metric.GetKey())
+		seen[key] = struct{}{}
+		sliceTime, ok := sliceTimes[key]
+		if !ok {
+			// the metric is not sliced yet
+			sliceTime = now
+		}
+		exporter.encodeSummary(&e, aggregativeMetric, name, labels, now, sliceTime)
+	}
+
+	// forget metrics which were removed from the registry
+	exporter.sliceTimesLocker.Lock()
+	for key := range exporter.sliceTimes {
+		if _, ok := seen[key]; !ok {
+			delete(exporter.sliceTimes, key)
+		}
+	}
+	exporter.sliceTimesLocker.Unlock()
+
+	return e.Bytes()
+}
+
+// labels returns labels of series of the metric: the external labels and tags of the metric sorted by names
+// (except "__name__"). Labels which are set by the exporter ("__name__" and "quantile" of summaries) are renamed
+// to "exported_<name>" to do not clash with them.
+func (exporter *Exporter) labels(metric metrics.Metric, isSummary bool) []label {
+	labelName := func(key string) string {
+		name := sanitizeName(key, false)
+		if name == `__name__` || (isSummary && name == `quantile`) {
+			name = `exported_` + name
+		}
+		return name
+	}
+
+	values := map[string]string{}
+	for key, value := range exporter.externalLabels {
+		values[labelName(key)] = metrics.TagValueToString(value)
+	}
+	if tags := metric.GetTags(); tags != nil {
+		for _, tag := range tags.Slice {
+			values[labelName(tag.Key)] = tag.StringValue
+		}
+	}
+
+	labels := make([]label, 0, len(values))
+	for name, value := range values {
+		if value == `` {
+			// a label with an empty value is the same as a missing label
+			continue
+		}
+		labels = append(labels, label{name: name, value: value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+// encodeTimeSeries encodes a "TimeSeries" with a single sample. The labels and the extra labels are merged with
+// label "__name__" and sorted by names (as it's required by the protocol).
+func encodeTimeSeries(
+	e *protobuf.Encoder,
+	name string,
+	labels []label,
+	value float64,
+	timestamp time.Time,
+	extra ...label,
+) {
+	encodeLabel := func(l label) {
+		e.Message(1, func(e *protobuf.Encoder) { // Label
+			e.String(1, l.name)
+			e.String(2, l.value)
+		})
+	}
+
+	allLabels := make([]label, 0, len(labels)+len(extra)+1)
+	allLabels = append(allLabels, label{name: `__name__`, value: name})
+	allLabels = append(allLabels, labels...)
+	allLabels = append(allLabels, extra...)
+	sort.Slice(allLabels, func(i, j int) bool { return allLabels[i].name < allLabels[j].name })
+
+	e.Message(1, func(e *protobuf.Encoder) { // TimeSeries
+		for _, l := range allLabels {
+			encodeLabel(l)
+		}
+		e.Message(2, func(e *protobuf.Encoder) { // Sample
+			e.Double(1, value)
+			e.Int64(2, timestamp.UnixNano()/int64(time.Millisecond))
+		})
+	})
+}
+
+// encodeSummary encodes series of an aggregative metric: "<name>_count", "<name>_sum" and quantiles (see
+// the description of "Exporter" about the timestamps)
+func (exporter *Exporter) encodeSummary(
+	e *protobuf.Encoder,
+	metric metrics.AggregativeMetric,
+	name string,
+	labels []label,
+	now time.Time,
+	sliceTime time.Time,
+) {
+	metricSummary, ok := summary.Get(metric, exporter.quantilesPeriod)
+	if !ok {
+		return
+	}
+
+	encodeTimeSeries(e, name+`_count`, labels, float64(metricSummary.Count), now)
+	encodeTimeSeries(e, name+`_sum`, labels, metricSummary.Sum, now)
+	quantilesTime := sliceTime
+	if metricSummary.QuantilesPeriod == `total` {
+		quantilesTime = now
+	}
+	for _, quantile := range metricSummary.Quantiles {
+		quantileLabel := label{name: `quantile`, value: strconv.FormatFloat(quantile.Quantile, 'g', -1, 64)}
+		encodeTimeSeries(e, name, labels, quantile.Value, quantilesTime, quantileLabel)
+	}
+}
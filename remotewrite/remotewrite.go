@@ -0,0 +1,131 @@
+// Package remotewrite implements an exporter of metrics of a registry to Prometheus (or any compatible storage) via
+// the remote write protocol: the metrics are encoded to snappy-compressed "WriteRequest"-s and pushed over HTTP.
+// It's useful for batch jobs and other processes which could not be scraped.
+//
+// Metrics are converted to series:
+//   - "Count" and gauges are series of the same names;
+//   - aggregative metrics are summaries: series "<name>_count" and "<name>_sum" are of value "total", and series
+//     "<name>" with label "quantile" (including 0 for the minimum and 1 for the maximum) are of value
+//     of the aggregation period chosen by option "WithQuantilesPeriod" (the percentiles of the metric are used,
+//     see "metrics.WithPercentiles").
+//
+// Tags of metrics are labels of series. Names of metrics and keys of tags are sanitized to be valid names of
+// Prometheus (invalid characters are replaced with "_"). Tags "__name__" and "quantile" (of aggregative metrics) are
+// renamed to "exported___name__" and "exported_quantile".
+package remotewrite
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/trafficstars/metrics"
+)
+
+const (
+	defaultInterval   = 10 * time.Second
+	defaultTimeout    = 10 * time.Second
+	defaultQueueSize  = 100
+	defaultMinBackoff = 30 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+
+	// protocolVersion is the version of the remote write protocol (header "X-Prometheus-Remote-Write-Version")
+	protocolVersion = `0.1.0`
+)
+
+type config struct {
+	interval        time.Duration
+	headers         http.Header
+	httpClient      *http.Client
+	externalLabels  metrics.Tags
+	quantilesPeriod string
+	queueSize       int
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	errorHandler    func(error)
+}
+
+// Option is an option of an Exporter (see "NewExporter")
+type Option func(cfg *config)
+
+// WithInterval sets how often the metrics are collected (the default interval is 10 seconds). If the interval is zero
+// then the metrics are collected only by "Collect" (and by "Close").
+func WithInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.interval = interval
+	}
+}
+
+// WithHeader adds a header to push requests (for example for authentication)
+func WithHeader(key, value string) Option {
+	return func(cfg *config) {
+		cfg.headers.Add(key, value)
+	}
+}
+
+// WithHTTPClient sets the client to be used for push requests (the default one has a 10 seconds timeout)
+func WithHTTPClient(client *http.Client) Option {
+	return func(cfg *config) {
+		cfg.httpClient = client
+	}
+}
+
+// WithExternalLabels adds labels to all series (for example "job" and "instance"). Tags of metrics take precedence
+// over them.
+func WithExternalLabels(labels metrics.Tags) Option {
+	return func(cfg *config) {
+		for key, value := range labels {
+			cfg.externalLabels[key] = value
+		}
+	}
+}
+
+// WithQuantilesPeriod sets the label of the aggregative value ("1m", "5m", ..., "total", see
+// "EachAggregativeValue") which quantiles are exported (the default one is "total"). If a metric has no such
+// aggregation period then "total" is used.
+func WithQuantilesPeriod(label string) Option {
+	return func(cfg *config) {
+		cfg.quantilesPeriod = label
+	}
+}
+
+// WithQueueSize sets the maximal amount of collected requests waiting to be pushed (the default size is 100). If
+// the queue is full then the oldest request is dropped (see "GetDroppedCount").
+func WithQueueSize(size int) Option {
+	return func(cfg *config) {
+		cfg.queueSize = size
+	}
+}
+
+// WithBackoff sets the delay before the first retry of a failed push and the maximal delay (the delay is doubled
+// on every failure). The default delays are 30 milliseconds and 5 seconds.
+func WithBackoff(min, max time.Duration) Option {
+	return func(cfg *config) {
+		cfg.minBackoff = min
+		cfg.maxBackoff = max
+	}
+}
+
+// WithErrorHandler sets the function to be called on every failure of background pushing (for example to log it)
+func WithErrorHandler(handler func(error)) Option {
+	return func(cfg *config) {
+		cfg.errorHandler = handler
+	}
+}
+
+// sanitizeName replaces characters which are not allowed in names of Prometheus with "_" (and prepends "_" if
+// the name starts with a digit). Colons are allowed only in names of metrics.
+func sanitizeName(name string, allowColons bool) string {
+	if name == `` || (name[0] >= '0' && name[0] <= '9') {
+		name = `_` + name
+	}
+	result := []byte(name)
+	for idx, c := range result {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		case c == ':' && allowColons:
+		default:
+			result[idx] = '_'
+		}
+	}
+	return string(result)
+}
@@ -0,0 +1,240 @@
+package remotewrite
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trafficstars/metrics"
+	"github.com/trafficstars/metrics/internal/protobuf"
+)
+
+// sample is a decoded sample of a series
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// receiver is a stand-in of a remote write receiver which decodes requests to samples by the string representation
+// of labels
+type receiver struct {
+	t          *testing.T
+	locker     sync.Mutex
+	failures   int
+	statusCode int
+	requests   []map[string]sample
+}
+
+func (recv *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	t := recv.t
+	assert.Equal(t, `snappy`, req.Header.Get(`Content-Encoding`))
+	assert.Equal(t, `application/x-protobuf`, req.Header.Get(`Content-Type`))
+	assert.Equal(t, `0.1.0`, req.Header.Get(`X-Prometheus-Remote-Write-Version`))
+
+	recv.locker.Lock()
+	defer recv.locker.Unlock()
+	if recv.failures > 0 {
+		recv.failures--
+		http.Error(w, `try later`, recv.statusCode)
+		return
+	}
+
+	compressed, _ := ioutil.ReadAll(req.Body)
+	body, err := decodeSnappy(compressed)
+	assert.NoError(t, err)
+	recv.requests = append(recv.requests, decodeWriteRequest(t, body))
+}
+
+func (recv *receiver) getRequests() []map[string]sample {
+	recv.locker.Lock()
+	defer recv.locker.Unlock()
+	return recv.requests
+}
+
+func parse(t *testing.T, data []byte) []protobuf.Field {
+	fields, err := protobuf.Parse(data)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return fields
+}
+
+// decodeWriteRequest returns samples of a "WriteRequest" by series like `requests{method="GET"}`
+func decodeWriteRequest(t *testing.T, data []byte) map[string]sample {
+	result := map[string]sample{}
+	for _, timeSeries := range parse(t, data) {
+		var series, labels, lastName string
+		var s sample
+		for _, field := range parse(t, timeSeries.Bytes) {
+			switch field.Number {
+			case 1:
+				labelFields := parse(t, field.Bytes)
+				name, value := string(labelFields[0].Bytes), string(labelFields[1].Bytes)
+				assert.Less(t, lastName, name, `labels should be sorted`)
+				lastName = name
+				if name == `__name__` {
+					series = value
+					continue
+				}
+				if labels != `` {
+					labels += `,`
+				}
+				labels += name + `="` + value + `"`
+			case 2:
+				for _, sampleField := range parse(t, field.Bytes) {
+					switch sampleField.Number {
+					case 1:
+						s.value = sampleField.Double()
+					case 2:
+						s.timestamp = int64(sampleField.Varint)
+					}
+				}
+			}
+		}
+		result[series+`{`+labels+`}`] = s
+	}
+	return result
+}
+
+func TestExporter(t *testing.T) {
+	recv := &receiver{t: t, failures: 2, statusCode: http.StatusServiceUnavailable}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	start := time.Unix(1600000000, 0)
+	r, clock := metrics.NewManualRegistry(start)
+	defer r.Reset()
+
+	var errorsCount int
+	exporter := NewExporter(r, server.URL,
+		WithInterval(1500*time.Millisecond),
+		WithBackoff(time.Millisecond, 10*time.Millisecond),
+		WithExternalLabels(metrics.Tags{`job`: `batch`}),
+		WithErrorHandler(func(err error) {
+			assert.True(t, errors.Is(err, ErrUnexpectedStatusCode), err)
+			errorsCount++
+		}),
+	)
+
+	r.Count(`requests`, metrics.Tags{`method`: `GET`, `job`: `web`}).Add(5)
+	r.GaugeFloat64(`temperature.celsius`, nil).Set(36.6)
+	latency := r.TimingBuffered(`latency`, metrics.Tags{`Zone`: `a`, `quantile`: `b`},
+		metrics.WithPercentiles(0.5, 0.99))
+	for i := 1; i <= 100; i++ {
+		latency.ConsiderValue(time.Duration(i))
+	}
+	clock.Advance(1500 * time.Millisecond)
+	collectedAt := start.Add(1500*time.Millisecond).UnixNano() / int64(time.Millisecond)
+
+	// the first two pushes fail, so the request is retried with the backoff
+	assert.Eventually(t, func() bool {
+		return len(recv.getRequests()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 2, errorsCount)
+	assert.NoError(t, exporter.Close())
+	assert.Len(t, recv.getRequests(), 2)
+
+	// the values of "total" are changed by every value, so they are stamped with the time of the collection
+	request := recv.getRequests()[0]
+	latencyLabels := `Zone="a",exported_quantile="b",job="batch"`
+	assert.Equal(t, sample{value: 5, timestamp: collectedAt}, request[`requests{job="web",method="GET"}`])
+	assert.Equal(t, sample{value: 36.6, timestamp: collectedAt}, request[`temperature_celsius{job="batch"}`])
+	assert.Equal(t, sample{value: 100, timestamp: collectedAt}, request[`latency_count{`+latencyLabels+`}`])
+	assert.Equal(t, sample{value: 5050, timestamp: collectedAt}, request[`latency_sum{`+latencyLabels+`}`])
+	assert.Equal(t, float64(1), request[`latency{`+latencyLabels+`,quantile="0"}`].value)
+	assert.Equal(t, float64(100), request[`latency{`+latencyLabels+`,quantile="1"}`].value)
+	assert.InDelta(t, 50, request[`latency{`+latencyLabels+`,quantile="0.5"}`].value, 2)
+	assert.InDelta(t, 99, request[`latency{`+latencyLabels+`,quantile="0.99"}`].value, 2)
+	assert.Equal(t, collectedAt, request[`latency{`+latencyLabels+`,quantile="0.99"}`].timestamp)
+	assert.Len(t, request, 8)
+
+	// the closed exporter doesn't track slicing anymore
+	r.TimingFlow(`other`, nil).ConsiderValue(time.Second)
+	clock.Advance(time.Second)
+	exporter.sliceTimesLocker.Lock()
+	assert.Len(t, exporter.sliceTimes, 1)
+	exporter.sliceTimesLocker.Unlock()
+}
+
+func TestExporterQuantilesPeriod(t *testing.T) {
+	recv := &receiver{t: t}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	start := time.Unix(1600000000, 0)
+	r, clock := metrics.NewManualRegistry(start)
+	defer r.Reset()
+	exporter := NewExporter(r, server.URL, WithInterval(0), WithQuantilesPeriod(`5s`))
+
+	latency := r.TimingFlow(`latency`, nil)
+	latency.ConsiderValue(time.Second)
+	clock.Advance(5500 * time.Millisecond)
+	latency.ConsiderValue(time.Second)
+	assert.NoError(t, exporter.Close())
+
+	// quantiles of the period are changed only by the slicing, so they are stamped with the time of the last slicing
+	request := recv.getRequests()[0]
+	slicedAt := start.Add(5*time.Second).UnixNano() / int64(time.Millisecond)
+	collectedAt := start.Add(5500*time.Millisecond).UnixNano() / int64(time.Millisecond)
+	assert.Equal(t, sample{value: 2, timestamp: collectedAt}, request[`latency_count{}`])
+	assert.Equal(t, sample{value: float64(time.Second), timestamp: slicedAt}, request[`latency{quantile="1"}`])
+}
+
+func TestExporterQueue(t *testing.T) {
+	recv := &receiver{t: t, failures: 100, statusCode: http.StatusServiceUnavailable}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	r := metrics.New()
+	defer r.Reset()
+	r.Count(`requests`, nil).Increment()
+
+	exporter := NewExporter(r, server.URL, WithInterval(0), WithQueueSize(2), WithBackoff(time.Hour, time.Hour))
+	for i := 0; i < 3; i++ {
+		exporter.Collect()
+	}
+	assert.Equal(t, uint64(1), exporter.GetDroppedCount())
+
+	// waiting for the failed push (the next one is only in an hour)
+	assert.Eventually(t, func() bool {
+		recv.locker.Lock()
+		defer recv.locker.Unlock()
+		return recv.failures < 100
+	}, time.Second, time.Millisecond)
+	recv.locker.Lock()
+	recv.failures = 0
+	recv.locker.Unlock()
+	assert.NoError(t, exporter.Close())
+	assert.Len(t, recv.getRequests(), 2)
+	assert.Equal(t, uint64(2), exporter.GetDroppedCount())
+}
+
+func TestExporterRejected(t *testing.T) {
+	recv := &receiver{t: t, failures: 1, statusCode: http.StatusBadRequest}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	r := metrics.New()
+	defer r.Reset()
+	exporter := NewExporter(r, server.URL, WithInterval(0))
+
+	// a rejected request is not retried
+	err := exporter.Close()
+	assert.True(t, errors.Is(err, ErrUnexpectedStatusCode), err)
+	assert.Contains(t, err.Error(), `try later`)
+	assert.Equal(t, 0, exporter.getQueueLength())
+	assert.Empty(t, recv.getRequests())
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, `http_requests:rate`, sanitizeName(`http.requests:rate`, true))
+	assert.Equal(t, `http_requests_rate`, sanitizeName(`http.requests:rate`, false))
+	assert.Equal(t, `_5xx`, sanitizeName(`5xx`, false))
+	assert.Equal(t, `_`, sanitizeName(``, false))
+}
@@ -0,0 +1,107 @@
+package remotewrite
+
+import (
+	"encoding/binary"
+)
+
+// The remote write protocol requires the block format of snappy (not the framing format), see
+// https://github.com/google/snappy/blob/main/format_description.txt
+//
+// The encoder is a simple greedy one: it finds matches of 4 bytes via a hash table and doesn't try to find longer
+// ones. It's enough for requests which consist of repeating label names and values.
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+
+	// snappyMaxBlockSize is the size of blocks which are compressed independently (offsets of copies within
+	// a block fit into 2 bytes)
+	snappyMaxBlockSize = 1 << 16
+
+	snappyHashTableBits = 14
+)
+
+// encodeSnappy appends the snappy-compressed "src" to "dst"
+func encodeSnappy(dst, src []byte) []byte {
+	var length [binary.MaxVarintLen64]byte
+	dst = append(dst, length[:binary.PutUvarint(length[:], uint64(len(src)))]...)
+	for len(src) > 0 {
+		block := src
+		if len(block) > snappyMaxBlockSize {
+			block = block[:snappyMaxBlockSize]
+		}
+		dst = encodeSnappyBlock(dst, block)
+		src = src[len(block):]
+	}
+	return dst
+}
+
+func snappyHash(v uint32) uint32 {
+	return (v * 0x1e35a7bd) >> (32 - snappyHashTableBits)
+}
+
+// encodeSnappyBlock appends literals and copies of a block (of at most snappyMaxBlockSize bytes)
+func encodeSnappyBlock(dst, src []byte) []byte {
+	// positions of last occurrences of 4 bytes sequences (by their hashes)
+	var table [1 << snappyHashTableBits]uint16
+
+	literalStart := 0
+	for pos := 0; pos+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[pos:])
+		h := snappyHash(v)
+		candidate := int(table[h])
+		table[h] = uint16(pos)
+		if candidate >= pos || binary.LittleEndian.Uint32(src[candidate:]) != v {
+			pos++
+			continue
+		}
+
+		length := 4
+		for pos+length < len(src) && src[candidate+length] == src[pos+length] {
+			length++
+		}
+		dst = appendSnappyLiteral(dst, src[literalStart:pos])
+		dst = appendSnappyCopy(dst, pos-candidate, length)
+		pos += length
+		literalStart = pos
+	}
+	return appendSnappyLiteral(dst, src[literalStart:])
+}
+
+func appendSnappyLiteral(dst, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+	n := uint32(len(literal) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n<<2)|snappyTagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, literal...)
+}
+
+// appendSnappyCopy appends copies of "length" bytes at "offset" bytes back (the offset is less than 65536)
+func appendSnappyCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		chunk := length
+		if chunk > 64 {
+			chunk = 64
+		}
+		if chunk >= 4 && chunk <= 11 && offset < 2048 {
+			dst = append(dst, byte(offset>>8)<<5|byte(chunk-4)<<2|snappyTagCopy1, byte(offset))
+		} else {
+			dst = append(dst, byte(chunk-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+		}
+		length -= chunk
+	}
+	return dst
+}
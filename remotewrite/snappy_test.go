@@ -0,0 +1,133 @@
+package remotewrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errInvalidSnappy = errors.New(`invalid snappy data`)
+
+// decodeSnappy decodes the snappy block format (see "encodeSnappy")
+func decodeSnappy(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errInvalidSnappy
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+	for len(src) > 0 {
+		tag := src[0]
+		src = src[1:]
+		switch tag & 3 {
+		case snappyTagLiteral:
+			literalLen := int(tag >> 2)
+			if literalLen >= 60 {
+				size := literalLen - 59
+				if len(src) < size {
+					return nil, errInvalidSnappy
+				}
+				literalLen = 0
+				for idx := size - 1; idx >= 0; idx-- {
+					literalLen = literalLen<<8 | int(src[idx])
+				}
+				src = src[size:]
+			}
+			literalLen++
+			if len(src) < literalLen {
+				return nil, errInvalidSnappy
+			}
+			dst = append(dst, src[:literalLen]...)
+			src = src[literalLen:]
+			continue
+		case snappyTagCopy1:
+			if len(src) < 1 {
+				return nil, errInvalidSnappy
+			}
+			copyLen, offset := int(tag>>2&7)+4, int(tag>>5)<<8|int(src[0])
+			src = src[1:]
+			dst, n = appendCopy(dst, offset, copyLen)
+		case snappyTagCopy2:
+			if len(src) < 2 {
+				return nil, errInvalidSnappy
+			}
+			copyLen, offset := int(tag>>2)+1, int(binary.LittleEndian.Uint16(src))
+			src = src[2:]
+			dst, n = appendCopy(dst, offset, copyLen)
+		default:
+			return nil, errInvalidSnappy
+		}
+		if n < 0 {
+			return nil, errInvalidSnappy
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, errInvalidSnappy
+	}
+	return dst, nil
+}
+
+// appendCopy appends "length" bytes from "offset" bytes back (byte by byte, because they could overlap)
+func appendCopy(dst []byte, offset, length int) ([]byte, int) {
+	if offset <= 0 || offset > len(dst) {
+		return dst, -1
+	}
+	for idx := 0; idx < length; idx++ {
+		dst = append(dst, dst[len(dst)-offset])
+	}
+	return dst, length
+}
+
+// TestSnappyGolden compares the encoding to the one of the reference implementation (the outputs of "Encode" of
+// github.com/golang/snappy v0.0.4 for the same inputs)
+func TestSnappyGolden(t *testing.T) {
+	for _, golden := range []struct {
+		data       string
+		compressed string
+	}{
+		{``, `00`},
+		{`a`, `010061`},
+		{`abcdefghijklmnop`, `103c6162636465666768696a6b6c6d6e6f70`},
+		{strings.Repeat(`a`, 20), `1400614a0100`},
+		{strings.Repeat(`abcd`, 5), `140c616263643e0400`},
+		{`abcdefgh_abcdefgh_abcdefgh_0123456789`, `252061626364656667685f4609002430313233343536373839`},
+		{strings.Repeat(`__name__ requests `, 4), `48445f5f6e616d655f5f20726571756573747320d61200`},
+		{strings.Repeat(`0123456789`, 8), `502430313233343536373839fe0a00090a`},
+		{strings.Repeat(`x`, 100), `640078fe01008a0100`},
+	} {
+		compressed, err := hex.DecodeString(golden.compressed)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, compressed, encodeSnappy(nil, []byte(golden.data)), golden.data)
+		decompressed, err := decodeSnappy(compressed)
+		assert.NoError(t, err, golden.data)
+		assert.Equal(t, golden.data, string(decompressed))
+	}
+}
+
+func TestSnappy(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(0)).Read(random)
+
+	for name, data := range map[string][]byte{
+		`empty`:     {},
+		`short`:     []byte(`abc`),
+		`repeating`: bytes.Repeat([]byte(`__name__ requests method GET `), 10000),
+		`random`:    random,
+	} {
+		compressed := encodeSnappy(nil, data)
+		decompressed, err := decodeSnappy(compressed)
+		assert.NoError(t, err, name)
+		assert.Equal(t, data, decompressed, name)
+		if name == `repeating` {
+			assert.Less(t, len(compressed), len(data)/10)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// WithSlidingWindow enables the sliding window mode of the metric (see "Sliding window" in README.md): the value of
+// every aggregation period is calculated from (up to) "buckets" buckets of its own, so for example "1d" moves
+// smoothly (with a step of about "1d"/"buckets") instead of jumping in "6h" steps.
+//
+// "buckets" is the memory budget: the metric keeps up to "buckets" values for every aggregation period. The buckets
+// cover the aggregation period exactly, so the width of a bucket is the smallest divisor of the period which fits
+// the budget (for example "1d" with 1000 buckets is 960 buckets of 90 seconds). The mode is more expensive than
+// the default one, because the value of every aggregation period is recalculated from all its buckets on every
+// slicing. "WithSlidingWindow(0)" is the default (cheap) mode.
+func WithSlidingWindow(buckets uint) AggregativeOption {
+	return func(cfg *aggregativeConfig) {
+		cfg.slidingWindowBuckets = buckets
+	}
+}
+
+// IsSlidingWindow returns if the metric is in the sliding window mode (see "WithSlidingWindow")
+func (m *commonAggregative) IsSlidingWindow() bool {
+	return m.slidingWindowBuckets != 0
+}
+
+// historyGranularity returns the length (in slicer intervals) of values stored in the history "idx" for aggregation
+// periods "periods".
+//
+// In the default mode the history of the first period stores values of the base aggregation period, and
+// the history of every next period stores values of the previous one. In the sliding window mode every
+// history stores buckets of its period (see "WithSlidingWindow").
+func (m *commonAggregative) historyGranularity(periods []AggregationPeriod, idx int) uint64 {
+	if m.IsSlidingWindow() {
+		// the buckets should cover the period exactly
+		interval := periods[idx].Interval
+		width := (interval + m.slidingWindowBuckets - 1) / m.slidingWindowBuckets
+		for interval%width != 0 {
+			width++
+		}
+		return width
+	}
+	if idx == 0 {
+		return GetBaseAggregationPeriod().Interval
+	}
+	return periods[idx-1].Interval
+}
+
+// sinceHistoryRotation returns how many slicer intervals (minus one) are already merged to the current element of
+// a history with granularity "granularity" (see "considerFilledValue" and "considerFilledValueSliding").
+func (m *commonAggregative) sinceHistoryRotation(granularity uint64) uint64 {
+	if m.IsSlidingWindow() {
+		return (m.tick - 1) % granularity
+	}
+	return m.tick % granularity
+}
+
+// newHistories returns empty histories for aggregation periods "periods"
+func (m *commonAggregative) newHistories(periods []AggregationPeriod) []*history {
+	result := make([]*history, 0, len(periods))
+	for idx, period := range periods {
+		// "period" is a multiple of the previous one, see "ValidateAggregationPeriods"
+		hist := &history{}
+		hist.storage = make([]*AggregativeValue, period.Interval/m.historyGranularity(periods, idx))
+		result = append(result, hist)
+	}
+	return result
+}
+
+// considerFilledValueSliding is an analog of "considerFilledValue" for the sliding window mode (see
+// "WithSlidingWindow"): the filled value is merged to the current bucket of every aggregation period and
+// the values are recalculated from the buckets.
+func (m *commonAggregative) considerFilledValueSliding(tick uint64, filledValue *AggregativeValue) {
+	oldValue := (*AggregativeValue)(atomic.SwapPointer((*unsafe.Pointer)((unsafe.Pointer)(&m.data.byPeriod[0])), (unsafe.Pointer)(filledValue)))
+	oldValue.Release()
+
+	for lIdx := range m.aggregationPeriods {
+		h := m.histories.ByPeriod[lIdx]
+		if (tick-1)%m.historyGranularity(m.aggregationPeriods, lIdx) == 0 {
+			rotateHistory(h)
+			if h.storage[h.currentOffset] != nil {
+				h.storage[h.currentOffset].Release()
+			}
+			h.storage[h.currentOffset] = m.NewAggregativeValue()
+		}
+		h.storage[h.currentOffset].MergeData(filledValue)
+
+		newValue := m.calculateValue(h)
+		oldValue := (*AggregativeValue)(atomic.SwapPointer((*unsafe.Pointer)((unsafe.Pointer)(&m.data.byPeriod[lIdx+1])), (unsafe.Pointer)(newValue)))
+		oldValue.Release()
+	}
+}
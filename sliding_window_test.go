@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	r := New()
+	r.SetClock(clock)
+	r.SetDefaultConsiderValueSync(true)
+	defer r.Reset()
+
+	metric := r.GaugeAggregativeBuffered(`sliding`, nil, WithPeriods(5*time.Second, time.Minute), WithSlidingWindow(12))
+	assert.True(t, metric.IsSlidingWindow())
+	assert.Equal(t, []string{`last`, `1s`, `5s`, `1m`, `total`}, aggregativeLabels(metric))
+	assert.Len(t, metric.histories.ByPeriod[1].storage, 12)
+
+	for i := 0; i < 90; i++ {
+		metric.ConsiderValue(float64(i))
+		clock.Advance(time.Second)
+	}
+	values := metric.GetValuePointers()
+	assert.Equal(t, uint64(1), values.ByPeriod(0).Count.Get())
+	assert.Equal(t, uint64(5), values.ByPeriod(1).Count.Get())
+	assert.Equal(t, uint64(60), values.ByPeriod(2).Count.Get())
+	assert.Equal(t, float64(89), values.ByPeriod(2).Max.Get())
+
+	// "1m" moves by buckets of 5 seconds
+	clock.Advance(time.Second)
+	assert.Equal(t, uint64(55), values.ByPeriod(2).Count.Get())
+	clock.Advance(4 * time.Second)
+	assert.Equal(t, uint64(55), values.ByPeriod(2).Count.Get())
+	clock.Advance(time.Second)
+	assert.Equal(t, uint64(50), values.ByPeriod(2).Count.Get())
+
+	// the mode is kept on reconfiguration
+	assert.NoError(t, metric.ReconfigureAggregationPeriods(time.Minute, 2*time.Minute))
+	assert.True(t, metric.IsSlidingWindow())
+	assert.Equal(t, uint64(50), values.ByPeriod(1).Count.Get())
+	assert.Equal(t, uint64(50), values.ByPeriod(2).Count.Get())
+
+	for i := 0; i < 60; i++ {
+		clock.Advance(time.Second)
+	}
+	assert.Equal(t, uint64(0), values.ByPeriod(1).Count.Get())
+	assert.Equal(t, uint64(50), values.ByPeriod(2).Count.Get())
+
+	// the buckets cover an aggregation period exactly
+	daily := r.GaugeAggregativeFlow(`daily`, nil, WithPeriods(24*time.Hour), WithSlidingWindow(1000))
+	assert.Equal(t, uint64(90), daily.historyGranularity(daily.aggregationPeriods, 0))
+	assert.Len(t, daily.histories.ByPeriod[0].storage, 960)
+
+	cheap := r.GaugeAggregativeFlow(`cheap`, nil)
+	assert.False(t, cheap.IsSlidingWindow())
+}
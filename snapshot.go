@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// AggregativeValueSnapshot is a static copy of the values of an AggregativeValue
+type AggregativeValueSnapshot struct {
+	Count uint64
+	Min   float64
+	Avg   float64
+	Max   float64
+	Sum   float64
+
+	// Variance is the (population) variance of considered values
+	Variance float64
+}
+
+// MetricSnapshot is a static copy of a metric state (see "Snapshot")
+type MetricSnapshot struct {
+	Key  string
+	Name string
+	Tags Tags
+	Type Type
+
+	// Value is the value of a non-aggregative metric (see "GetFloat64" of "Metric")
+	Value float64
+
+	// AggregativeValues are values of an aggregative metric by labels ("last", "1s", "5s", ..., "total").
+	// It's nil for non-aggregative metrics.
+	AggregativeValues map[string]AggregativeValueSnapshot
+}
+
+// Snapshot is a static copy of states of all running metrics of a registry at a moment.
+//
+// It's used to compute "what changed since the last snapshot", see "Diff".
+type Snapshot struct {
+	Time    time.Time
+	Metrics map[string]*MetricSnapshot
+}
+
+// TakeSnapshot returns a static copy of states of all running metrics of the registry
+func (r *Registry) TakeSnapshot() Snapshot {
+	snapshot := Snapshot{
+		Time:    r.Now(),
+		Metrics: map[string]*MetricSnapshot{},
+	}
+
+	list := r.List()
+	for _, metric := range *list {
+		item := newMetricSnapshot(metric)
+		snapshot.Metrics[item.Key] = item
+	}
+	list.Release()
+
+	return snapshot
+}
+
+// TakeSnapshot returns a static copy of states of all running metrics of the default registry
+func TakeSnapshot() Snapshot {
+	return registry.TakeSnapshot()
+}
+
+func newMetricSnapshot(metric Metric) *MetricSnapshot {
+	item := &MetricSnapshot{
+		Key:  string(metric.GetKey()),
+		Name: metric.GetName(),
+		Tags: Tags(metric.GetTags().ToMap()),
+		Type: metric.GetType(),
+	}
+
+	aggregativeMetric, ok := metric.(AggregativeMetric)
+	if !ok {
+		item.Value = metric.GetFloat64()
+		return item
+	}
+
+	item.AggregativeValues = map[string]AggregativeValueSnapshot{}
+	aggregativeMetric.EachAggregativeValue(func(label string, value *AggregativeValue) bool {
+		item.AggregativeValues[label] = value.Snapshot()
+		return true
+	})
+	return item
+}
+
+// Snapshot returns a static copy of the values
+func (aggrV *AggregativeValue) Snapshot() AggregativeValueSnapshot {
+	if aggrV == nil {
+		return AggregativeValueSnapshot{}
+	}
+	return AggregativeValueSnapshot{
+		Count: aggrV.Count.Get(),
+		Min:   aggrV.Min.Get(),
+		Avg:   aggrV.Avg.Get(),
+		Max:   aggrV.Max.Get(),
+		Sum:   aggrV.Sum.Get(),
+
+		Variance: aggrV.GetVariance(),
+	}
+}
+
+// AggregativeValueDelta is a change of an aggregative value between two snapshots
+type AggregativeValueDelta struct {
+	Previous AggregativeValueSnapshot
+	Current  AggregativeValueSnapshot
+}
+
+// MetricDelta is a change of a metric between two snapshots (see "Diff")
+type MetricDelta struct {
+	Key  string
+	Name string
+	Tags Tags
+	Type Type
+
+	// Previous and Current are values of a non-aggregative metric.
+	Previous float64
+	Current  float64
+
+	// Delta is "Current - Previous". If a count metric was reset (for example it was removed by GC and created
+	// again) then Delta is equals to Current.
+	Delta float64
+
+	// AggregativeChanges are changed aggregative values by labels (see "MetricSnapshot.AggregativeValues").
+	AggregativeChanges map[string]AggregativeValueDelta
+}
+
+// SnapshotDiff is the result of a comparison of two snapshots (see "Diff").
+//
+// All slices are sorted by metric keys.
+type SnapshotDiff struct {
+	// Interval is the time passed between the snapshots
+	Interval time.Duration
+
+	// CounterDeltas are changes of count metrics
+	CounterDeltas []MetricDelta
+
+	// GaugeChanges are changes of non-aggregative gauge metrics
+	GaugeChanges []MetricDelta
+
+	// AggregativeChanges are changes of aggregative metrics (only changed aggregation periods are included)
+	AggregativeChanges []MetricDelta
+
+	// Appeared are metrics which are present only in the current snapshot
+	Appeared []*MetricSnapshot
+
+	// Disappeared are metrics which are present only in the previous snapshot
+	Disappeared []*MetricSnapshot
+}
+
+// IsEmpty returns true if nothing has changed between the snapshots
+func (diff SnapshotDiff) IsEmpty() bool {
+	return len(diff.CounterDeltas) == 0 &&
+		len(diff.GaugeChanges) == 0 &&
+		len(diff.AggregativeChanges) == 0 &&
+		len(diff.Appeared) == 0 &&
+		len(diff.Disappeared) == 0
+}
+
+// Diff computes what changed between snapshots "prev" and "cur" (see "TakeSnapshot").
+func Diff(prev, cur Snapshot) SnapshotDiff {
+	diff := SnapshotDiff{
+		Interval: cur.Time.Sub(prev.Time),
+	}
+
+	for _, key := range sortedSnapshotKeys(cur) {
+		curItem := cur.Metrics[key]
+		prevItem := prev.Metrics[key]
+		if prevItem == nil {
+			diff.Appeared = append(diff.Appeared, curItem)
+			continue
+		}
+
+		delta := MetricDelta{
+			Key:      curItem.Key,
+			Name:     curItem.Name,
+			Tags:     curItem.Tags,
+			Type:     curItem.Type,
+			Previous: prevItem.Value,
+			Current:  curItem.Value,
+			Delta:    curItem.Value - prevItem.Value,
+		}
+
+		if curItem.AggregativeValues != nil {
+			for label, curValue := range curItem.AggregativeValues {
+				prevValue := prevItem.AggregativeValues[label]
+				if prevValue == curValue {
+					continue
+				}
+				if delta.AggregativeChanges == nil {
+					delta.AggregativeChanges = map[string]AggregativeValueDelta{}
+				}
+				delta.AggregativeChanges[label] = AggregativeValueDelta{
+					Previous: prevValue,
+					Current:  curValue,
+				}
+			}
+			if len(delta.AggregativeChanges) != 0 {
+				diff.AggregativeChanges = append(diff.AggregativeChanges, delta)
+			}
+			continue
+		}
+
+		if curItem.Value == prevItem.Value {
+			continue
+		}
+
+		if curItem.Type == TypeCount {
+			if curItem.Value < prevItem.Value {
+				delta.Delta = curItem.Value
+			}
+			diff.CounterDeltas = append(diff.CounterDeltas, delta)
+			continue
+		}
+
+		diff.GaugeChanges = append(diff.GaugeChanges, delta)
+	}
+
+	for _, key := range sortedSnapshotKeys(prev) {
+		if cur.Metrics[key] != nil {
+			continue
+		}
+		diff.Disappeared = append(diff.Disappeared, prev.Metrics[key])
+	}
+
+	return diff
+}
+
+func sortedSnapshotKeys(snapshot Snapshot) []string {
+	keys := make([]string, 0, len(snapshot.Metrics))
+	for key := range snapshot.Metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSenderRecord struct {
+	key   string
+	value float64
+}
+
+type testSender struct {
+	records []testSenderRecord
+}
+
+func (sender *testSender) SendInt64(metric Metric, key string, value int64) error {
+	sender.records = append(sender.records, testSenderRecord{key, float64(value)})
+	return nil
+}
+
+func (sender *testSender) SendUint64(metric Metric, key string, value uint64) error {
+	sender.records = append(sender.records, testSenderRecord{key, float64(value)})
+	return nil
+}
+
+func (sender *testSender) SendFloat64(metric Metric, key string, value float64) error {
+	sender.records = append(sender.records, testSenderRecord{key, value})
+	return nil
+}
+
+func TestDiff(t *testing.T) {
+	r := New()
+	defer r.Reset()
+	r.SetDefaultGCEnabled(false)
+
+	count := r.Count(`requests`, Tags{`method`: `GET`})
+	gauge := r.GaugeInt64(`concurrency`, nil)
+	gone := r.GaugeFloat64(`gone`, nil)
+	timing := r.TimingSimple(`latency`, nil)
+	count.Add(5)
+	gauge.Set(3)
+	timing.doConsiderValue(10)
+
+	prev := r.TakeSnapshot()
+
+	count.Add(2)
+	gauge.Set(3)
+	gone.Stop()
+	timing.doConsiderValue(20)
+	appeared := r.Count(`errors`, nil)
+	appeared.Increment()
+
+	cur := r.TakeSnapshot()
+	diff := Diff(prev, cur)
+
+	if assert.Len(t, diff.CounterDeltas, 1) {
+		assert.Equal(t, `requests`, diff.CounterDeltas[0].Name)
+		assert.Equal(t, `GET`, diff.CounterDeltas[0].Tags[`method`])
+		assert.Equal(t, float64(2), diff.CounterDeltas[0].Delta)
+	}
+	assert.Len(t, diff.GaugeChanges, 0)
+	if assert.Len(t, diff.AggregativeChanges, 1) {
+		change := diff.AggregativeChanges[0].AggregativeChanges[`total`]
+		assert.Equal(t, uint64(1), change.Previous.Count)
+		assert.Equal(t, uint64(2), change.Current.Count)
+		assert.Equal(t, float64(30), change.Current.Sum)
+	}
+	if assert.Len(t, diff.Appeared, 1) {
+		assert.Equal(t, `errors`, diff.Appeared[0].Name)
+	}
+	if assert.Len(t, diff.Disappeared, 1) {
+		assert.Equal(t, `gone`, diff.Disappeared[0].Name)
+	}
+
+	assert.True(t, Diff(cur, cur).IsEmpty())
+}
+
+func TestDeltaSender(t *testing.T) {
+	r := New()
+	defer r.Reset()
+
+	sender := &testSender{}
+	deltaSender := NewDeltaSender(sender)
+	metric := r.GaugeInt64(`test`, nil)
+
+	metric.Set(1)
+	metric.Send(deltaSender)
+	metric.Send(deltaSender)
+	metric.Set(2)
+	metric.Send(deltaSender)
+
+	assert.Equal(t, []testSenderRecord{{`test@gauge_int64`, 1}, {`test@gauge_int64`, 2}}, sender.records)
+
+	// the value of a removed metric is forgotten after an iteration without it
+	removed := r.GaugeInt64(`removed`, nil)
+	removed.Send(deltaSender)
+	metric.Send(deltaSender)
+	metric.Send(deltaSender)
+	metric.Send(deltaSender)
+	assert.Len(t, deltaSender.current, 1)
+	assert.Len(t, deltaSender.previous, 1)
+	assert.NotContains(t, deltaSender.current, `removed@gauge_int64`)
+	assert.NotContains(t, deltaSender.previous, `removed@gauge_int64`)
+	assert.Len(t, sender.records, 3)
+}
@@ -8,21 +8,21 @@ type MetricTimingBuffered struct {
 	commonAggregativeBuffered
 }
 
-func (r *Registry) newMetricTimingBuffered(key string, tags AnyTags) *MetricTimingBuffered {
+func (r *Registry) newMetricTimingBuffered(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingBuffered {
 	metric := metricTimingBufferedPool.Get().(*MetricTimingBuffered)
-	metric.init(r, key, tags)
+	metric.init(r, key, tags, opts...)
 	return metric
 }
 
-func (m *MetricTimingBuffered) init(r *Registry, key string, tags AnyTags) {
-	m.commonAggregativeBuffered.init(r, m, key, tags)
+func (m *MetricTimingBuffered) init(r *Registry, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregativeBuffered.init(r, m, key, tags, opts...)
 }
 
-func TimingBuffered(key string, tags AnyTags) *MetricTimingBuffered {
-	return registry.TimingBuffered(key, tags)
+func TimingBuffered(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingBuffered {
+	return registry.TimingBuffered(key, tags, opts...)
 }
 
-func (r *Registry) TimingBuffered(key string, tags AnyTags) *MetricTimingBuffered {
+func (r *Registry) TimingBuffered(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingBuffered {
 	if IsDisabled() {
 		return (*MetricTimingBuffered)(nil)
 	}
@@ -32,7 +32,7 @@ func (r *Registry) TimingBuffered(key string, tags AnyTags) *MetricTimingBuffere
 		return m.(*MetricTimingBuffered)
 	}
 
-	return r.newMetricTimingBuffered(key, tags)
+	return r.newMetricTimingBuffered(key, tags, opts...)
 }
 
 func (m *MetricTimingBuffered) ConsiderValue(v time.Duration) {
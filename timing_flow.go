@@ -8,21 +8,21 @@ type MetricTimingFlow struct {
 	commonAggregativeFlow
 }
 
-func (r *Registry) newMetricTimingFlow(key string, tags AnyTags) *MetricTimingFlow {
+func (r *Registry) newMetricTimingFlow(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingFlow {
 	metric := metricTimingFlowPool.Get().(*MetricTimingFlow)
-	metric.init(r, key, tags)
+	metric.init(r, key, tags, opts...)
 	return metric
 }
 
-func (m *MetricTimingFlow) init(r *Registry, key string, tags AnyTags) {
-	m.commonAggregativeFlow.init(r, m, key, tags)
+func (m *MetricTimingFlow) init(r *Registry, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregativeFlow.init(r, m, key, tags, opts...)
 }
 
-func TimingFlow(key string, tags AnyTags) *MetricTimingFlow {
-	return registry.TimingFlow(key, tags)
+func TimingFlow(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingFlow {
+	return registry.TimingFlow(key, tags, opts...)
 }
 
-func (r *Registry) TimingFlow(key string, tags AnyTags) *MetricTimingFlow {
+func (r *Registry) TimingFlow(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingFlow {
 	if IsDisabled() {
 		return (*MetricTimingFlow)(nil)
 	}
@@ -32,7 +32,7 @@ func (r *Registry) TimingFlow(key string, tags AnyTags) *MetricTimingFlow {
 		return m.(*MetricTimingFlow)
 	}
 
-	return r.newMetricTimingFlow(key, tags)
+	return r.newMetricTimingFlow(key, tags, opts...)
 }
 
 func (m *MetricTimingFlow) ConsiderValue(v time.Duration) {
@@ -8,21 +8,21 @@ type MetricTimingSimple struct {
 	commonAggregativeSimple
 }
 
-func (r *Registry) newMetricTimingSimple(key string, tags AnyTags) *MetricTimingSimple {
+func (r *Registry) newMetricTimingSimple(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingSimple {
 	metric := metricTimingSimplePool.Get().(*MetricTimingSimple)
-	metric.init(r, key, tags)
+	metric.init(r, key, tags, opts...)
 	return metric
 }
 
-func (m *MetricTimingSimple) init(r *Registry, key string, tags AnyTags) {
-	m.commonAggregativeSimple.init(r, m, key, tags)
+func (m *MetricTimingSimple) init(r *Registry, key string, tags AnyTags, opts ...AggregativeOption) {
+	m.commonAggregativeSimple.init(r, m, key, tags, opts...)
 }
 
-func TimingSimple(key string, tags AnyTags) *MetricTimingSimple {
-	return registry.TimingSimple(key, tags)
+func TimingSimple(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingSimple {
+	return registry.TimingSimple(key, tags, opts...)
 }
 
-func (r *Registry) TimingSimple(key string, tags AnyTags) *MetricTimingSimple {
+func (r *Registry) TimingSimple(key string, tags AnyTags, opts ...AggregativeOption) *MetricTimingSimple {
 	if IsDisabled() {
 		return (*MetricTimingSimple)(nil)
 	}
@@ -32,7 +32,7 @@ func (r *Registry) TimingSimple(key string, tags AnyTags) *MetricTimingSimple {
 		return m.(*MetricTimingSimple)
 	}
 
-	return r.newMetricTimingSimple(key, tags)
+	return r.newMetricTimingSimple(key, tags, opts...)
 }
 
 func (m *MetricTimingSimple) ConsiderValue(v time.Duration) {
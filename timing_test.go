@@ -8,7 +8,6 @@ import (
 	"runtime"
 	_ "runtime/pprof"
 	"strings"
-	"sync/atomic"
 	"testing"
 	"time"
 	_ "unsafe"
@@ -57,15 +56,6 @@ func fillStats(t *testing.T, metric interface {
 	ConsiderValue(time.Duration)
 	DoSlice()
 }) {
-	waitForQueues := func(expectedCount uint64) uint64 {
-		for {
-			runtime.Gosched()
-			if v := atomic.LoadUint64(&considerValueQueueCount); v >= expectedCount {
-				return v
-			}
-		}
-	}
-
 	gosched := func() {
 		for i := 0; i < 100; i++ {
 			runtime.Gosched()
@@ -74,16 +64,13 @@ func fillStats(t *testing.T, metric interface {
 
 	gosched()
 
-	queueCount := atomic.LoadUint64(&considerValueQueueCount)
 	metric.ConsiderValue(time.Nanosecond * 5000)
-	considerValueQueueChan <- swapConsiderValueQueue()
-	queueCount = waitForQueues(queueCount + 1)
+	Flush()
 
 	metric.DoSlice()
 	metric.ConsiderValue(time.Nanosecond * 6000)
 	metric.ConsiderValue(time.Nanosecond * 7000)
-	considerValueQueueChan <- swapConsiderValueQueue()
-	queueCount = waitForQueues(queueCount + 1)
+	Flush()
 
 	metric.DoSlice()
 	metric.ConsiderValue(time.Nanosecond * 3000)
@@ -146,15 +133,13 @@ func fillStats(t *testing.T, metric interface {
 	metric.ConsiderValue(time.Nanosecond * 4000)
 	metric.ConsiderValue(time.Nanosecond * 6000)
 	metric.ConsiderValue(time.Nanosecond * 5000)
-	considerValueQueueChan <- swapConsiderValueQueue()
-	queueCount = waitForQueues(queueCount + 1)
+	Flush()
 
 	gosched()
 
 	metric.DoSlice()
 	metric.ConsiderValue(time.Nanosecond * 500000)
-	considerValueQueueChan <- swapConsiderValueQueue()
-	queueCount = waitForQueues(queueCount + 1)
+	Flush()
 
 	gosched()
 }